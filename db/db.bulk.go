@@ -0,0 +1,367 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+//identReg 表名与列名,防止拼接SQL时注入
+var identReg = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_$#.]*$`)
+
+//bulkDialect 批量写入的SQL方言
+type bulkDialect struct {
+	//maxParams 单条语句的参数上限,maxRows 单条语句的行数上限,0表示不限制
+	maxParams int
+	maxRows   int
+	//maxInsertParams insert语句的参数上限,0表示使用maxParams
+	maxInsertParams int
+	//bind 返回第i个(从1开始)参数的占位符
+	bind   func(i int) string
+	insert func(d *bulkDialect, table string, columns []string, n int) string
+	//upsert 为nil表示数据库不支持
+	upsert func(d *bulkDialect, table string, columns []string, keys []string, n int) string
+}
+
+var (
+	mysqlBulk = &bulkDialect{
+		maxParams: 65535,
+		bind:      func(int) string { return "?" },
+		insert:    valuesInsert,
+		upsert: func(d *bulkDialect, table string, columns []string, keys []string, n int) string {
+			sets := make([]string, 0, len(columns))
+			for _, c := range updateColumns(columns, keys) {
+				sets = append(sets, fmt.Sprintf("%s=VALUES(%s)", c, c))
+			}
+			if len(sets) == 0 {
+				sets = append(sets, fmt.Sprintf("%s=%s", keys[0], keys[0]))
+			}
+			return valuesInsert(d, table, columns, n) + " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ",")
+		},
+	}
+	postgresBulk = &bulkDialect{
+		maxParams: 65535,
+		bind:      func(i int) string { return "$" + strconv.Itoa(i) },
+		insert:    valuesInsert,
+		upsert:    conflictUpsert,
+	}
+	sqliteBulk = &bulkDialect{
+		//SQLITE_MAX_VARIABLE_NUMBER在3.32之前默认为999
+		maxParams: 999,
+		bind:      func(int) string { return "?" },
+		insert:    valuesInsert,
+		upsert:    conflictUpsert,
+	}
+	oracleBulk = &bulkDialect{
+		maxParams: 65535,
+		maxRows:   1000,
+		//INSERT ALL中所有INTO子句的列总数不能超过1000(ORA-24335)
+		maxInsertParams: 1000,
+		bind:            func(i int) string { return ":" + strconv.Itoa(i) },
+		insert: func(d *bulkDialect, table string, columns []string, n int) string {
+			var b strings.Builder
+			b.WriteString("INSERT ALL")
+			for i := 0; i < n; i++ {
+				fmt.Fprintf(&b, " INTO %s (%s) VALUES %s", table, strings.Join(columns, ","), bindRow(d, i, len(columns)))
+			}
+			b.WriteString(" SELECT 1 FROM DUAL")
+			return b.String()
+		},
+		upsert: func(d *bulkDialect, table string, columns []string, keys []string, n int) string {
+			var b strings.Builder
+			fmt.Fprintf(&b, "MERGE INTO %s t USING (", table)
+			for i := 0; i < n; i++ {
+				if i > 0 {
+					b.WriteString(" UNION ALL ")
+				}
+				b.WriteString("SELECT ")
+				for j, c := range columns {
+					if j > 0 {
+						b.WriteString(",")
+					}
+					fmt.Fprintf(&b, "%s %s", d.bind(i*len(columns)+j+1), c)
+				}
+				b.WriteString(" FROM DUAL")
+			}
+			on := make([]string, 0, len(keys))
+			for _, k := range keys {
+				on = append(on, fmt.Sprintf("t.%s=s.%s", k, k))
+			}
+			fmt.Fprintf(&b, ") s ON (%s)", strings.Join(on, " AND "))
+			if update := updateColumns(columns, keys); len(update) > 0 {
+				sets := make([]string, 0, len(update))
+				for _, c := range update {
+					sets = append(sets, fmt.Sprintf("t.%s=s.%s", c, c))
+				}
+				fmt.Fprintf(&b, " WHEN MATCHED THEN UPDATE SET %s", strings.Join(sets, ","))
+			}
+			values := make([]string, 0, len(columns))
+			for _, c := range columns {
+				values = append(values, "s."+c)
+			}
+			fmt.Fprintf(&b, " WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)", strings.Join(columns, ","), strings.Join(values, ","))
+			return b.String()
+		},
+	}
+	sqlserverBulk = &bulkDialect{
+		//单条语句最多2100个参数,VALUES最多1000行
+		maxParams: 2100,
+		maxRows:   1000,
+		bind:      func(i int) string { return "@p" + strconv.Itoa(i) },
+		insert:    valuesInsert,
+		upsert: func(d *bulkDialect, table string, columns []string, keys []string, n int) string {
+			rows := make([]string, 0, n)
+			for i := 0; i < n; i++ {
+				rows = append(rows, bindRow(d, i, len(columns)))
+			}
+			var b strings.Builder
+			fmt.Fprintf(&b, "MERGE INTO %s WITH (HOLDLOCK) AS t USING (VALUES %s) AS s (%s)", table, strings.Join(rows, ","), strings.Join(columns, ","))
+			on := make([]string, 0, len(keys))
+			for _, k := range keys {
+				on = append(on, fmt.Sprintf("t.%s=s.%s", k, k))
+			}
+			fmt.Fprintf(&b, " ON (%s)", strings.Join(on, " AND "))
+			if update := updateColumns(columns, keys); len(update) > 0 {
+				sets := make([]string, 0, len(update))
+				for _, c := range update {
+					sets = append(sets, fmt.Sprintf("t.%s=s.%s", c, c))
+				}
+				fmt.Fprintf(&b, " WHEN MATCHED THEN UPDATE SET %s", strings.Join(sets, ","))
+			}
+			values := make([]string, 0, len(columns))
+			for _, c := range columns {
+				values = append(values, "s."+c)
+			}
+			fmt.Fprintf(&b, " WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s);", strings.Join(columns, ","), strings.Join(values, ","))
+			return b.String()
+		},
+	}
+	//clickhouse没有唯一约束,不支持upsert
+	clickhouseBulk = &bulkDialect{
+		maxParams: 65535,
+		bind:      func(int) string { return "?" },
+		insert:    valuesInsert,
+	}
+
+	bulkDialects = map[string]*bulkDialect{
+		"mysql":      mysqlBulk,
+		"postgres":   postgresBulk,
+		"sqlite":     sqliteBulk,
+		"sqlite3":    sqliteBulk,
+		"oracle":     oracleBulk,
+		"ora":        oracleBulk,
+		"oci8":       oracleBulk,
+		"dm":         oracleBulk,
+		"sqlserver":  sqlserverBulk,
+		"clickhouse": clickhouseBulk,
+	}
+)
+
+//bindRow 第row行(从0开始)的占位符,如(?,?)
+func bindRow(d *bulkDialect, row int, columns int) string {
+	binds := make([]string, 0, columns)
+	for j := 0; j < columns; j++ {
+		binds = append(binds, d.bind(row*columns+j+1))
+	}
+	return "(" + strings.Join(binds, ",") + ")"
+}
+
+//valuesInsert 多行VALUES的插入语句
+func valuesInsert(d *bulkDialect, table string, columns []string, n int) string {
+	rows := make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		rows = append(rows, bindRow(d, i, len(columns)))
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s", table, strings.Join(columns, ","), strings.Join(rows, ","))
+}
+
+//conflictUpsert postgres与sqlite的ON CONFLICT
+func conflictUpsert(d *bulkDialect, table string, columns []string, keys []string, n int) string {
+	update := updateColumns(columns, keys)
+	if len(update) == 0 {
+		return fmt.Sprintf("%s ON CONFLICT (%s) DO NOTHING", valuesInsert(d, table, columns, n), strings.Join(keys, ","))
+	}
+	sets := make([]string, 0, len(update))
+	for _, c := range update {
+		sets = append(sets, fmt.Sprintf("%s=excluded.%s", c, c))
+	}
+	return fmt.Sprintf("%s ON CONFLICT (%s) DO UPDATE SET %s", valuesInsert(d, table, columns, n), strings.Join(keys, ","), strings.Join(sets, ","))
+}
+
+//updateColumns 除冲突键之外需要更新的列
+func updateColumns(columns []string, keys []string) []string {
+	update := make([]string, 0, len(columns))
+	for _, c := range columns {
+		key := false
+		for _, k := range keys {
+			if strings.EqualFold(c, k) {
+				key = true
+				break
+			}
+		}
+		if !key {
+			update = append(update, c)
+		}
+	}
+	return update
+}
+
+//bulkBatch 一条批量写入语句
+type bulkBatch struct {
+	query string
+	args  []interface{}
+}
+
+//buildBulk 生成批量写入语句,超过参数或行数上限时拆分为多条,keys不为nil时生成upsert
+func buildBulk(provider string, table string, columns []string, rows [][]interface{}, keys []string) ([]bulkBatch, error) {
+	d, ok := bulkDialects[provider]
+	if !ok {
+		return nil, fmt.Errorf("不支持批量写入的数据库类型:%s", provider)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("批量写入的列不能为空")
+	}
+	for _, v := range append(append([]string{table}, columns...), keys...) {
+		if !identReg.MatchString(v) {
+			return nil, fmt.Errorf("无效的表名或列名:%s", v)
+		}
+	}
+	if keys != nil {
+		if d.upsert == nil {
+			return nil, fmt.Errorf("%s不支持upsert", provider)
+		}
+		if len(keys) == 0 {
+			return nil, fmt.Errorf("upsert的冲突键不能为空")
+		}
+		for _, k := range keys {
+			if len(updateColumns([]string{k}, columns)) != 0 {
+				return nil, fmt.Errorf("冲突键%s不在列中", k)
+			}
+		}
+	}
+	for i, row := range rows {
+		if len(row) != len(columns) {
+			return nil, fmt.Errorf("第%d行有%d个值,需要%d个", i, len(row), len(columns))
+		}
+	}
+
+	maxParams := d.maxParams
+	if keys == nil && d.maxInsertParams > 0 {
+		maxParams = d.maxInsertParams
+	}
+	size := maxParams / len(columns)
+	if d.maxRows > 0 && size > d.maxRows {
+		size = d.maxRows
+	}
+	if size == 0 {
+		return nil, fmt.Errorf("列数%d超过了参数上限%d", len(columns), maxParams)
+	}
+
+	batches := make([]bulkBatch, 0, (len(rows)+size-1)/size)
+	for start := 0; start < len(rows); start += size {
+		end := start + size
+		if end > len(rows) {
+			end = len(rows)
+		}
+		b := bulkBatch{args: make([]interface{}, 0, (end-start)*len(columns))}
+		for _, row := range rows[start:end] {
+			b.args = append(b.args, row...)
+		}
+		if keys == nil {
+			b.query = d.insert(d, table, columns, end-start)
+		} else {
+			b.query = d.upsert(d, table, columns, keys, end-start)
+		}
+		batches = append(batches, b)
+	}
+	return batches, nil
+}
+
+//BulkInsert 批量插入数据,rows中每行值的顺序与columns一致
+func (db *DB) BulkInsert(table string, columns []string, rows [][]interface{}) (affectedRow int64, err error) {
+	return db.BulkInsertContext(context.Background(), table, columns, rows)
+}
+
+//BulkInsertContext 批量插入数据,超过数据库参数上限时拆分为多条语句在同一事务中执行
+func (db *DB) BulkInsertContext(ctx context.Context, table string, columns []string, rows [][]interface{}) (affectedRow int64, err error) {
+	return db.bulk(ctx, table, columns, rows, nil)
+}
+
+//BulkUpsert 批量插入数据,与conflictKeys冲突时更新其它列.
+//mysql使用ON DUPLICATE KEY UPDATE(由表的唯一索引决定冲突,更新的行计为2行),
+//postgres与sqlite使用ON CONFLICT,oracle使用MERGE INTO
+func (db *DB) BulkUpsert(table string, columns []string, rows [][]interface{}, conflictKeys []string) (affectedRow int64, err error) {
+	return db.BulkUpsertContext(context.Background(), table, columns, rows, conflictKeys)
+}
+
+//BulkUpsertContext 批量插入或更新数据,规则同BulkUpsert
+func (db *DB) BulkUpsertContext(ctx context.Context, table string, columns []string, rows [][]interface{}, conflictKeys []string) (affectedRow int64, err error) {
+	if conflictKeys == nil {
+		conflictKeys = []string{}
+	}
+	return db.bulk(ctx, table, columns, rows, conflictKeys)
+}
+
+func (db *DB) bulk(ctx context.Context, table string, columns []string, rows [][]interface{}, keys []string) (affectedRow int64, err error) {
+	batches, err := buildBulk(db.provider, table, columns, rows, keys)
+	if err != nil || len(batches) == 0 {
+		return 0, err
+	}
+	if len(batches) == 1 {
+		return db.db.ExecuteContext(ctx, batches[0].query, batches[0].args...)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	if affectedRow, err = tx.(*DBTrans).execBatches(ctx, batches); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	return affectedRow, tx.Commit()
+}
+
+//BulkInsert 在事务中批量插入数据
+func (t *DBTrans) BulkInsert(table string, columns []string, rows [][]interface{}) (affectedRow int64, err error) {
+	return t.BulkInsertContext(context.Background(), table, columns, rows)
+}
+
+//BulkInsertContext 在事务中批量插入数据,超过数据库参数上限时拆分为多条语句
+func (t *DBTrans) BulkInsertContext(ctx context.Context, table string, columns []string, rows [][]interface{}) (affectedRow int64, err error) {
+	batches, err := buildBulk(t.provider, table, columns, rows, nil)
+	if err != nil {
+		return 0, err
+	}
+	return t.execBatches(ctx, batches)
+}
+
+//BulkUpsert 在事务中批量插入或更新数据,规则同DB.BulkUpsert
+func (t *DBTrans) BulkUpsert(table string, columns []string, rows [][]interface{}, conflictKeys []string) (affectedRow int64, err error) {
+	return t.BulkUpsertContext(context.Background(), table, columns, rows, conflictKeys)
+}
+
+//BulkUpsertContext 在事务中批量插入或更新数据,规则同DB.BulkUpsert
+func (t *DBTrans) BulkUpsertContext(ctx context.Context, table string, columns []string, rows [][]interface{}, conflictKeys []string) (affectedRow int64, err error) {
+	if conflictKeys == nil {
+		conflictKeys = []string{}
+	}
+	batches, err := buildBulk(t.provider, table, columns, rows, conflictKeys)
+	if err != nil {
+		return 0, err
+	}
+	return t.execBatches(ctx, batches)
+}
+
+func (t *DBTrans) execBatches(ctx context.Context, batches []bulkBatch) (affectedRow int64, err error) {
+	for _, b := range batches {
+		row, err := t.tx.ExecuteContext(ctx, b.query, b.args...)
+		if err != nil {
+			return affectedRow, err
+		}
+		affectedRow += row
+	}
+	return affectedRow, nil
+}
@@ -0,0 +1,126 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestBuildBulk(t *testing.T) {
+	rows := [][]interface{}{{1, "a"}, {2, "b"}}
+	cases := []struct {
+		provider string
+		keys     []string
+		query    string
+	}{
+		{"mysql", nil, "INSERT INTO t (id,name) VALUES (?,?),(?,?)"},
+		{"sqlite", nil, "INSERT INTO t (id,name) VALUES (?,?),(?,?)"},
+		{"postgres", nil, "INSERT INTO t (id,name) VALUES ($1,$2),($3,$4)"},
+		{"oracle", nil, "INSERT ALL INTO t (id,name) VALUES (:1,:2) INTO t (id,name) VALUES (:3,:4) SELECT 1 FROM DUAL"},
+		{"mysql", []string{"id"}, "INSERT INTO t (id,name) VALUES (?,?),(?,?) ON DUPLICATE KEY UPDATE name=VALUES(name)"},
+		{"postgres", []string{"id"}, "INSERT INTO t (id,name) VALUES ($1,$2),($3,$4) ON CONFLICT (id) DO UPDATE SET name=excluded.name"},
+		{"sqlite", []string{"id", "name"}, "INSERT INTO t (id,name) VALUES (?,?),(?,?) ON CONFLICT (id,name) DO NOTHING"},
+		{"sqlserver", nil, "INSERT INTO t (id,name) VALUES (@p1,@p2),(@p3,@p4)"},
+		{"sqlserver", []string{"id"}, "MERGE INTO t WITH (HOLDLOCK) AS t USING (VALUES (@p1,@p2),(@p3,@p4)) AS s (id,name) ON (t.id=s.id)" +
+			" WHEN MATCHED THEN UPDATE SET t.name=s.name WHEN NOT MATCHED THEN INSERT (id,name) VALUES (s.id,s.name);"},
+		{"clickhouse", nil, "INSERT INTO t (id,name) VALUES (?,?),(?,?)"},
+		{"dm", nil, "INSERT ALL INTO t (id,name) VALUES (:1,:2) INTO t (id,name) VALUES (:3,:4) SELECT 1 FROM DUAL"},
+		{"oracle", []string{"id"}, "MERGE INTO t t USING (SELECT :1 id,:2 name FROM DUAL UNION ALL SELECT :3 id,:4 name FROM DUAL) s ON (t.id=s.id)" +
+			" WHEN MATCHED THEN UPDATE SET t.name=s.name WHEN NOT MATCHED THEN INSERT (id,name) VALUES (s.id,s.name)"},
+	}
+	for _, c := range cases {
+		batches, err := buildBulk(c.provider, "t", []string{"id", "name"}, rows, c.keys)
+		if err != nil || len(batches) != 1 {
+			t.Fatalf("%s: %v", c.provider, err)
+		}
+		if batches[0].query != c.query {
+			t.Errorf("%s %v:\nexpect %s\nactual %s", c.provider, c.keys, c.query, batches[0].query)
+		}
+		if len(batches[0].args) != 4 || batches[0].args[3] != "b" {
+			t.Errorf("%s: wrong args %v", c.provider, batches[0].args)
+		}
+	}
+}
+
+func TestBuildBulkSplit(t *testing.T) {
+	rows := make([][]interface{}, 1000)
+	for i := range rows {
+		rows[i] = []interface{}{i, i, i}
+	}
+	//sqlite单条语句最多999个参数,即333行
+	batches, err := buildBulk("sqlite", "t", []string{"a", "b", "c"}, rows, nil)
+	if err != nil || len(batches) != 4 {
+		t.Fatalf("expect 4 batches, actual %d %v", len(batches), err)
+	}
+	if len(batches[0].args) != 999 || len(batches[3].args) != 3 || batches[3].args[0] != 999 {
+		t.Errorf("wrong split, %d %v", len(batches[0].args), batches[3].args)
+	}
+
+	rows = append(rows, []interface{}{1, 2, 3})
+	//oracle INSERT ALL最多1000个列,即333行
+	for _, provider := range []string{"oracle", "dm"} {
+		batches, _ = buildBulk(provider, "t", []string{"a", "b", "c"}, rows, nil)
+		if len(batches) != 4 || len(batches[0].args) != 999 || len(batches[3].args) != 6 {
+			t.Errorf("%s insert should be limited to 1000 binds, actual %d batches", provider, len(batches))
+		}
+	}
+	//MERGE只受1000行的限制
+	if batches, _ = buildBulk("oracle", "t", []string{"a", "b", "c"}, rows, []string{"a"}); len(batches) != 2 || len(batches[0].args) != 3000 {
+		t.Errorf("oracle merge should be limited to 1000 rows per statement, actual %d batches", len(batches))
+	}
+}
+
+func TestBuildBulkInvalid(t *testing.T) {
+	cols := []string{"id", "name"}
+	rows := [][]interface{}{{1, "a"}}
+	cases := map[string]func() error{
+		"provider": func() error { _, err := buildBulk("mssql", "t", cols, rows, nil); return err },
+		"columns":  func() error { _, err := buildBulk("mysql", "t", nil, rows, nil); return err },
+		"table":    func() error { _, err := buildBulk("mysql", "t;drop table t", cols, rows, nil); return err },
+		"row":      func() error { _, err := buildBulk("mysql", "t", cols, [][]interface{}{{1}}, nil); return err },
+		"upsert":   func() error { _, err := buildBulk("clickhouse", "t", cols, rows, []string{"id"}); return err },
+		"keys":     func() error { _, err := buildBulk("mysql", "t", cols, rows, []string{}); return err },
+		"key":      func() error { _, err := buildBulk("mysql", "t", cols, rows, []string{"code"}); return err },
+	}
+	for name, fn := range cases {
+		if fn() == nil {
+			t.Errorf("%s: expect error", name)
+		}
+	}
+}
+
+func TestBulkInsert(t *testing.T) {
+	db, d := newFakeDB(t, "sqlite", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		return &fakeResult{affected: int64(len(args))}, nil
+	})
+
+	row, err := db.BulkInsert("t", []string{"id"}, [][]interface{}{{1}, {2}})
+	if err != nil || row != 2 || d.commits != 0 {
+		t.Errorf("single batch should run without transaction, %d %d %v", row, d.commits, err)
+	}
+
+	rows := make([][]interface{}, 1500)
+	for i := range rows {
+		rows[i] = []interface{}{i}
+	}
+	row, err = db.BulkUpsert("t", []string{"id"}, rows, []string{"id"})
+	if err != nil || row != 1500 || d.commits != 1 {
+		t.Errorf("batches should run in one transaction, %d %d %v", row, d.commits, err)
+	}
+	if q := d.Queries(); len(q) != 3 || !strings.HasSuffix(q[2], "ON CONFLICT (id) DO NOTHING") {
+		t.Errorf("wrong queries %d", len(q))
+	}
+
+	fail := errors.New("fail")
+	d.handler = func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		if len(args) < 999 {
+			return nil, fail
+		}
+		return &fakeResult{affected: int64(len(args))}, nil
+	}
+	if _, err = db.BulkInsert("t", []string{"id"}, rows); err != fail || d.rollbacks != 1 {
+		t.Errorf("failed batch should roll back, %d %v", d.rollbacks, err)
+	}
+}
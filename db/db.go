@@ -1,6 +1,9 @@
 package db
 
 import (
+	"context"
+	"database/sql"
+	"strings"
 	"time"
 
 	"github.com/champly/lib4go/db/tpl"
@@ -17,6 +20,25 @@ type IDB interface {
 	// ExecuteSP(procName string, input map[string]interface{}, output ...interface{}) (row int64, query string, err error)
 }
 
+//IDBContext 在IDB基础上增加支持ctx的查询、流式读取、批量写入与事务方法
+type IDBContext interface {
+	IDB
+	QueryContext(ctx context.Context, sql string, input map[string]interface{}) (data []QRow, query string, args []interface{}, err error)
+	QueryRows(ctx context.Context, sql string, input map[string]interface{}) (rows *sql.Rows, query string, args []interface{}, err error)
+	Cursor(ctx context.Context, sql string, input map[string]interface{}) (rows *Rows, query string, args []interface{}, err error)
+	Each(ctx context.Context, sql string, input map[string]interface{}, fn func(row QRow) error) (query string, args []interface{}, err error)
+	EachBatch(ctx context.Context, sql string, input map[string]interface{}, size int, fn func(rows []QRow) error) (query string, args []interface{}, err error)
+	ScalarContext(ctx context.Context, sql string, input map[string]interface{}) (data interface{}, query string, args []interface{}, err error)
+	ExecuteContext(ctx context.Context, sql string, input map[string]interface{}) (row int64, query string, args []interface{}, err error)
+	ExecutesContext(ctx context.Context, sql string, input map[string]interface{}) (lastInsertID, affectedRow int64, query string, args []interface{}, err error)
+	BulkInsert(table string, columns []string, rows [][]interface{}) (affectedRow int64, err error)
+	BulkInsertContext(ctx context.Context, table string, columns []string, rows [][]interface{}) (affectedRow int64, err error)
+	BulkUpsert(table string, columns []string, rows [][]interface{}, conflictKeys []string) (affectedRow int64, err error)
+	BulkUpsertContext(ctx context.Context, table string, columns []string, rows [][]interface{}, conflictKeys []string) (affectedRow int64, err error)
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (IDBTransContext, error)
+	WithTx(ctx context.Context, opts *TxOptions, fn func(tx IDBTransContext) error) error
+}
+
 //IDBTrans 数据库事务接口
 type IDBTrans interface {
 	Query(sql string, input map[string]interface{}) (data []QRow, query string, args []interface{}, err error)
@@ -27,15 +49,34 @@ type IDBTrans interface {
 	Commit() error
 }
 
+//IDBTransContext 在IDBTrans基础上增加支持ctx的查询、流式读取、批量写入与保存点方法
+type IDBTransContext interface {
+	IDBTrans
+	QueryContext(ctx context.Context, sql string, input map[string]interface{}) (data []QRow, query string, args []interface{}, err error)
+	QueryRows(ctx context.Context, sql string, input map[string]interface{}) (rows *sql.Rows, query string, args []interface{}, err error)
+	Cursor(ctx context.Context, sql string, input map[string]interface{}) (rows *Rows, query string, args []interface{}, err error)
+	Each(ctx context.Context, sql string, input map[string]interface{}, fn func(row QRow) error) (query string, args []interface{}, err error)
+	EachBatch(ctx context.Context, sql string, input map[string]interface{}, size int, fn func(rows []QRow) error) (query string, args []interface{}, err error)
+	ScalarContext(ctx context.Context, sql string, input map[string]interface{}) (data interface{}, query string, args []interface{}, err error)
+	ExecuteContext(ctx context.Context, sql string, input map[string]interface{}) (row int64, query string, args []interface{}, err error)
+	ExecutesContext(ctx context.Context, sql string, input map[string]interface{}) (lastInsertID int64, affectedRow int64, query string, args []interface{}, err error)
+	BulkInsert(table string, columns []string, rows [][]interface{}) (affectedRow int64, err error)
+	BulkInsertContext(ctx context.Context, table string, columns []string, rows [][]interface{}) (affectedRow int64, err error)
+	BulkUpsert(table string, columns []string, rows [][]interface{}, conflictKeys []string) (affectedRow int64, err error)
+	BulkUpsertContext(ctx context.Context, table string, columns []string, rows [][]interface{}, conflictKeys []string) (affectedRow int64, err error)
+	WithTx(ctx context.Context, fn func(tx IDBTransContext) error) error
+}
+
 //DB 数据库操作类
 type DB struct {
-	db  ISysDB
-	tpl tpl.ITPLContext
+	provider string
+	db       ISysDBContext
+	tpl      tpl.ITPLContext
 }
 
 //NewDB 创建DB实例
 func NewDB(provider string, connString string, maxOpen int, maxIdle int, maxLifeTime int) (obj *DB, err error) {
-	obj = &DB{}
+	obj = &DB{provider: strings.ToLower(provider)}
 	obj.tpl, err = tpl.GetDBContext(provider)
 	if err != nil {
 		return
@@ -51,15 +92,32 @@ func (db *DB) GetTPL() tpl.ITPLContext {
 
 //Query 查询数据
 func (db *DB) Query(sql string, input map[string]interface{}) (data []QRow, query string, args []interface{}, err error) {
+	return db.QueryContext(context.Background(), sql, input)
+}
+
+//QueryContext 查询数据,ctx取消或超时后中止查询
+func (db *DB) QueryContext(ctx context.Context, sql string, input map[string]interface{}) (data []QRow, query string, args []interface{}, err error) {
 	query, args = db.tpl.GetSQLContext(sql, input)
-	data, _, err = db.db.Query(query, args...)
+	data, _, err = db.db.QueryContext(ctx, query, args...)
+	return
+}
+
+//QueryRows 查询数据,返回原始结果集,调用方负责关闭
+func (db *DB) QueryRows(ctx context.Context, sql string, input map[string]interface{}) (rows *sql.Rows, query string, args []interface{}, err error) {
+	query, args = db.tpl.GetSQLContext(sql, input)
+	rows, err = db.db.QueryRows(ctx, query, args...)
 	return
 }
 
 //Scalar 根据包含@名称占位符的查询语句执行查询语句
 func (db *DB) Scalar(sql string, input map[string]interface{}) (data interface{}, query string, args []interface{}, err error) {
+	return db.ScalarContext(context.Background(), sql, input)
+}
+
+//ScalarContext 根据包含@名称占位符的查询语句执行查询语句,返回第一行第一列
+func (db *DB) ScalarContext(ctx context.Context, sql string, input map[string]interface{}) (data interface{}, query string, args []interface{}, err error) {
 	query, args = db.tpl.GetSQLContext(sql, input)
-	result, colus, err := db.db.Query(query, args...)
+	result, colus, err := db.db.QueryContext(ctx, query, args...)
 	if err != nil || len(result) == 0 || len(result[0]) == 0 || len(colus) == 0 {
 		return
 	}
@@ -69,23 +127,38 @@ func (db *DB) Scalar(sql string, input map[string]interface{}) (data interface{}
 
 //Executes 根据包含@名称占位符的语句执行查询语句
 func (db *DB) Executes(sql string, input map[string]interface{}) (insertID int64, row int64, query string, args []interface{}, err error) {
+	return db.ExecutesContext(context.Background(), sql, input)
+}
+
+//ExecutesContext 根据包含@名称占位符的语句执行查询语句,返回最后插入的ID和影响行数
+func (db *DB) ExecutesContext(ctx context.Context, sql string, input map[string]interface{}) (insertID int64, row int64, query string, args []interface{}, err error) {
 	query, args = db.tpl.GetSQLContext(sql, input)
-	insertID, row, err = db.db.Executes(query, args...)
+	insertID, row, err = db.db.ExecutesContext(ctx, query, args...)
 	return
 }
 
 //Execute 根据包含@名称占位符的语句执行查询语句
 func (db *DB) Execute(sql string, input map[string]interface{}) (row int64, query string, args []interface{}, err error) {
+	return db.ExecuteContext(context.Background(), sql, input)
+}
+
+//ExecuteContext 根据包含@名称占位符的语句执行查询语句,返回影响行数
+func (db *DB) ExecuteContext(ctx context.Context, sql string, input map[string]interface{}) (row int64, query string, args []interface{}, err error) {
 	query, args = db.tpl.GetSQLContext(sql, input)
-	row, err = db.db.Execute(query, args...)
+	row, err = db.db.ExecuteContext(ctx, query, args...)
 	return
 }
 
 //ExecuteSP 根据包含@名称占位符的语句执行查询语句
 func (db *DB) ExecuteSP(procName string, input map[string]interface{}, output ...interface{}) (row int64, query string, err error) {
+	return db.ExecuteSPContext(context.Background(), procName, input, output...)
+}
+
+//ExecuteSPContext 根据包含@名称占位符的语句执行存储过程
+func (db *DB) ExecuteSPContext(ctx context.Context, procName string, input map[string]interface{}, output ...interface{}) (row int64, query string, err error) {
 	query, args := db.tpl.GetSPContext(procName, input)
 	ni := append(args, output...)
-	row, err = db.db.Execute(query, ni...)
+	row, err = db.db.ExecuteContext(ctx, query, ni...)
 	return
 }
 
@@ -96,8 +169,13 @@ func (db *DB) Replace(sql string, args []interface{}) string {
 
 //Begin 创建事务
 func (db *DB) Begin() (t IDBTrans, err error) {
-	tt := &DBTrans{}
-	tt.tx, err = db.db.Begin()
+	return db.BeginTx(context.Background(), nil)
+}
+
+//BeginTx 创建事务,ctx结束时事务自动回滚,opts可指定隔离级别与只读
+func (db *DB) BeginTx(ctx context.Context, opts *sql.TxOptions) (t IDBTransContext, err error) {
+	tt := &DBTrans{provider: db.provider}
+	tt.tx, err = db.db.BeginTx(ctx, opts)
 	if err != nil {
 		return
 	}
@@ -105,6 +183,16 @@ func (db *DB) Begin() (t IDBTrans, err error) {
 	return tt, nil
 }
 
+//SetStmtCache 设置预编译语句缓存的容量,语句按最终SQL缓存,size小于等于0时关闭缓存(默认)
+func (db *DB) SetStmtCache(size int) {
+	db.db.SetStmtCache(size)
+}
+
+//StmtCacheStats 获取预编译语句缓存的统计
+func (db *DB) StmtCacheStats() tpl.CacheStats {
+	return db.db.StmtCacheStats()
+}
+
 //Close  关闭当前数据库连接
 func (db *DB) Close() error {
 	return db.db.Close()
@@ -1,82 +1,249 @@
 package db
 
-import "strconv"
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
 
-// QRow 查询结果
-type QRow map[string]string
+// QRow 查询结果,列值为驱动返回的类型(int64,uint64,float64,bool,[]byte,string,time.Time),NULL为nil
+//
+// 由map[string]string迁移时:
+//   - row["x"]不再是string,应改为row.GetString("x")
+//   - NULL列的键存在且值为nil,原来键不存在,应使用row.IsNull("x")判断
+//   - 时间列由GetString按RFC3339Nano格式化,可由GetTime原样解析
+type QRow map[string]interface{}
 
-// GetInt 获取int类型
-func (q QRow) GetInt(n string, def ...int) int {
-	s, ok := q[n]
-	if !ok {
+// timeLayouts 字符串转换为时间时尝试的格式
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// IsNull 列不存在或值为NULL
+func (q QRow) IsNull(n string) bool {
+	return q[n] == nil
+}
+
+// Get 获取驱动返回的原始值
+func (q QRow) Get(n string) interface{} {
+	return q[n]
+}
+
+// GetString 获取string类型,[]byte按文本转换,时间按RFC3339Nano格式化
+func (q QRow) GetString(n string, def ...string) string {
+	switch v := q[n].(type) {
+	case nil:
 		if len(def) > 0 {
 			return def[0]
 		}
-		return 0
+		return ""
+	case string:
+		return v
+	case []byte:
+		return string(v)
+	case time.Time:
+		return v.Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
 	}
-	r, err := strconv.Atoi(s)
-	if err != nil {
-		if len(def) > 0 {
-			return def[0]
-		}
-		return 0
+}
+
+// GetBytes 获取[]byte类型
+func (q QRow) GetBytes(n string) []byte {
+	switch v := q[n].(type) {
+	case nil:
+		return nil
+	case []byte:
+		return v
+	case string:
+		return []byte(v)
+	default:
+		return []byte(q.GetString(n))
 	}
-	return r
 }
 
-// GetInt64 获取int类型
-func (q QRow) GetInt64(n string, def ...int64) int64 {
-	s, ok := q[n]
+// GetInt 获取int类型
+func (q QRow) GetInt(n string, def ...int) int {
+	r, ok := toInt64(q[n])
 	if !ok {
 		if len(def) > 0 {
 			return def[0]
 		}
 		return 0
 	}
-	r, err := strconv.Atoi(s)
-	if err != nil {
+	return int(r)
+}
+
+// GetInt64 获取int64类型
+func (q QRow) GetInt64(n string, def ...int64) int64 {
+	r, ok := toInt64(q[n])
+	if !ok {
 		if len(def) > 0 {
 			return def[0]
 		}
 		return 0
 	}
-	return int64(r)
+	return r
 }
 
 // GetFloat32 获取float32类型
 func (q QRow) GetFloat32(n string, def ...float32) float32 {
-	s, ok := q[n]
+	r, ok := toFloat64(q[n])
 	if !ok {
 		if len(def) > 0 {
 			return def[0]
 		}
 		return 0
 	}
-	r, err := strconv.ParseFloat(s, 32)
-	if err != nil {
-		if len(def) > 0 {
-			return def[0]
-		}
-		return 0
-	}
 	return float32(r)
 }
 
 // GetFloat64 获取float64类型
 func (q QRow) GetFloat64(n string, def ...float64) float64 {
-	s, ok := q[n]
+	r, ok := toFloat64(q[n])
 	if !ok {
 		if len(def) > 0 {
 			return def[0]
 		}
 		return 0
 	}
-	r, err := strconv.ParseFloat(s, 64)
+	return r
+}
+
+// GetBool 获取bool类型,数字非0为true
+func (q QRow) GetBool(n string, def ...bool) bool {
+	var r bool
+	var err error
+	switch v := q[n].(type) {
+	case bool:
+		return v
+	case string:
+		r, err = strconv.ParseBool(strings.TrimSpace(v))
+	case []byte:
+		r, err = strconv.ParseBool(strings.TrimSpace(string(v)))
+	default:
+		f, ok := toFloat64(v)
+		if !ok {
+			err = fmt.Errorf("unsupported type %T", v)
+		}
+		r = f != 0
+	}
 	if err != nil {
 		if len(def) > 0 {
 			return def[0]
 		}
-		return 0
+		return false
 	}
 	return r
 }
+
+// GetTime 获取time.Time类型,字符串按RFC3339或2006-01-02 15:04:05格式解析
+func (q QRow) GetTime(n string, def ...time.Time) time.Time {
+	var s string
+	switch v := q[n].(type) {
+	case time.Time:
+		return v
+	case string:
+		s = v
+	case []byte:
+		s = string(v)
+	}
+	for _, layout := range timeLayouts {
+		if s == "" {
+			break
+		}
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t
+		}
+	}
+	if len(def) > 0 {
+		return def[0]
+	}
+	return time.Time{}
+}
+
+// toInt64 转换驱动返回的数字,uint64超过int64范围时失败
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint64:
+		return int64(v), v <= math.MaxInt64
+	case uint:
+		return int64(v), uint64(v) <= math.MaxInt64
+	case uint32:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case float64:
+		return int64(v), true
+	case float32:
+		return int64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	case string:
+		return parseInt64(v)
+	case []byte:
+		return parseInt64(string(v))
+	}
+	return 0, false
+}
+
+func parseInt64(s string) (int64, bool) {
+	r, err := strconv.ParseInt(strings.TrimSpace(s), 10, 64)
+	return r, err == nil
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int32:
+		return float64(v), true
+	case int16:
+		return float64(v), true
+	case int8:
+		return float64(v), true
+	case uint64:
+		return float64(v), true
+	case uint:
+		return float64(v), true
+	case uint32:
+		return float64(v), true
+	case uint16:
+		return float64(v), true
+	case uint8:
+		return float64(v), true
+	case string:
+		r, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return r, err == nil
+	case []byte:
+		r, err := strconv.ParseFloat(strings.TrimSpace(string(v)), 64)
+		return r, err == nil
+	}
+	return 0, false
+}
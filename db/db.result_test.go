@@ -1,7 +1,9 @@
 package db
 
 import (
+	"math"
 	"testing"
+	"time"
 )
 
 func TestT1(t *testing.T) {
@@ -18,3 +20,57 @@ func TestT1(t *testing.T) {
 	// fmt.Println("v_name:", v_name)
 	// fmt.Println("v_result:", v_result)
 }
+
+func TestQRow(t *testing.T) {
+	now := time.Date(2023, 5, 1, 8, 30, 0, 0, time.Local)
+	row := QRow{
+		"id":      int64(9007199254740993),
+		"price":   float64(12.5),
+		"text":    []byte("42"),
+		"empty":   "",
+		"null":    nil,
+		"created": now,
+		"date":    []byte("2023-05-01 08:30:00"),
+		"flag":    int64(1),
+		"bin":     []byte{0xff, 0x00},
+		"uint":    uint64(42),
+		"big":     uint64(math.MaxUint64),
+		"small":   int8(-3),
+		"ushort":  uint16(0),
+	}
+	row["created_text"] = row.GetString("created")
+
+	cases := []struct {
+		name   string
+		actual interface{}
+		except interface{}
+	}{
+		{"int64 keeps precision", row.GetInt64("id"), int64(9007199254740993)},
+		{"float", row.GetFloat64("price"), 12.5},
+		{"text int", row.GetInt("text"), 42},
+		{"empty string", row.GetString("empty", "def"), ""},
+		{"null string", row.GetString("null", "def"), "def"},
+		{"null int", row.GetInt("null", -1), -1},
+		{"missing", row.GetInt64("missing", 3), int64(3)},
+		{"time", row.GetTime("created"), now},
+		{"time text", row.GetTime("date"), now},
+		{"time string", row.GetString("created"), now.Format(time.RFC3339Nano)},
+		{"time round trip", row.GetTime("created_text").Equal(now), true},
+		{"bool", row.GetBool("flag"), true},
+		{"bytes", string(row.GetBytes("bin")), "\xff\x00"},
+		{"uint64 int", row.GetInt("uint"), 42},
+		{"uint64 int64", row.GetInt64("uint"), int64(42)},
+		{"uint64 float", row.GetFloat64("uint"), float64(42)},
+		{"uint64 bool", row.GetBool("uint"), true},
+		{"uint64 overflow", row.GetInt64("big", -1), int64(-1)},
+		{"int8", row.GetInt("small"), -3},
+		{"uint16 bool", row.GetBool("ushort", true), false},
+		{"is null", row.IsNull("null"), true},
+		{"empty is not null", row.IsNull("empty"), false},
+	}
+	for _, c := range cases {
+		if c.actual != c.except {
+			t.Errorf("%s except %v actual %v", c.name, c.except, c.actual)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+//ErrBreak Each与EachBatch的回调返回该错误时停止读取,不作为错误返回
+var ErrBreak = errors.New("break iteration")
+
+//Rows 逐行读取的查询结果,适用于不能全部载入内存的大结果集,使用完必须调用Close
+type Rows struct {
+	rows    *sql.Rows
+	columns []string
+	values  []interface{}
+	buffer  []interface{}
+}
+
+func newRows(rows *sql.Rows) (*Rows, error) {
+	colus, err := rows.Columns()
+	if err != nil {
+		rows.Close()
+		return nil, err
+	}
+	r := &Rows{
+		rows:    rows,
+		columns: make([]string, 0, len(colus)),
+		values:  make([]interface{}, len(colus)),
+		buffer:  make([]interface{}, len(colus)),
+	}
+	for index, v := range colus {
+		r.columns = append(r.columns, strings.ToLower(v))
+		r.buffer[index] = &r.values[index]
+	}
+	return r, nil
+}
+
+//Columns 小写的列名
+func (r *Rows) Columns() []string {
+	return r.columns
+}
+
+//Next 移动到下一行,没有数据、出错或ctx结束时返回false,原因由Err返回
+func (r *Rows) Next() bool {
+	return r.rows.Next()
+}
+
+//Row 读取当前行,列值保持驱动返回的类型
+func (r *Rows) Row() (QRow, error) {
+	return r.row(0)
+}
+
+//Scan 将当前行扫描到dest,规则同sql.Rows.Scan
+func (r *Rows) Scan(dest ...interface{}) error {
+	return r.rows.Scan(dest...)
+}
+
+//Err 读取过程中的错误,ctx取消或超时时为ctx的错误
+func (r *Rows) Err() error {
+	return r.rows.Err()
+}
+
+//Close 关闭结果集,可重复调用
+func (r *Rows) Close() error {
+	return r.rows.Close()
+}
+
+//row 读取当前行的前col列,col为0时读取所有列
+func (r *Rows) row(col int) (QRow, error) {
+	// 扫描到*interface{}时驱动返回的[]byte会被复制,可直接保存
+	if err := r.rows.Scan(r.buffer...); err != nil {
+		return nil, err
+	}
+	row := make(QRow, len(r.columns))
+	for index := 0; index < len(r.columns) && (index < col || col == 0); index++ {
+		row[r.columns[index]] = r.values[index]
+	}
+	return row, nil
+}
+
+//each 每读取size行调用一次fn,最后不足size行时也会调用,读取完成后关闭结果集.
+//fn返回后rows会被复用,不能在fn之外保留
+func (r *Rows) each(ctx context.Context, size int, fn func(rows []QRow) error) error {
+	defer r.Close()
+	if size <= 0 {
+		size = 1
+	}
+
+	batch := make([]QRow, 0, size)
+	for r.Next() {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		row, err := r.Row()
+		if err != nil {
+			return err
+		}
+		if batch = append(batch, row); len(batch) < size {
+			continue
+		}
+		if err = fn(batch); err != nil {
+			return breakErr(err)
+		}
+		batch = batch[:0]
+	}
+	if err := r.Err(); err != nil {
+		return err
+	}
+	if len(batch) > 0 {
+		return breakErr(fn(batch))
+	}
+	return nil
+}
+
+func breakErr(err error) error {
+	if errors.Is(err, ErrBreak) {
+		return nil
+	}
+	return err
+}
+
+//Cursor 查询数据,返回逐行读取的结果集,使用完必须调用Close
+func (db *DB) Cursor(ctx context.Context, sql string, input map[string]interface{}) (rows *Rows, query string, args []interface{}, err error) {
+	r, query, args, err := db.QueryRows(ctx, sql, input)
+	if err != nil {
+		return
+	}
+	rows, err = newRows(r)
+	return
+}
+
+//Each 逐行读取查询结果并调用fn,fn返回ErrBreak时停止读取
+func (db *DB) Each(ctx context.Context, sql string, input map[string]interface{}, fn func(row QRow) error) (query string, args []interface{}, err error) {
+	return db.EachBatch(ctx, sql, input, 1, func(rows []QRow) error {
+		return fn(rows[0])
+	})
+}
+
+//EachBatch 每读取size行调用一次fn,适用于批量导出,fn返回ErrBreak时停止读取,rows切片在fn返回后会被复用
+func (db *DB) EachBatch(ctx context.Context, sql string, input map[string]interface{}, size int, fn func(rows []QRow) error) (query string, args []interface{}, err error) {
+	rows, query, args, err := db.Cursor(ctx, sql, input)
+	if err != nil {
+		return
+	}
+	err = rows.each(ctx, size, fn)
+	return
+}
+
+//Cursor 查询数据,返回逐行读取的结果集,使用完必须调用Close
+func (t *DBTrans) Cursor(ctx context.Context, sql string, input map[string]interface{}) (rows *Rows, query string, args []interface{}, err error) {
+	r, query, args, err := t.QueryRows(ctx, sql, input)
+	if err != nil {
+		return
+	}
+	rows, err = newRows(r)
+	return
+}
+
+//Each 逐行读取查询结果并调用fn,fn返回ErrBreak时停止读取
+func (t *DBTrans) Each(ctx context.Context, sql string, input map[string]interface{}, fn func(row QRow) error) (query string, args []interface{}, err error) {
+	return t.EachBatch(ctx, sql, input, 1, func(rows []QRow) error {
+		return fn(rows[0])
+	})
+}
+
+//EachBatch 每读取size行调用一次fn,适用于批量导出,fn返回ErrBreak时停止读取,rows切片在fn返回后会被复用
+func (t *DBTrans) EachBatch(ctx context.Context, sql string, input map[string]interface{}, size int, fn func(rows []QRow) error) (query string, args []interface{}, err error) {
+	rows, query, args, err := t.Cursor(ctx, sql, input)
+	if err != nil {
+		return
+	}
+	err = rows.each(ctx, size, fn)
+	return
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"testing"
+)
+
+func newRowsDB(t *testing.T, n int) *DB {
+	rows := make([][]driver.Value, n)
+	for i := range rows {
+		rows[i] = []driver.Value{int64(i), nil}
+	}
+	db, _ := newFakeDB(t, "mysql", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		return &fakeResult{columns: []string{"ID", "NOTE"}, rows: rows}, nil
+	})
+	return db
+}
+
+func TestCursor(t *testing.T) {
+	db := newRowsDB(t, 5)
+
+	rows, query, args, err := db.Cursor(context.Background(), "select id,note from t where id>@id", map[string]interface{}{"id": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	if query != "select id,note from t where id>?" || len(args) != 1 || len(rows.Columns()) != 2 {
+		t.Errorf("unexpected query %s %v %v", query, args, rows.Columns())
+	}
+
+	var n int64
+	for rows.Next() {
+		row, err := rows.Row()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if row.GetInt64("id") != n || !row.IsNull("note") {
+			t.Errorf("unexpected row %d %v", n, row)
+		}
+		n++
+	}
+	if rows.Err() != nil || n != 5 {
+		t.Errorf("read %d rows %v", n, rows.Err())
+	}
+}
+
+func TestEach(t *testing.T) {
+	db := newRowsDB(t, 10)
+
+	var ids []int64
+	_, _, err := db.Each(context.Background(), "select * from t", nil, func(row QRow) error {
+		ids = append(ids, row.GetInt64("id"))
+		if len(ids) == 4 {
+			return ErrBreak
+		}
+		return nil
+	})
+	if err != nil || len(ids) != 4 {
+		t.Errorf("break after 4 rows, actual %v %v", ids, err)
+	}
+
+	var sizes []int
+	_, _, err = db.EachBatch(context.Background(), "select * from t", nil, 3, func(rows []QRow) error {
+		sizes = append(sizes, len(rows))
+		return nil
+	})
+	if err != nil || len(sizes) != 4 || sizes[0] != 3 || sizes[3] != 1 {
+		t.Errorf("unexpected batches %v %v", sizes, err)
+	}
+
+	fail := errors.New("write fail")
+	if _, _, err = db.EachBatch(context.Background(), "select * from t", nil, 3, func(rows []QRow) error {
+		return fail
+	}); err != fail {
+		t.Errorf("except callback error, actual %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	n := 0
+	_, _, err = db.Each(ctx, "select * from t", nil, func(row QRow) error {
+		if n++; n == 2 {
+			cancel()
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || n != 2 {
+		t.Errorf("except canceled after 2 rows, actual %d %v", n, err)
+	}
+}
+
+func TestEachTrans(t *testing.T) {
+	db := newRowsDB(t, 3)
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	n := 0
+	if _, _, err = tx.Each(context.Background(), "select * from t", nil, func(row QRow) error {
+		n++
+		return nil
+	}); err != nil || n != 3 {
+		t.Errorf("each in transaction %d %v", n, err)
+	}
+}
@@ -0,0 +1,180 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+)
+
+//IRowsQuery 返回原始结果集的查询接口,DB与DBTrans均已实现
+type IRowsQuery interface {
+	QueryRows(ctx context.Context, sql string, input map[string]interface{}) (rows *sql.Rows, query string, args []interface{}, err error)
+}
+
+//QueryInto 查询数据并按列名映射到T的字段
+//T为结构体(或其指针)时,列按字段的db标签匹配,无标签时按字段名忽略大小写匹配,标签为"-"的字段忽略,
+//匿名嵌入结构体的字段同样参与匹配,没有对应字段的列被丢弃;
+//T为其它类型(如int64,string,time.Time或sql.Scanner)时查询只能返回一列.
+//可能为NULL的列需使用指针或sql.Null*类型的字段
+func QueryInto[T any](ctx context.Context, db IRowsQuery, sql string, input map[string]interface{}) (data []T, query string, args []interface{}, err error) {
+	rows, query, args, err := db.QueryRows(ctx, sql, input)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	s, err := newRowScanner[T](rows)
+	if err != nil {
+		return
+	}
+	data = make([]T, 0)
+	for rows.Next() {
+		var v T
+		if err = s.scan(rows, &v); err != nil {
+			return nil, query, args, err
+		}
+		data = append(data, v)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, query, args, err
+	}
+	return
+}
+
+//QueryOne 查询第一行数据并映射到T,规则同QueryInto,没有数据时返回sql.ErrNoRows
+func QueryOne[T any](ctx context.Context, db IRowsQuery, sql string, input map[string]interface{}) (data T, query string, args []interface{}, err error) {
+	rows, query, args, err := db.QueryRows(ctx, sql, input)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	s, err := newRowScanner[T](rows)
+	if err != nil {
+		return
+	}
+	if !rows.Next() {
+		if err = rows.Err(); err == nil {
+			err = errNoRows
+		}
+		return
+	}
+	err = s.scan(rows, &data)
+	return
+}
+
+//errNoRows 参数sql遮蔽了database/sql包
+var errNoRows = sql.ErrNoRows
+
+var (
+	scannerType = reflect.TypeOf((*sql.Scanner)(nil)).Elem()
+	timeType    = reflect.TypeOf(time.Time{})
+	fieldCache  sync.Map
+)
+
+//rowScanner 将一行数据扫描到T
+type rowScanner struct {
+	//fields 为每列对应字段的索引路径,nil表示丢弃该列;T不是结构体时为nil
+	fields [][]int
+	//ptr T为结构体指针
+	ptr  bool
+	dest []interface{}
+}
+
+func newRowScanner[T any](rows *sql.Rows) (*rowScanner, error) {
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+	s := &rowScanner{dest: make([]interface{}, len(columns))}
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	if t.Kind() == reflect.Ptr && isStruct(t.Elem()) {
+		s.ptr = true
+		t = t.Elem()
+	}
+	if !isStruct(t) {
+		if len(columns) != 1 {
+			return nil, fmt.Errorf("%s只能接收1列,查询返回%d列", t, len(columns))
+		}
+		return s, nil
+	}
+
+	fields := structFields(t)
+	s.fields = make([][]int, len(columns))
+	for i, c := range columns {
+		s.fields[i] = fields[strings.ToLower(c)]
+	}
+	return s, nil
+}
+
+func (s *rowScanner) scan(rows *sql.Rows, v interface{}) error {
+	if s.fields == nil {
+		return rows.Scan(v)
+	}
+
+	target := reflect.ValueOf(v).Elem()
+	if s.ptr {
+		target.Set(reflect.New(target.Type().Elem()))
+		target = target.Elem()
+	}
+	for i, index := range s.fields {
+		if index == nil {
+			s.dest[i] = new(interface{})
+			continue
+		}
+		s.dest[i] = target.FieldByIndex(index).Addr().Interface()
+	}
+	return rows.Scan(s.dest...)
+}
+
+//isStruct 是否按字段映射,time.Time与实现sql.Scanner的结构体直接扫描
+func isStruct(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != timeType && !reflect.PtrTo(t).Implements(scannerType)
+}
+
+//structFields 返回结构体列名(小写)到字段索引路径的映射
+func structFields(t reflect.Type) map[string][]int {
+	if v, ok := fieldCache.Load(t); ok {
+		return v.(map[string][]int)
+	}
+	fields := map[string][]int{}
+	collectFields(t, nil, fields)
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+func collectFields(t reflect.Type, parent []int, fields map[string][]int) {
+	var embedded []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("db")
+		if tag == "-" || (!f.IsExported() && !f.Anonymous) {
+			continue
+		}
+		index := append(append([]int{}, parent...), i)
+		if f.Anonymous && tag == "" && isStruct(f.Type) {
+			f.Index = index
+			embedded = append(embedded, f)
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.ToLower(tag)
+		if name == "" {
+			name = strings.ToLower(f.Name)
+		}
+		if _, ok := fields[name]; !ok {
+			fields[name] = index
+		}
+	}
+	//外层字段优先于嵌入结构体的同名字段
+	for _, f := range embedded {
+		collectFields(f.Type, f.Index, fields)
+	}
+}
@@ -0,0 +1,108 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"testing"
+	"time"
+)
+
+type baseModel struct {
+	ID      int64     `db:"id"`
+	Created time.Time `db:"created"`
+}
+
+type userModel struct {
+	baseModel
+	Name     string         `db:"user_name"`
+	Email    *string        `db:"email"`
+	Nick     sql.NullString `db:"nick"`
+	Balance  float64
+	Avatar   []byte `db:"avatar"`
+	Password string `db:"-"`
+}
+
+func TestQueryInto(t *testing.T) {
+	created := time.Date(2023, 5, 1, 8, 0, 0, 0, time.UTC)
+	db, _ := newFakeDB(t, "mysql", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		switch query {
+		case "select id from user":
+			return &fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{int64(1)}, {int64(2)}}}, nil
+		case "select * from user where id=?":
+			if args[0].Value != int64(0) {
+				break
+			}
+			return &fakeResult{columns: []string{"id"}}, nil
+		}
+		return &fakeResult{
+			columns: []string{"ID", "USER_NAME", "EMAIL", "NICK", "BALANCE", "AVATAR", "CREATED", "PASSWORD", "EXTRA"},
+			rows: [][]driver.Value{
+				{int64(1), "a", "a@b.c", "aa", 12345678.125, []byte{0, 1}, created, "x", "y"},
+				{int64(2), "b", nil, nil, float64(0), nil, created, "x", "y"},
+			},
+		}, nil
+	})
+
+	users, query, args, err := QueryInto[userModel](context.Background(), db, "select * from user where name=@name", map[string]interface{}{"name": "a"})
+	if err != nil || len(users) != 2 {
+		t.Fatalf("query into %v %v", users, err)
+	}
+	if query != "select * from user where name=?" || len(args) != 1 {
+		t.Errorf("unexpected query %s %v", query, args)
+	}
+	u := users[0]
+	if u.ID != 1 || u.Name != "a" || u.Email == nil || *u.Email != "a@b.c" || u.Nick.String != "aa" ||
+		u.Balance != 12345678.125 || string(u.Avatar) != "\x00\x01" || !u.Created.Equal(created) || u.Password != "" {
+		t.Errorf("unexpected first user %+v", u)
+	}
+	if u = users[1]; u.Email != nil || u.Nick.Valid || u.Avatar != nil {
+		t.Errorf("NULL should keep zero values %+v", u)
+	}
+
+	ptrs, _, _, err := QueryInto[*userModel](context.Background(), db, "select * from user", nil)
+	if err != nil || len(ptrs) != 2 || ptrs[1].Name != "b" {
+		t.Errorf("query into pointers %v %v", ptrs, err)
+	}
+
+	ids, _, _, err := QueryInto[int64](context.Background(), db, "select id from user", nil)
+	if err != nil || len(ids) != 2 || ids[1] != 2 {
+		t.Errorf("query into scalars %v %v", ids, err)
+	}
+	if _, _, _, err = QueryInto[int64](context.Background(), db, "select * from user", nil); err == nil {
+		t.Error("scalar with many columns should fail")
+	}
+
+	one, _, _, err := QueryOne[userModel](context.Background(), db, "select * from user where id=@id", map[string]interface{}{"id": 1})
+	if err != nil || one.Name != "a" {
+		t.Errorf("query one %+v %v", one, err)
+	}
+	if _, _, _, err = QueryOne[userModel](context.Background(), db, "select * from user where id=@id", map[string]interface{}{"id": 0}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("except no rows, actual %v", err)
+	}
+
+	// a plain field can not receive NULL
+	type strict struct {
+		Email string `db:"email"`
+	}
+	if _, _, _, err = QueryInto[strict](context.Background(), db, "select * from user", nil); err == nil {
+		t.Error("NULL into string should fail")
+	}
+}
+
+func TestQueryIntoTrans(t *testing.T) {
+	db, _ := newFakeDB(t, "oracle", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		return &fakeResult{columns: []string{"NAME"}, rows: [][]driver.Value{{"a"}}}, nil
+	})
+	tx, err := db.BeginTx(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+
+	names, query, _, err := QueryInto[string](context.Background(), tx, "select name from t where id=@id", map[string]interface{}{"id": 1})
+	if err != nil || len(names) != 1 || names[0] != "a" || query != "select name from t where id=:1" {
+		t.Errorf("query into in transaction %v %s %v", names, query, err)
+	}
+}
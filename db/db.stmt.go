@@ -0,0 +1,184 @@
+package db
+
+import (
+	"container/list"
+	"context"
+	"database/sql"
+	"sync"
+
+	"github.com/champly/lib4go/db/tpl"
+)
+
+//stmtCache 按最终SQL缓存的预编译语句,容量为0时不缓存
+type stmtCache struct {
+	db *sql.DB
+
+	l        sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	hits     uint64
+	misses   uint64
+	closed   bool
+}
+
+//cachedStmt 被淘汰时如仍在使用,由最后一个使用者关闭
+type cachedStmt struct {
+	query   string
+	stmt    *sql.Stmt
+	refs    int
+	evicted bool
+}
+
+//txStmts 绑定到事务的预编译语句,每条SQL在事务中只绑定一次,随事务提交或回滚关闭
+type txStmts struct {
+	tx    *sql.Tx
+	l     sync.Mutex
+	stmts map[string]*sql.Stmt
+}
+
+func newTxStmts(tx *sql.Tx) *txStmts {
+	return &txStmts{tx: tx, stmts: map[string]*sql.Stmt{}}
+}
+
+func (t *txStmts) bind(ctx context.Context, s *cachedStmt) *sql.Stmt {
+	t.l.Lock()
+	defer t.l.Unlock()
+	if stmt, ok := t.stmts[s.query]; ok {
+		return stmt
+	}
+	stmt := t.tx.StmtContext(ctx, s.stmt)
+	t.stmts[s.query] = stmt
+	return stmt
+}
+
+func newStmtCache(db *sql.DB) *stmtCache {
+	return &stmtCache{db: db, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+//get 获取query的预编译语句,缓存关闭时返回nil,使用完后必须调用put
+func (c *stmtCache) get(ctx context.Context, query string) (*cachedStmt, error) {
+	c.l.Lock()
+	if c.capacity <= 0 || c.closed {
+		c.l.Unlock()
+		return nil, nil
+	}
+	if e, ok := c.items[query]; ok {
+		c.hits++
+		c.ll.MoveToFront(e)
+		s := e.Value.(*cachedStmt)
+		s.refs++
+		c.l.Unlock()
+		return s, nil
+	}
+	c.misses++
+	c.l.Unlock()
+
+	stmt, err := c.db.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	c.l.Lock()
+	defer c.l.Unlock()
+	if e, ok := c.items[query]; ok {
+		//并发预编译了相同的语句
+		stmt.Close()
+		s := e.Value.(*cachedStmt)
+		s.refs++
+		return s, nil
+	}
+	s := &cachedStmt{query: query, stmt: stmt, refs: 1}
+	if c.capacity <= 0 || c.closed {
+		s.evicted = true
+		return s, nil
+	}
+	c.items[query] = c.ll.PushFront(s)
+	c.trim()
+	return s, nil
+}
+
+func (c *stmtCache) put(s *cachedStmt) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	s.refs--
+	if s.evicted && s.refs == 0 {
+		s.stmt.Close()
+	}
+}
+
+func (c *stmtCache) trim() {
+	for c.ll.Len() > c.capacity && c.ll.Len() > 0 {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		s := e.Value.(*cachedStmt)
+		delete(c.items, s.query)
+		s.evicted = true
+		if s.refs == 0 {
+			s.stmt.Close()
+		}
+	}
+}
+
+func (c *stmtCache) resize(capacity int) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if capacity < 0 {
+		capacity = 0
+	}
+	c.capacity = capacity
+	c.trim()
+}
+
+func (c *stmtCache) stats() tpl.CacheStats {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return tpl.CacheStats{Hits: c.hits, Misses: c.misses, Size: c.ll.Len(), Capacity: c.capacity}
+}
+
+//close 关闭所有缓存的语句,之后不再缓存
+func (c *stmtCache) close() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.closed = true
+	c.capacity = 0
+	c.trim()
+}
+
+//queryContext 使用缓存的预编译语句执行查询,tx不为nil时在事务中执行
+func (c *stmtCache) queryContext(ctx context.Context, tx *txStmts, query string, args ...interface{}) (*sql.Rows, error) {
+	s, err := c.get(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		if tx != nil {
+			return tx.tx.QueryContext(ctx, query, args...)
+		}
+		return c.db.QueryContext(ctx, query, args...)
+	}
+	defer c.put(s)
+	if tx != nil {
+		return tx.bind(ctx, s).QueryContext(ctx, args...)
+	}
+	return s.stmt.QueryContext(ctx, args...)
+}
+
+//execContext 使用缓存的预编译语句执行操作,tx不为nil时在事务中执行
+func (c *stmtCache) execContext(ctx context.Context, tx *txStmts, query string, args ...interface{}) (sql.Result, error) {
+	s, err := c.get(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	if s == nil {
+		if tx != nil {
+			return tx.tx.ExecContext(ctx, query, args...)
+		}
+		return c.db.ExecContext(ctx, query, args...)
+	}
+	defer c.put(s)
+	if tx != nil {
+		return tx.bind(ctx, s).ExecContext(ctx, args...)
+	}
+	return s.stmt.ExecContext(ctx, args...)
+}
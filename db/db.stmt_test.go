@@ -0,0 +1,85 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestStmtCache(t *testing.T) {
+	db, d := newFakeDB(t, "mysql", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		return &fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{args[0].Value}}}, nil
+	})
+
+	// disabled by default
+	db.Query("select id from t where id=@id", map[string]interface{}{"id": 1})
+	if d.prepares != 0 || db.StmtCacheStats().Misses != 0 {
+		t.Errorf("cache should be disabled, prepares:%d", d.prepares)
+	}
+
+	db.SetStmtCache(2)
+	for i := 1; i <= 3; i++ {
+		data, _, _, err := db.Query("select id from t where id=@id", map[string]interface{}{"id": i})
+		if err != nil || data[0].GetInt("id") != i {
+			t.Fatalf("query %d %v %v", i, data, err)
+		}
+	}
+	if s := db.StmtCacheStats(); d.prepares != 1 || s.Hits != 2 || s.Misses != 1 || s.Size != 1 {
+		t.Errorf("statement should be prepared once, prepares:%d %+v", d.prepares, s)
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = tx.Execute("select id from t where id=@id", map[string]interface{}{"id": 1}); err != nil {
+		t.Fatal(err)
+	}
+	tx.Execute("select id from t where id=@id", map[string]interface{}{"id": 2})
+	if bound := tx.(*DBTrans).tx.(*SysDBTransaction).bound; len(bound.stmts) != 1 {
+		t.Errorf("statement should be bound to the transaction once, actual %d", len(bound.stmts))
+	}
+	tx.Commit()
+	if s := db.StmtCacheStats(); s.Hits != 4 {
+		t.Errorf("transaction should use the cache %+v", s)
+	}
+
+	// the least recently used statement is evicted
+	db.Execute("update t set a=1 where id=@id", map[string]interface{}{"id": 1})
+	db.Execute("delete from t where id=@id", map[string]interface{}{"id": 1})
+	db.Query("select id from t where id=@id", map[string]interface{}{"id": 1})
+	if s := db.StmtCacheStats(); s.Size != 2 || s.Misses != 4 {
+		t.Errorf("unexpected lru %+v", s)
+	}
+
+	db.Close()
+	if s := db.StmtCacheStats(); s.Size != 0 {
+		t.Errorf("close should clear the cache %+v", s)
+	}
+}
+
+func TestStmtCacheConcurrent(t *testing.T) {
+	db, _ := newFakeDB(t, "mysql", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		return &fakeResult{columns: []string{"id"}, rows: [][]driver.Value{{args[0].Value}}}, nil
+	})
+	db.SetStmtCache(1)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				// every call evicts the statement of another goroutine
+				sql := fmt.Sprintf("select id from t%d where id=@id", (i+j)%3)
+				if _, _, _, err := db.Query(sql, map[string]interface{}{"id": j}); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
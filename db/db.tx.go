@@ -0,0 +1,210 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultTxRetries = 3
+	defaultTxBackoff = 20 * time.Millisecond
+)
+
+//TxOptions WithTx的选项,零值使用默认值
+type TxOptions struct {
+	//Isolation 隔离级别,ReadOnly 只读事务
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+	//MaxRetries 序列化失败或死锁时重试的次数,默认3次,小于0时不重试
+	MaxRetries int
+	//Backoff 第一次重试前的等待时间,之后每次翻倍,默认20ms
+	Backoff time.Duration
+	//Retryable 判断错误是否可重试,默认使用数据库类型对应的分类器
+	Retryable func(err error) bool
+}
+
+//TxClassifier 判断事务错误是否为序列化失败或死锁等可重试的错误
+type TxClassifier func(err error) bool
+
+var (
+	txClassifiers = map[string]TxClassifier{}
+	txLock        sync.RWMutex
+)
+
+func init() {
+	RegisterTxClassifier("mysql", isMySQLRetryable)
+	RegisterTxClassifier("postgres", isPostgresRetryable)
+	RegisterTxClassifier("sqlite", isSqliteRetryable)
+	RegisterTxClassifier("sqlite3", isSqliteRetryable)
+	RegisterTxClassifier("oracle", isOracleRetryable)
+	RegisterTxClassifier("ora", isOracleRetryable)
+	RegisterTxClassifier("oci8", isOracleRetryable)
+	RegisterTxClassifier("sqlserver", isSQLServerRetryable)
+}
+
+//RegisterTxClassifier 注册数据库类型的事务错误分类器,已存在时覆盖
+func RegisterTxClassifier(provider string, fn TxClassifier) {
+	txLock.Lock()
+	defer txLock.Unlock()
+	txClassifiers[strings.ToLower(provider)] = fn
+}
+
+//IsRetryableTxError 根据数据库类型判断事务错误是否可重试
+func IsRetryableTxError(provider string, err error) bool {
+	if err == nil {
+		return false
+	}
+	txLock.RLock()
+	fn, ok := txClassifiers[strings.ToLower(provider)]
+	txLock.RUnlock()
+	return ok && fn(err)
+}
+
+//isMySQLRetryable 1213死锁,1205锁等待超时
+func isMySQLRetryable(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "Error 1213") || strings.Contains(msg, "Error 1205")
+}
+
+//isPostgresRetryable 40001序列化失败,40P01死锁,pq与pgx的错误都实现了SQLState
+func isPostgresRetryable(err error) bool {
+	var state interface{ SQLState() string }
+	if errors.As(err, &state) {
+		code := state.SQLState()
+		return code == "40001" || code == "40P01"
+	}
+	msg := err.Error()
+	return strings.Contains(msg, "SQLSTATE 40001") || strings.Contains(msg, "SQLSTATE 40P01")
+}
+
+//isSqliteRetryable SQLITE_BUSY与SQLITE_LOCKED
+func isSqliteRetryable(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "database is locked") || strings.Contains(msg, "database table is locked") ||
+		strings.Contains(msg, "SQLITE_BUSY")
+}
+
+//isOracleRetryable ORA-00060死锁,ORA-08177无法串行访问
+func isOracleRetryable(err error) bool {
+	msg := err.Error()
+	return strings.Contains(msg, "ORA-00060") || strings.Contains(msg, "ORA-08177")
+}
+
+//isSQLServerRetryable 1205死锁
+func isSQLServerRetryable(err error) bool {
+	var e interface{ SQLErrorNumber() int32 }
+	if errors.As(err, &e) {
+		return e.SQLErrorNumber() == 1205
+	}
+	return strings.Contains(err.Error(), "deadlock victim")
+}
+
+//WithTx 在事务中执行fn,fn返回nil时提交,返回错误或panic时回滚(panic会继续抛出).
+//序列化失败或死锁时整个fn会重新执行,因此fn不应有事务之外的副作用.
+//在fn中调用tx.WithTx可通过保存点嵌套执行
+func (db *DB) WithTx(ctx context.Context, opts *TxOptions, fn func(tx IDBTransContext) error) (err error) {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	retries, backoff, retryable := opts.MaxRetries, opts.Backoff, opts.Retryable
+	if retries == 0 {
+		retries = defaultTxRetries
+	}
+	if backoff <= 0 {
+		backoff = defaultTxBackoff
+	}
+	if retryable == nil {
+		retryable = func(err error) bool {
+			return IsRetryableTxError(db.provider, err)
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		err = db.runTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly}, fn)
+		if err == nil || attempt >= retries || !retryable(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (db *DB) runTx(ctx context.Context, opts *sql.TxOptions, fn func(tx IDBTransContext) error) (err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			panic(r)
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		if rerr := tx.Rollback(); rerr != nil && !errors.Is(rerr, sql.ErrTxDone) {
+			return fmt.Errorf("%w(rollback fail:%v)", err, rerr)
+		}
+		return err
+	}
+	return tx.Commit()
+}
+
+//WithTx 通过保存点在当前事务中执行fn,fn返回错误或panic时回滚到保存点,不影响事务中之前的操作
+func (t *DBTrans) WithTx(ctx context.Context, fn func(tx IDBTransContext) error) (err error) {
+	sp := savepointSQL(t.provider)
+	t.savepoints++
+	name := fmt.Sprintf("lib4go_sp_%d", t.savepoints)
+
+	if _, err = t.tx.ExecuteContext(ctx, fmt.Sprintf(sp.save, name)); err != nil {
+		return err
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			t.tx.ExecuteContext(ctx, fmt.Sprintf(sp.rollback, name))
+			panic(r)
+		}
+	}()
+
+	if err = fn(t); err != nil {
+		if _, rerr := t.tx.ExecuteContext(ctx, fmt.Sprintf(sp.rollback, name)); rerr != nil {
+			return fmt.Errorf("%w(rollback to savepoint fail:%v)", err, rerr)
+		}
+		return err
+	}
+	if sp.release == "" {
+		return nil
+	}
+	_, err = t.tx.ExecuteContext(ctx, fmt.Sprintf(sp.release, name))
+	return err
+}
+
+//savepoint 保存点语句,release为空表示数据库不支持释放保存点
+type savepoint struct {
+	save     string
+	rollback string
+	release  string
+}
+
+func savepointSQL(provider string) savepoint {
+	switch provider {
+	case "oracle", "ora", "oci8", "dm":
+		return savepoint{save: "SAVEPOINT %s", rollback: "ROLLBACK TO SAVEPOINT %s"}
+	case "sqlserver":
+		return savepoint{save: "SAVE TRANSACTION %s", rollback: "ROLLBACK TRANSACTION %s"}
+	default:
+		return savepoint{save: "SAVEPOINT %s", rollback: "ROLLBACK TO SAVEPOINT %s", release: "RELEASE SAVEPOINT %s"}
+	}
+}
@@ -0,0 +1,135 @@
+package db
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+type pgError struct {
+	code string
+}
+
+func (e *pgError) Error() string    { return "pq: could not serialize access" }
+func (e *pgError) SQLState() string { return e.code }
+
+func TestWithTx(t *testing.T) {
+	deadlocks := 2
+	db, d := newFakeDB(t, "mysql", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		if strings.HasPrefix(query, "update") && deadlocks > 0 {
+			deadlocks--
+			return nil, errors.New("Error 1213: Deadlock found when trying to get lock")
+		}
+		return &fakeResult{affected: 1}, nil
+	})
+
+	calls := 0
+	err := db.WithTx(context.Background(), nil, func(tx IDBTransContext) error {
+		calls++
+		_, _, _, err := tx.Execute("update t set a=@a", map[string]interface{}{"a": 1})
+		return err
+	})
+	if err != nil || calls != 3 || d.commits != 1 || d.rollbacks != 2 {
+		t.Errorf("deadlock should be retried, calls:%d commits:%d rollbacks:%d %v", calls, d.commits, d.rollbacks, err)
+	}
+
+	fail := errors.New("fail")
+	calls = 0
+	if err = db.WithTx(context.Background(), nil, func(tx IDBTransContext) error {
+		calls++
+		return fail
+	}); err != fail || calls != 1 || d.rollbacks != 3 {
+		t.Errorf("other errors should not be retried, calls:%d %v", calls, err)
+	}
+
+	deadlocks = 10
+	if err = db.WithTx(context.Background(), &TxOptions{MaxRetries: -1}, func(tx IDBTransContext) error {
+		_, _, _, err := tx.Execute("update t set a=1", nil)
+		return err
+	}); err == nil || deadlocks != 9 {
+		t.Errorf("retry should be disabled, %d %v", deadlocks, err)
+	}
+
+	func() {
+		defer func() {
+			if r := recover(); r != "boom" {
+				t.Errorf("panic should be raised again, actual %v", r)
+			}
+		}()
+		db.WithTx(context.Background(), nil, func(tx IDBTransContext) error {
+			panic("boom")
+		})
+	}()
+	if d.rollbacks != 5 {
+		t.Errorf("panic should roll back, rollbacks:%d", d.rollbacks)
+	}
+}
+
+func TestWithTxSavepoint(t *testing.T) {
+	for _, provider := range []string{"mysql", "oracle"} {
+		db, d := newFakeDB(t, provider, nil)
+		err := db.WithTx(context.Background(), nil, func(tx IDBTransContext) error {
+			tx.Execute("insert into t values(1)", nil)
+			inner := tx.WithTx(context.Background(), func(tx IDBTransContext) error {
+				tx.Execute("insert into t values(2)", nil)
+				return errors.New("inner fail")
+			})
+			if inner == nil {
+				t.Error("inner error should be returned")
+			}
+			return tx.WithTx(context.Background(), func(tx IDBTransContext) error {
+				_, _, _, err := tx.Execute("insert into t values(3)", nil)
+				return err
+			})
+		})
+		if err != nil || d.commits != 1 {
+			t.Errorf("%s outer transaction should commit, commits:%d %v", provider, d.commits, err)
+		}
+
+		except := []string{
+			"insert into t values(1)",
+			"SAVEPOINT lib4go_sp_1",
+			"insert into t values(2)",
+			"ROLLBACK TO SAVEPOINT lib4go_sp_1",
+			"SAVEPOINT lib4go_sp_2",
+			"insert into t values(3)",
+			"RELEASE SAVEPOINT lib4go_sp_2",
+		}
+		if provider == "oracle" {
+			except = except[:len(except)-1]
+		}
+		if actual := d.Queries(); fmt.Sprint(actual) != fmt.Sprint(except) {
+			t.Errorf("%s except %v\nactual %v", provider, except, actual)
+		}
+	}
+}
+
+func TestIsRetryableTxError(t *testing.T) {
+	cases := []struct {
+		provider string
+		err      error
+		except   bool
+	}{
+		{"mysql", errors.New("Error 1213 (40001): Deadlock found"), true},
+		{"mysql", errors.New("Error 1205: Lock wait timeout exceeded"), true},
+		{"mysql", errors.New("Error 1062: Duplicate entry"), false},
+		{"postgres", fmt.Errorf("update fail:%w", &pgError{code: "40001"}), true},
+		{"postgres", &pgError{code: "40P01"}, true},
+		{"postgres", &pgError{code: "23505"}, false},
+		{"sqlite", errors.New("database is locked"), true},
+		{"oracle", errors.New("ORA-08177: can't serialize access for this transaction"), true},
+		{"ORACLE", errors.New("ORA-00060: deadlock detected"), true},
+		{"oracle", errors.New("ORA-00001: unique constraint violated"), false},
+		{"sqlserver", errors.New("mssql: Transaction (Process ID 52) was deadlocked on lock resources with another process and has been chosen as the deadlock victim."), true},
+		{"unknown", errors.New("database is locked"), false},
+		{"mysql", nil, false},
+	}
+	for _, c := range cases {
+		if actual := IsRetryableTxError(c.provider, c.err); actual != c.except {
+			t.Errorf("%s %v except %v", c.provider, c.err, c.except)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/champly/lib4go/db/tpl"
+)
+
+// fakeResult is the answer of fakeDriver to one statement.
+type fakeResult struct {
+	columns  []string
+	rows     [][]driver.Value
+	lastID   int64
+	affected int64
+}
+
+type fakeHandler func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error)
+
+// fakeDriver is a database/sql driver answering every statement with handler
+// and recording what it was asked.
+type fakeDriver struct {
+	handler fakeHandler
+
+	l         sync.Mutex
+	queries   []string
+	args      [][]driver.NamedValue
+	txOptions []driver.TxOptions
+	commits   int
+	rollbacks int
+	prepares  int
+}
+
+func (d *fakeDriver) Open(name string) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+func (d *fakeDriver) Connect(ctx context.Context) (driver.Conn, error) {
+	return &fakeConn{d: d}, nil
+}
+
+func (d *fakeDriver) Driver() driver.Driver {
+	return d
+}
+
+func (d *fakeDriver) run(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+	d.l.Lock()
+	d.queries = append(d.queries, query)
+	d.args = append(d.args, args)
+	d.l.Unlock()
+
+	if d.handler == nil {
+		return &fakeResult{}, nil
+	}
+	r, err := d.handler(ctx, query, args)
+	if r == nil && err == nil {
+		r = &fakeResult{}
+	}
+	return r, err
+}
+
+func (d *fakeDriver) Queries() []string {
+	d.l.Lock()
+	defer d.l.Unlock()
+	return append([]string{}, d.queries...)
+}
+
+type fakeConn struct {
+	d *fakeDriver
+}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) {
+	c.d.l.Lock()
+	defer c.d.l.Unlock()
+	c.d.prepares++
+	return &fakeStmt{c: c, query: query}, nil
+}
+
+func (c *fakeConn) Close() error {
+	return nil
+}
+
+func (c *fakeConn) Begin() (driver.Tx, error) {
+	return c.BeginTx(context.Background(), driver.TxOptions{})
+}
+
+func (c *fakeConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	c.d.l.Lock()
+	defer c.d.l.Unlock()
+	c.d.txOptions = append(c.d.txOptions, opts)
+	return &fakeTx{d: c.d}, nil
+}
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	r, err := c.d.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return &fakeRows{r: r}, nil
+}
+
+func (c *fakeConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	r, err := c.d.run(ctx, query, args)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *fakeResult) LastInsertId() (int64, error) {
+	return r.lastID, nil
+}
+
+func (r *fakeResult) RowsAffected() (int64, error) {
+	return r.affected, nil
+}
+
+type fakeStmt struct {
+	c     *fakeConn
+	query string
+}
+
+func (s *fakeStmt) Close() error  { return nil }
+func (s *fakeStmt) NumInput() int { return -1 }
+
+func (s *fakeStmt) Exec(args []driver.Value) (driver.Result, error) {
+	return nil, driver.ErrSkip
+}
+
+func (s *fakeStmt) Query(args []driver.Value) (driver.Rows, error) {
+	return nil, driver.ErrSkip
+}
+
+func (s *fakeStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	return s.c.ExecContext(ctx, s.query, args)
+}
+
+func (s *fakeStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	return s.c.QueryContext(ctx, s.query, args)
+}
+
+type fakeTx struct {
+	d *fakeDriver
+}
+
+func (t *fakeTx) Commit() error {
+	t.d.l.Lock()
+	defer t.d.l.Unlock()
+	t.d.commits++
+	return nil
+}
+
+func (t *fakeTx) Rollback() error {
+	t.d.l.Lock()
+	defer t.d.l.Unlock()
+	t.d.rollbacks++
+	return nil
+}
+
+type fakeRows struct {
+	r *fakeResult
+	i int
+}
+
+func (r *fakeRows) Columns() []string {
+	return r.r.columns
+}
+
+func (r *fakeRows) Close() error {
+	return nil
+}
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.i >= len(r.r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.r.rows[r.i])
+	r.i++
+	return nil
+}
+
+// newFakeDB returns a DB of provider whose statements are answered by handler.
+func newFakeDB(t *testing.T, provider string, handler fakeHandler) (*DB, *fakeDriver) {
+	d := &fakeDriver{handler: handler}
+	ctx, err := tpl.GetDBContext(provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sdb := sql.OpenDB(d)
+	obj := &DB{provider: provider, db: &SysDB{provider: provider, db: sdb, stmts: newStmtCache(sdb)}, tpl: ctx}
+	t.Cleanup(func() { obj.Close() })
+	return obj, d
+}
+
+// the context interfaces extend the original ones, implementations of IDB stay valid
+var (
+	_ IDB                = &DB{}
+	_ IDBContext         = &DB{}
+	_ IDBTrans           = &DBTrans{}
+	_ IDBTransContext    = &DBTrans{}
+	_ ISysDB             = &SysDB{}
+	_ ISysDBContext      = &SysDB{}
+	_ ISysDBTrans        = &SysDBTransaction{}
+	_ ISysDBTransContext = &SysDBTransaction{}
+)
+
+func TestQueryContext(t *testing.T) {
+	db, d := newFakeDB(t, "mysql", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		if query == "select sleep" {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return &fakeResult{columns: []string{"ID", "NAME"}, rows: [][]driver.Value{{int64(1), "a"}, {int64(2), "b"}}}, nil
+	})
+
+	data, query, args, err := db.Query("select id,name from t where id=@id", map[string]interface{}{"id": 1})
+	if err != nil || len(data) != 2 || data[1]["name"] != "b" {
+		t.Fatalf("query %v %v", data, err)
+	}
+	if query != "select id,name from t where id=?" || len(args) != 1 || d.Queries()[0] != query {
+		t.Errorf("unexpected query %s %v", query, args)
+	}
+
+	v, _, _, err := db.ScalarContext(context.Background(), "select id from t", nil)
+	if err != nil || v != int64(1) {
+		t.Errorf("scalar %v %v", v, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if _, _, _, err = db.QueryContext(ctx, "select sleep", nil); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("except deadline exceeded, actual %v", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Error("query should stop at the deadline")
+	}
+}
+
+func TestExecuteContext(t *testing.T) {
+	db, _ := newFakeDB(t, "oracle", func(ctx context.Context, query string, args []driver.NamedValue) (*fakeResult, error) {
+		return &fakeResult{lastID: 7, affected: 3}, nil
+	})
+
+	row, query, _, err := db.ExecuteContext(context.Background(), "update t set a=@a", map[string]interface{}{"a": 1})
+	if err != nil || row != 3 || query != "update t set a=:1" {
+		t.Errorf("execute %d %s %v", row, query, err)
+	}
+	id, row, _, _, err := db.ExecutesContext(context.Background(), "insert into t values(@a)", map[string]interface{}{"a": 1})
+	if err != nil || id != 7 || row != 3 {
+		t.Errorf("executes %d %d %v", id, row, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, _, err = db.ExecuteContext(ctx, "update t set a=1", nil); !errors.Is(err, context.Canceled) {
+		t.Errorf("except canceled, actual %v", err)
+	}
+}
+
+func TestBeginTx(t *testing.T) {
+	db, d := newFakeDB(t, "mysql", nil)
+
+	tx, err := db.BeginTx(context.Background(), &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err = tx.ExecuteContext(context.Background(), "update t set a=@a", map[string]interface{}{"a": 1}); err != nil {
+		t.Fatal(err)
+	}
+	if err = tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if len(d.txOptions) != 1 || d.txOptions[0].Isolation != driver.IsolationLevel(sql.LevelSerializable) || !d.txOptions[0].ReadOnly || d.commits != 1 {
+		t.Errorf("unexpected tx %+v commits:%d", d.txOptions, d.commits)
+	}
+
+	// the transaction is rolled back when its context is done
+	ctx, cancel := context.WithCancel(context.Background())
+	tx, err = db.BeginTx(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if err = tx.Commit(); err == nil {
+		t.Error("commit after cancel should fail")
+	}
+}
@@ -1,24 +1,49 @@
 package db
 
-import "github.com/champly/lib4go/db/tpl"
+import (
+	"context"
+	"database/sql"
+
+	"github.com/champly/lib4go/db/tpl"
+)
 
 // DBTrans 数据库事务操作类
 type DBTrans struct {
-	tpl tpl.ITPLContext
-	tx  ISysDBTrans
+	provider string
+	tpl      tpl.ITPLContext
+	tx       ISysDBTransContext
+	//savepoints 已创建的保存点数量,用于生成保存点名称
+	savepoints int
 }
 
 //Query 查询数据
 func (t *DBTrans) Query(sql string, input map[string]interface{}) (data []QRow, query string, args []interface{}, err error) {
+	return t.QueryContext(context.Background(), sql, input)
+}
+
+//QueryContext 查询数据,ctx取消或超时后中止查询
+func (t *DBTrans) QueryContext(ctx context.Context, sql string, input map[string]interface{}) (data []QRow, query string, args []interface{}, err error) {
+	query, args = t.tpl.GetSQLContext(sql, input)
+	data, _, err = t.tx.QueryContext(ctx, query, args...)
+	return
+}
+
+//QueryRows 查询数据,返回原始结果集,调用方负责关闭
+func (t *DBTrans) QueryRows(ctx context.Context, sql string, input map[string]interface{}) (rows *sql.Rows, query string, args []interface{}, err error) {
 	query, args = t.tpl.GetSQLContext(sql, input)
-	data, _, err = t.tx.Query(query, args...)
+	rows, err = t.tx.QueryRows(ctx, query, args...)
 	return
 }
 
 //Scalar 根据包含@名称占位符的查询语句执行查询语句
 func (t *DBTrans) Scalar(sql string, input map[string]interface{}) (data interface{}, query string, args []interface{}, err error) {
+	return t.ScalarContext(context.Background(), sql, input)
+}
+
+//ScalarContext 根据包含@名称占位符的查询语句执行查询语句,返回第一行第一列
+func (t *DBTrans) ScalarContext(ctx context.Context, sql string, input map[string]interface{}) (data interface{}, query string, args []interface{}, err error) {
 	query, args = t.tpl.GetSQLContext(sql, input)
-	result, colus, err := t.tx.Query(query, args...)
+	result, colus, err := t.tx.QueryContext(ctx, query, args...)
 	if err != nil || len(result) == 0 || len(result[0]) == 0 || len(colus) == 0 {
 		return
 	}
@@ -28,22 +53,37 @@ func (t *DBTrans) Scalar(sql string, input map[string]interface{}) (data interfa
 
 //Executes 执行SQL操作语句
 func (t *DBTrans) Executes(sql string, input map[string]interface{}) (lastInsertID, affectedRow int64, query string, args []interface{}, err error) {
+	return t.ExecutesContext(context.Background(), sql, input)
+}
+
+//ExecutesContext 执行SQL操作语句,返回最后插入的ID和影响行数
+func (t *DBTrans) ExecutesContext(ctx context.Context, sql string, input map[string]interface{}) (lastInsertID, affectedRow int64, query string, args []interface{}, err error) {
 	query, args = t.tpl.GetSQLContext(sql, input)
-	lastInsertID, affectedRow, err = t.tx.Executes(query, args...)
+	lastInsertID, affectedRow, err = t.tx.ExecutesContext(ctx, query, args...)
 	return
 }
 
 //Execute 根据包含@名称占位符的语句执行查询语句
 func (t *DBTrans) Execute(sql string, input map[string]interface{}) (row int64, query string, args []interface{}, err error) {
+	return t.ExecuteContext(context.Background(), sql, input)
+}
+
+//ExecuteContext 根据包含@名称占位符的语句执行查询语句,返回影响行数
+func (t *DBTrans) ExecuteContext(ctx context.Context, sql string, input map[string]interface{}) (row int64, query string, args []interface{}, err error) {
 	query, args = t.tpl.GetSQLContext(sql, input)
-	row, err = t.tx.Execute(query, args...)
+	row, err = t.tx.ExecuteContext(ctx, query, args...)
 	return
 }
 
 //ExecuteSP 根据包含@名称占位符的语句执行查询语句
 func (t *DBTrans) ExecuteSP(sql string, input map[string]interface{}) (row int64, query string, args []interface{}, err error) {
+	return t.ExecuteSPContext(context.Background(), sql, input)
+}
+
+//ExecuteSPContext 根据包含@名称占位符的语句执行存储过程
+func (t *DBTrans) ExecuteSPContext(ctx context.Context, sql string, input map[string]interface{}) (row int64, query string, args []interface{}, err error) {
 	query, args = t.tpl.GetSPContext(sql, input)
-	row, err = t.tx.Execute(query, args...)
+	row, err = t.tx.ExecuteContext(ctx, query, args...)
 	return
 }
 
@@ -1,11 +1,12 @@
 package db
 
 import (
+	"context"
 	"database/sql"
 	"errors"
-	"fmt"
-	"strings"
 	"time"
+
+	"github.com/champly/lib4go/db/tpl"
 	//_ "github.com/mattn/go-oci8"
 	//_ "github.com/mattn/go-sqlite3"
 	//_ "gopkg.in/rana/ora.v4"
@@ -48,6 +49,18 @@ type ISysDB interface {
 	Close() error
 }
 
+//ISysDBContext 在ISysDB基础上增加支持ctx的方法与预编译语句缓存
+type ISysDBContext interface {
+	ISysDB
+	QueryContext(context.Context, string, ...interface{}) ([]QRow, []string, error)
+	QueryRows(context.Context, string, ...interface{}) (*sql.Rows, error)
+	ExecuteContext(context.Context, string, ...interface{}) (int64, error)
+	ExecutesContext(context.Context, string, ...interface{}) (int64, int64, error)
+	BeginTx(context.Context, *sql.TxOptions) (ISysDBTransContext, error)
+	SetStmtCache(size int)
+	StmtCacheStats() tpl.CacheStats
+}
+
 //ISysDBTrans 数据库事务接口
 type ISysDBTrans interface {
 	Query(string, ...interface{}) ([]QRow, []string, error)
@@ -57,6 +70,15 @@ type ISysDBTrans interface {
 	Commit() error
 }
 
+//ISysDBTransContext 在ISysDBTrans基础上增加支持ctx的方法
+type ISysDBTransContext interface {
+	ISysDBTrans
+	QueryContext(context.Context, string, ...interface{}) ([]QRow, []string, error)
+	QueryRows(context.Context, string, ...interface{}) (*sql.Rows, error)
+	ExecuteContext(context.Context, string, ...interface{}) (int64, error)
+	ExecutesContext(ctx context.Context, query string, args ...interface{}) (lastInsertID, affectedRow int64, err error)
+}
+
 //SysDB 数据库实体
 type SysDB struct {
 	provider   string
@@ -64,6 +86,7 @@ type SysDB struct {
 	db         *sql.DB
 	maxIdle    int
 	maxOpen    int
+	stmts      *stmtCache
 }
 
 //NewSysDB 创建DB实例
@@ -73,17 +96,15 @@ func NewSysDB(provider string, connString string, maxOpen int, maxIdle int, maxL
 		return
 	}
 	obj = &SysDB{provider: provider, connString: connString}
-	switch strings.ToLower(provider) {
-	case "ora", "oracle":
-		obj.db, err = sql.Open(OCI8, connString)
-	case "sqlite":
-		obj.db, err = sql.Open(SQLITE3, connString)
-	default:
-		obj.db, err = sql.Open(provider, connString)
+	//未注册的数据库类型直接作为驱动名称
+	driver := provider
+	if d, err := tpl.GetDialect(provider); err == nil {
+		driver = d.Driver
 	}
-	if err != nil {
+	if obj.db, err = sql.Open(driver, connString); err != nil {
 		return
 	}
+	obj.stmts = newStmtCache(obj.db)
 	obj.db.SetMaxIdleConns(maxIdle)
 	obj.db.SetMaxOpenConns(maxOpen)
 	obj.db.SetConnMaxLifetime(maxLifeTime)
@@ -93,11 +114,13 @@ func NewSysDB(provider string, connString string, maxOpen int, maxIdle int, maxL
 
 //Query 执行SQL查询语句
 func (db *SysDB) Query(query string, args ...interface{}) (dataRows []QRow, colus []string, err error) {
-	rows, err := db.db.Query(query, args...)
+	return db.QueryContext(context.Background(), query, args...)
+}
+
+//QueryContext 执行SQL查询语句,ctx取消或超时后中止查询
+func (db *SysDB) QueryContext(ctx context.Context, query string, args ...interface{}) (dataRows []QRow, colus []string, err error) {
+	rows, err := db.stmts.queryContext(ctx, nil, query, args...)
 	if err != nil {
-		if rows != nil {
-			rows.Close()
-		}
 		return
 	}
 	defer rows.Close()
@@ -106,45 +129,36 @@ func (db *SysDB) Query(query string, args ...interface{}) (dataRows []QRow, colu
 
 }
 
+//QueryRows 执行SQL查询语句,返回原始结果集,调用方负责关闭
+func (db *SysDB) QueryRows(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return db.stmts.queryContext(ctx, nil, query, args...)
+}
+
+//resolveRows 读取结果集,列值保持驱动返回的类型,NULL为nil
 func resolveRows(rows *sql.Rows, col int) (dataRows []QRow, columns []string, err error) {
-	dataRows = make([]QRow, 0)
-	colus, err := rows.Columns()
+	r, err := newRows(rows)
 	if err != nil {
 		return
 	}
-	columns = make([]string, 0, len(colus))
-	for _, v := range colus {
-		columns = append(columns, strings.ToLower(v))
-	}
-
-	for rows.Next() {
-		row := make(QRow)
-		dataRows = append(dataRows, row)
-		var buffer []interface{}
-		for index := 0; index < len(columns); index++ {
-			var va []byte
-			buffer = append(buffer, &va)
-		}
-		err = rows.Scan(buffer...)
+	dataRows = make([]QRow, 0)
+	for r.Next() {
+		row, err := r.row(col)
 		if err != nil {
-			return
-		}
-		for index := 0; index < len(columns) && (index < col || col == 0); index++ {
-			key := columns[index]
-			value := buffer[index]
-			if value == nil {
-				continue
-			} else {
-				row[key] = strings.TrimPrefix(fmt.Sprintf("%s", value), "&")
-			}
+			return nil, r.columns, err
 		}
+		dataRows = append(dataRows, row)
 	}
-	return
+	return dataRows, r.columns, r.Err()
 }
 
 //Executes 执行SQL操作语句
 func (db *SysDB) Executes(query string, args ...interface{}) (lastInsertID, affectedRow int64, err error) {
-	result, err := db.db.Exec(query, args...)
+	return db.ExecutesContext(context.Background(), query, args...)
+}
+
+//ExecutesContext 执行SQL操作语句,返回最后插入的ID和影响行数
+func (db *SysDB) ExecutesContext(ctx context.Context, query string, args ...interface{}) (lastInsertID, affectedRow int64, err error) {
+	result, err := db.stmts.execContext(ctx, nil, query, args...)
 	if err != nil {
 		return
 	}
@@ -158,7 +172,12 @@ func (db *SysDB) Executes(query string, args ...interface{}) (lastInsertID, affe
 
 //Execute 执行SQL操作语句
 func (db *SysDB) Execute(query string, args ...interface{}) (affectedRow int64, err error) {
-	result, err := db.db.Exec(query, args...)
+	return db.ExecuteContext(context.Background(), query, args...)
+}
+
+//ExecuteContext 执行SQL操作语句,返回影响行数
+func (db *SysDB) ExecuteContext(ctx context.Context, query string, args ...interface{}) (affectedRow int64, err error) {
+	result, err := db.stmts.execContext(ctx, nil, query, args...)
 	if err != nil {
 		return
 	}
@@ -167,12 +186,32 @@ func (db *SysDB) Execute(query string, args ...interface{}) (affectedRow int64,
 
 //Begin 创建一个事务请求
 func (db *SysDB) Begin() (r ISysDBTrans, err error) {
-	t := &SysDBTransaction{}
-	t.tx, err = db.db.Begin()
-	return t, err
+	return db.BeginTx(context.Background(), nil)
+}
+
+//BeginTx 创建一个事务请求,opts可指定隔离级别与只读,为nil时使用驱动默认值
+func (db *SysDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (r ISysDBTransContext, err error) {
+	t := &SysDBTransaction{stmts: db.stmts}
+	t.tx, err = db.db.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	t.bound = newTxStmts(t.tx)
+	return t, nil
+}
+
+//SetStmtCache 设置预编译语句缓存的容量,语句按最终SQL缓存,size小于等于0时关闭缓存
+func (db *SysDB) SetStmtCache(size int) {
+	db.stmts.resize(size)
+}
+
+//StmtCacheStats 获取预编译语句缓存的统计
+func (db *SysDB) StmtCacheStats() tpl.CacheStats {
+	return db.stmts.stats()
 }
 
-// Close 关闭数据库连接
+// Close 关闭数据库连接,同时关闭缓存的预编译语句
 func (db *SysDB) Close() error {
+	db.stmts.close()
 	return db.db.Close()
 }
@@ -1,15 +1,25 @@
 package db
 
-import "database/sql"
+import (
+	"context"
+	"database/sql"
+)
 
 //SysDBTransaction 事务
 type SysDBTransaction struct {
-	tx *sql.Tx
+	tx    *sql.Tx
+	stmts *stmtCache
+	bound *txStmts
 }
 
 //Query 执行查询
 func (t *SysDBTransaction) Query(query string, args ...interface{}) (dataRows []QRow, colus []string, err error) {
-	rows, err := t.tx.Query(query, args...)
+	return t.QueryContext(context.Background(), query, args...)
+}
+
+//QueryContext 执行查询,ctx取消或超时后中止查询
+func (t *SysDBTransaction) QueryContext(ctx context.Context, query string, args ...interface{}) (dataRows []QRow, colus []string, err error) {
+	rows, err := t.stmts.queryContext(ctx, t.bound, query, args...)
 	if err != nil {
 		return
 	}
@@ -18,9 +28,19 @@ func (t *SysDBTransaction) Query(query string, args ...interface{}) (dataRows []
 	return
 }
 
+//QueryRows 执行查询,返回原始结果集,调用方负责关闭
+func (t *SysDBTransaction) QueryRows(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return t.stmts.queryContext(ctx, t.bound, query, args...)
+}
+
 //Executes 执行SQL操作语句
 func (t *SysDBTransaction) Executes(query string, args ...interface{}) (lastInsertID, affectedRow int64, err error) {
-	result, err := t.tx.Exec(query, args...)
+	return t.ExecutesContext(context.Background(), query, args...)
+}
+
+//ExecutesContext 执行SQL操作语句,返回最后插入的ID和影响行数
+func (t *SysDBTransaction) ExecutesContext(ctx context.Context, query string, args ...interface{}) (lastInsertID, affectedRow int64, err error) {
+	result, err := t.stmts.execContext(ctx, t.bound, query, args...)
 	if err != nil {
 		return
 	}
@@ -34,7 +54,12 @@ func (t *SysDBTransaction) Executes(query string, args ...interface{}) (lastInse
 
 //Execute 执行SQL操作语句
 func (t *SysDBTransaction) Execute(query string, args ...interface{}) (affectedRow int64, err error) {
-	result, err := t.tx.Exec(query, args...)
+	return t.ExecuteContext(context.Background(), query, args...)
+}
+
+//ExecuteContext 执行SQL操作语句,返回影响行数
+func (t *SysDBTransaction) ExecuteContext(ctx context.Context, query string, args ...interface{}) (affectedRow int64, err error) {
+	result, err := t.stmts.execContext(ctx, t.bound, query, args...)
 	if err != nil {
 		return
 	}
@@ -2,140 +2,275 @@ package tpl
 
 import (
 	"fmt"
+	"reflect"
 	"regexp"
 	"strings"
 )
 
 func isNil(input interface{}) bool {
-	return input == nil || fmt.Sprintf("%v", input) == ""
+	if input == nil {
+		return true
+	}
+	if _, ok := input.([]byte); !ok {
+		if v := reflect.ValueOf(input); (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Len() == 0 {
+			return true
+		}
+	}
+	return fmt.Sprintf("%v", input) == ""
 }
 
-type tplCache struct {
-	sql    string
-	params []interface{}
-	names  []string
+var (
+	//&,|后可跟比较或LIKE运算符,并可用:指定参数名,如&>=create_time:start_time
+	wordReg     = regexp.MustCompile(`[\\]?(?:[&|](?:>=|<=|<>|>|<|%|\^)?\w?[\.]?\w+(?::\w+)?|[@|#|&|~|\||!|\$|\?]\w?[\.]?\w+)`)
+	escapeReg   = regexp.MustCompile(`[\\][@|#|&|~|\||!|\$|\?|>|<]`)
+	likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+	operators   = []string{">=", "<=", "<>", ">", "<", "%", "^"}
+)
+
+//segment 模板片段,pre为0时text为原样输出的文本,否则为表达式的参数名;block不为nil时为可选块
+type segment struct {
+	pre  byte
+	text string
+	name string
+	//op &,|表达式的比较或LIKE运算符
+	op    string
+	block *parsedTPL
 }
 
-//AnalyzeTPLFromCache 从缓存中获取已解析的SQL语句
-func AnalyzeTPLFromCache(name string, tpl string, input map[string]interface{}, prefix func() string) (sql string, params []interface{}) {
-	sql, params, _ = AnalyzeTPL(tpl, input, prefix)
-	return
-	/*key := fmt.Sprintf("%s_%s", name, tpl)
-	b, cache, _ := tplCaches.SetIfAbsentCb(key, func(i ...interface{}) (interface{}, error) {
-		sql, params, names := AnalyzeTPL(tpl, input, prefix)
-		return &tplCache{sql: sql, params: params, names: names}, nil
-	})
-	value := cache.(*tplCache)
-	if b {
-		return value.sql, value.params
+//parsedTPL 解析后的模板,与输入参数无关,可缓存复用
+type parsedTPL struct {
+	segments []segment
+}
+
+//parseTPL 将模板拆分为文本,表达式与可选块,可选块不支持嵌套,\{{原样输出{{
+func parseTPL(tpl string) *parsedTPL {
+	p := &parsedTPL{}
+	for tpl != "" {
+		i := strings.Index(tpl, "{{")
+		if i < 0 {
+			p.parse(tpl)
+			break
+		}
+		if i > 0 && tpl[i-1] == '\\' {
+			p.parse(tpl[:i-1])
+			p.segments = append(p.segments, segment{text: "{{"})
+			tpl = tpl[i+2:]
+			continue
+		}
+		j := strings.Index(tpl[i+2:], "}}")
+		if j < 0 {
+			p.parse(tpl)
+			break
+		}
+		p.parse(tpl[:i])
+		block := &parsedTPL{}
+		block.parse(tpl[i+2 : i+2+j])
+		p.segments = append(p.segments, segment{block: block})
+		tpl = tpl[i+4+j:]
+	}
+	return p
+}
+
+//parse 将文本拆分为原样输出的文本与表达式片段
+func (p *parsedTPL) parse(tpl string) {
+	last := 0
+	for _, loc := range wordReg.FindAllStringIndex(tpl, -1) {
+		key := tpl[loc[0]+1 : loc[1]]
+		switch pre := tpl[loc[0]]; pre {
+		case '@', '#', '$', '&', '|', '~':
+			p.literal(tpl[last:loc[0]])
+			s := segment{pre: pre}
+			for _, op := range operators {
+				if (pre == '&' || pre == '|') && strings.HasPrefix(key, op) {
+					s.op, key = op, key[len(op):]
+					break
+				}
+			}
+			s.text, s.name = key, key
+			if i := strings.Index(key, ":"); i > 0 {
+				s.text, s.name = key[:i], key[i+1:]
+			} else if strings.Index(key, ".") > 0 {
+				s.name = strings.Split(key, ".")[1]
+			}
+			p.segments = append(p.segments, s)
+			last = loc[1]
+		}
+		//转义的表达式及!,?原样保留
+	}
+	p.literal(tpl[last:])
+}
+
+func (p *parsedTPL) literal(s string) {
+	if s == "" {
+		return
 	}
-	params = make([]interface{}, 0, len(value.names))
-	for _, v := range value.names {
-		va := input[v]
-		if !isNil(va) {
-			params = append(params, va)
-		} else {
-			params = append(params, nil)
+	s = escapeReg.ReplaceAllStringFunc(s, func(s string) string {
+		return s[1:]
+	})
+	p.segments = append(p.segments, segment{text: s})
+}
+
+//empty 可选块中所有参数都为空,没有参数的块始终保留
+func (p *parsedTPL) empty(input map[string]interface{}) bool {
+	params := 0
+	for _, s := range p.segments {
+		if s.pre == 0 {
+			continue
+		}
+		params++
+		if !isNil(input[s.name]) {
+			return false
 		}
 	}
-	return value.sql, params*/
+	return params > 0
 }
 
-//AnalyzeTPL 解析模板内容，并返回解析后的SQL语句，入输入参数
-//@表达式，替换为参数化字符如: :1,:2,:3
-//#表达式，替换为指定值，值为空时返回NULL
-//~表达式，检查值，值为空时返加"",否则返回: , name=value
-//&条件表达式，检查值，值为空时返加"",否则返回: and name=value
-//|条件表达式，检查值，值为空时返回"", 否则返回: or name=value
-func AnalyzeTPL(tpl string, input map[string]interface{}, prefix func() string) (sql string, params []interface{}, names []string) {
-	params = make([]interface{}, 0)
-	names = make([]string, 0)
-	defer func() {
-		sql = strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(sql, "  ", " "), "where and ", "where "), "where or ", "where ")
-		sql = strings.ReplaceAll(strings.ReplaceAll(sql, "WHERE and ", "WHERE "), "WHERE or ", "WHERE ")
-	}()
-	word, _ := regexp.Compile(`[\\]?[@|#|&|~|\||!|\$|\?]\w?[\.]?\w+`)
-	//@变量, 将数据放入params中
-	sql = word.ReplaceAllStringFunc(tpl, func(s string) string {
-		fullKey := s[1:]
-		key := s[1:]
-		name := s[1:]
-		if strings.Index(fullKey, ".") > 0 {
-			name = strings.Split(fullKey, ".")[1]
+//renderer 生成SQL语句的状态
+type renderer struct {
+	input  map[string]interface{}
+	prefix func() string
+	l      *literalStyle
+	b      strings.Builder
+	params []interface{}
+	names  []string
+}
+
+//render 根据输入参数生成SQL语句及参数,#与$表达式的参数值按RawPolicy及l的写法拼接
+func (p *parsedTPL) render(input map[string]interface{}, prefix func() string, l *literalStyle) (sql string, params []interface{}, names []string) {
+	r := &renderer{input: input, prefix: prefix, l: l, params: make([]interface{}, 0), names: make([]string, 0)}
+	r.write(p)
+	sql = r.b.String()
+	sql = strings.ReplaceAll(strings.ReplaceAll(strings.ReplaceAll(sql, "  ", " "), "where and ", "where "), "where or ", "where ")
+	sql = strings.ReplaceAll(strings.ReplaceAll(sql, "WHERE and ", "WHERE "), "WHERE or ", "WHERE ")
+	return sql, r.params, r.names
+}
+
+func (r *renderer) write(p *parsedTPL) {
+	for _, s := range p.segments {
+		if s.block != nil {
+			if !s.block.empty(r.input) {
+				r.write(s.block)
+			}
+			continue
+		}
+		if s.pre == 0 {
+			r.b.WriteString(s.text)
+			continue
 		}
-		pre := s[:1]
-		value := input[name]
-		switch pre {
-		case "@":
+		value := r.input[s.name]
+		switch s.pre {
+		case '@':
+			if binds, ok := r.expand(s.text, value); ok {
+				r.b.WriteString(binds)
+				continue
+			}
 			if !isNil(value) {
-				names = append(names, key)
-				params = append(params, value)
+				r.bind(s.text, value)
 			} else {
-				names = append(names, key)
-				params = append(params, nil)
+				r.bind(s.text, nil)
 			}
-			return prefix()
-		case "#":
+		case '#':
 			if !isNil(value) {
-				return fmt.Sprintf("%v", value)
+				r.b.WriteString(r.l.raw(value))
+			} else {
+				r.b.WriteString("NULL")
 			}
-			return "NULL"
-		// case "?":
-		// 	if !isNil(value) {
-		// 		names = append(names, key)
-		// 		params = append(params, value)
-		// 		return fmt.Sprintf("and %s like '%%'||%s||'%%'", key, prefix())
-		// 	}
-		// 	return ""
-		// case ",":
-		// 	if !isNil(value) {
-		// 		names = append(names, key)
-		// 		params = append(params, value)
-		// 		return fmt.Sprintf("and %s > %s", key, prefix())
-		// 	}
-		// 	return ""
-		// case ".":
-		// 	if !isNil(value) {
-		// 		names = append(names, key)
-		// 		params = append(params, value)
-		// 		return fmt.Sprintf("and %s < %s", key, prefix())
-		// 	}
-		// 	return ""
-		case "$":
+		case '$':
 			if !isNil(value) {
-				return fmt.Sprintf("%v", value)
+				r.b.WriteString(r.l.raw(value))
 			}
-			return ""
-		case "&":
-			if !isNil(value) {
-				names = append(names, key)
-				params = append(params, value)
-				return fmt.Sprintf("and %s=%s", key, prefix())
+		case '&', '|', '~':
+			if isNil(value) {
+				continue
 			}
-			return ""
-		case "|":
-			if !isNil(value) {
-				names = append(names, key)
-				params = append(params, value)
-				return fmt.Sprintf("or %s=%s", key, prefix())
+			switch s.pre {
+			case '&':
+				r.b.WriteString("and ")
+			case '|':
+				r.b.WriteString("or ")
+			default:
+				r.b.WriteString(",")
 			}
-			return ""
-		case "~":
-			if !isNil(value) {
-				names = append(names, key)
-				params = append(params, value)
-				return fmt.Sprintf(",%s=%s", key, prefix())
+			r.condition(s, value)
+		}
+	}
+}
+
+//condition &,|,~表达式的条件,如name=:1,name like :1,name in (:1,:2)
+func (r *renderer) condition(s segment, value interface{}) {
+	switch s.op {
+	case "":
+		if s.pre != '~' {
+			if binds, ok := r.expand(s.text, value); ok {
+				fmt.Fprintf(&r.b, "%s in (%s)", s.text, binds)
+				return
 			}
-			return ""
-		default:
-			return s
 		}
-	})
+		fmt.Fprintf(&r.b, "%s=", s.text)
+		r.bind(s.text, value)
+	case "%", "^":
+		like := likeEscaper.Replace(fmt.Sprint(value)) + "%"
+		if s.op == "%" {
+			like = "%" + like
+		}
+		fmt.Fprintf(&r.b, "%s like ", s.text)
+		r.bind(s.text, like)
+		r.b.WriteString(r.l.like)
+	default:
+		fmt.Fprintf(&r.b, "%s%s", s.text, s.op)
+		r.bind(s.text, value)
+	}
+}
 
-	word2, _ := regexp.Compile(`[\\][@|#|&|~|\||!|\$|\?|>|<]`)
-	//@变量, 将数据放入params中
-	sql = word2.ReplaceAllStringFunc(sql, func(s string) string {
-		return s[1:]
-	})
+//bind 添加参数并输出占位符
+func (r *renderer) bind(name string, value interface{}) {
+	r.names = append(r.names, name)
+	r.params = append(r.params, value)
+	r.b.WriteString(r.prefix())
+}
+
+//expand slice与数组([]byte除外)展开为多个参数,返回以,分隔的占位符
+func (r *renderer) expand(name string, value interface{}) (string, bool) {
+	v := reflect.ValueOf(value)
+	if _, ok := value.([]byte); ok || (v.Kind() != reflect.Slice && v.Kind() != reflect.Array) || v.Len() == 0 {
+		return "", false
+	}
+	binds := make([]string, 0, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		r.names = append(r.names, name)
+		r.params = append(r.params, v.Index(i).Interface())
+		binds = append(binds, r.prefix())
+	}
+	return strings.Join(binds, ","), true
+}
+
+//AnalyzeTPLFromCache 从缓存中获取已解析的模板,根据输入参数生成SQL语句
+func AnalyzeTPLFromCache(name string, tpl string, input map[string]interface{}, prefix func() string) (sql string, params []interface{}) {
+	return analyzeFromCache(tpl, input, prefix, ansiLiteral)
+}
+
+func analyzeFromCache(tpl string, input map[string]interface{}, prefix func() string, l *literalStyle) (sql string, params []interface{}) {
+	p, ok := tplCaches.get(tpl)
+	if !ok {
+		p = parseTPL(tpl)
+		tplCaches.add(tpl, p)
+	}
+	sql, params, _ = p.render(input, prefix, l)
 	return
 }
+
+//AnalyzeTPL 解析模板内容，并返回解析后的SQL语句，入输入参数
+//@表达式，替换为参数化字符如: :1,:2,:3
+//#表达式，替换为指定值，值为空时返回NULL,拼接方式见SetRawPolicy
+//$表达式，替换为指定值，值为空时返回""
+//~表达式，检查值，值为空时返加"",否则返回: , name=value
+//&条件表达式，检查值，值为空时返加"",否则返回: and name=value
+//|条件表达式，检查值，值为空时返回"", 否则返回: or name=value
+//&,|后可跟运算符,如&>=age返回: and age>=value,支持>=,<=,<>,>,<
+//&%name返回: and name like '%value%',&^name返回: and name like 'value%',value中的%,_与\会被转义
+//&,|表达式的参数名默认与列名相同(t.name取name),也可用:指定,如&>=create_time:start_time
+//@,&,|表达式的值为slice时展开为多个参数,如@ids返回: :1,:2,&ids返回: and ids in (:1,:2)
+//{{...}}可选块，块中的参数全部为空时整块删除,不支持嵌套
+func AnalyzeTPL(tpl string, input map[string]interface{}, prefix func() string) (sql string, params []interface{}, names []string) {
+	return parseTPL(tpl).render(input, prefix, ansiLiteral)
+}
@@ -7,13 +7,27 @@ import (
 	"strings"
 )
 
-//ATTPLContext 参数化时使用@+参数名作为占位符的SQL数据库如:oracle,sql server
+//ATTPLContext 参数化时使用前缀+序号作为占位符的SQL数据库如:oracle(:1),postgres($1),sql server(@p1)
 type ATTPLContext struct {
 	name   string
 	prefix string
+	//sp 存储过程调用语句,为nil时使用begin ...;end;
+	sp func(query string) string
+	//literal 字面量的写法,为nil时使用ansiLiteral
+	literal *literalStyle
+}
+
+func (o ATTPLContext) style() *literalStyle {
+	if o.literal == nil {
+		return ansiLiteral
+	}
+	return o.literal
 }
 
 func (o ATTPLContext) getSPName(query string) string {
+	if o.sp != nil {
+		return o.sp(query)
+	}
 	return fmt.Sprintf("begin %s;end;", strings.Trim(strings.Trim(query, ";"), ","))
 }
 
@@ -24,7 +38,7 @@ func (o ATTPLContext) GetSQLContext(tpl string, input map[string]interface{}) (s
 		index++
 		return fmt.Sprint(o.prefix, index)
 	}
-	return AnalyzeTPLFromCache(o.name, tpl, input, f)
+	return analyzeFromCache(tpl, input, f, o.style())
 }
 
 //GetSPContext 获取
@@ -39,20 +53,15 @@ func (o ATTPLContext) Replace(sql string, args []interface{}) (r string) {
 	if sql == "" || args == nil {
 		return sql
 	}
-	word, _ := regexp.Compile(fmt.Sprintf(`%s\d+([,|\) ;]|$)`, o.prefix))
+	l := o.style()
+	word, _ := regexp.Compile(fmt.Sprintf(`%s(\d+)([,|\) ;]|$)`, regexp.QuoteMeta(o.prefix)))
 	sql = word.ReplaceAllStringFunc(sql, func(s string) string {
-		c := len(s)
-		num := s[1 : c-1]
-		// 处理匹配到结尾
-		if num == "" {
-			num = s[1:c]
-			c++
-		}
-		k, err := strconv.Atoi(num)
-		if err != nil || len(args) < k {
-			return "NULL" + s[c-1:]
+		m := word.FindStringSubmatch(s)
+		k, err := strconv.Atoi(m[1])
+		if err != nil || k < 1 || len(args) < k {
+			return "NULL" + m[2]
 		}
-		return fmt.Sprintf("'%v'%s", args[k-1], s[c-1:])
+		return l.render(args[k-1]) + m[2]
 	})
 	/*end*/
 	return sql
@@ -0,0 +1,94 @@
+package tpl
+
+import (
+	"container/list"
+	"sync"
+)
+
+//DefaultCacheSize 默认缓存的模板数量
+const DefaultCacheSize = 1024
+
+//CacheStats 缓存统计
+type CacheStats struct {
+	Hits     uint64
+	Misses   uint64
+	Size     int
+	Capacity int
+}
+
+//lruCache 按最近使用淘汰的模板缓存
+type lruCache struct {
+	l        sync.Mutex
+	capacity int
+	ll       *list.List
+	items    map[string]*list.Element
+	hits     uint64
+	misses   uint64
+}
+
+type lruEntry struct {
+	key   string
+	value *parsedTPL
+}
+
+func newLRUCache(capacity int) *lruCache {
+	return &lruCache{capacity: capacity, ll: list.New(), items: map[string]*list.Element{}}
+}
+
+func (c *lruCache) get(key string) (*parsedTPL, bool) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if e, ok := c.items[key]; ok {
+		c.hits++
+		c.ll.MoveToFront(e)
+		return e.Value.(*lruEntry).value, true
+	}
+	c.misses++
+	return nil, false
+}
+
+func (c *lruCache) add(key string, value *parsedTPL) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.capacity <= 0 {
+		return
+	}
+	if e, ok := c.items[key]; ok {
+		c.ll.MoveToFront(e)
+		e.Value.(*lruEntry).value = value
+		return
+	}
+	c.items[key] = c.ll.PushFront(&lruEntry{key: key, value: value})
+	c.trim()
+}
+
+func (c *lruCache) resize(capacity int) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.capacity = capacity
+	c.trim()
+}
+
+func (c *lruCache) trim() {
+	for c.ll.Len() > c.capacity && c.ll.Len() > 0 {
+		e := c.ll.Back()
+		c.ll.Remove(e)
+		delete(c.items, e.Value.(*lruEntry).key)
+	}
+}
+
+func (c *lruCache) stats() CacheStats {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return CacheStats{Hits: c.hits, Misses: c.misses, Size: c.ll.Len(), Capacity: c.capacity}
+}
+
+//SetCacheSize 设置模板解析缓存的容量,小于等于0时不缓存
+func SetCacheSize(size int) {
+	tplCaches.resize(size)
+}
+
+//GetCacheStats 获取模板解析缓存的统计
+func GetCacheStats() CacheStats {
+	return tplCaches.stats()
+}
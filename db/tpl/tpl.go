@@ -3,8 +3,6 @@ package tpl
 import (
 	"fmt"
 	"strings"
-
-	cmap "github.com/champly/lib4go/concurrent"
 )
 
 const (
@@ -14,8 +12,8 @@ const (
 )
 
 var (
-	tpls      map[string]ITPLContext
-	tplCaches cmap.ConcurrentMap
+	dialects  map[string]Dialect
+	tplCaches *lruCache
 )
 
 //ITPLContext 模板上下文
@@ -25,27 +23,77 @@ type ITPLContext interface {
 	Replace(sql string, args []interface{}) (r string)
 }
 
+//Dialect 数据库类型,Driver为database/sql中注册的驱动名称
+type Dialect struct {
+	Name    string
+	Driver  string
+	Context ITPLContext
+}
+
 func init() {
-	tpls = make(map[string]ITPLContext)
-	tplCaches = cmap.New(8)
+	dialects = make(map[string]Dialect)
+	tplCaches = newLRUCache(DefaultCacheSize)
 
-	Register("oracle", ATTPLContext{name: "oracle", prefix: ":"})
-	Register("ora", ATTPLContext{name: "ora", prefix: ":"})
-	Register("mysql", MTPLContext{name: "mysql", prefix: "?"})
-	Register("sqlite", MTPLContext{name: "sqlite", prefix: "?"})
-	Register("postgres", ATTPLContext{name: "postgres", prefix: "$"})
+	RegisterDialect("oracle", "oci8", ATTPLContext{name: "oracle", prefix: ":", literal: oracleLiteral})
+	RegisterDialect("ora", "oci8", ATTPLContext{name: "ora", prefix: ":", literal: oracleLiteral})
+	RegisterDialect("dm", "dm", ATTPLContext{name: "dm", prefix: ":", literal: oracleLiteral})
+	RegisterDialect("mysql", "mysql", MTPLContext{name: "mysql", prefix: "?", sp: callSP("call"), literal: mysqlLiteral})
+	RegisterDialect("sqlite", "sqlite3", MTPLContext{name: "sqlite", prefix: "?"})
+	RegisterDialect("clickhouse", "clickhouse", MTPLContext{name: "clickhouse", prefix: "?", literal: clickhouseLiteral})
+	RegisterDialect("postgres", "postgres", ATTPLContext{name: "postgres", prefix: "$", sp: callSP("call"), literal: postgresLiteral})
+	RegisterDialect("sqlserver", "sqlserver", ATTPLContext{name: "sqlserver", prefix: "@p", sp: execSP, literal: sqlserverLiteral})
 }
+
+//Register 注册模板上下文,驱动名称与name相同
 func Register(name string, tpl ITPLContext) {
-	if _, ok := tpls[name]; ok {
+	RegisterDialect(name, name, tpl)
+}
+
+//RegisterDialect 注册数据库类型的驱动名称与模板上下文,名称不区分大小写
+func RegisterDialect(name string, driver string, tpl ITPLContext) {
+	name = strings.ToLower(name)
+	if _, ok := dialects[name]; ok {
 		panic("重复的注册:" + name)
 	}
-	tpls[name] = tpl
+	dialects[name] = Dialect{Name: name, Driver: driver, Context: tpl}
+}
+
+//GetDialect 获取数据库类型
+func GetDialect(name string) (Dialect, error) {
+	if v, ok := dialects[strings.ToLower(name)]; ok {
+		return v, nil
+	}
+	return Dialect{}, fmt.Errorf("不支持的数据库类型:%s", name)
 }
 
 //GetDBContext 获取数据库上下文操作
 func GetDBContext(name string) (ITPLContext, error) {
-	if v, ok := tpls[strings.ToLower(name)]; ok {
-		return v, nil
+	d, err := GetDialect(name)
+	if err != nil {
+		return nil, err
+	}
+	return d.Context, nil
+}
+
+//callSP 存储过程以keyword调用,如call proc(?,?),已包含keyword时原样返回
+func callSP(keyword string) func(query string) string {
+	return func(query string) string {
+		query = strings.Trim(strings.TrimSpace(query), ";,")
+		if len(query) > len(keyword) && strings.EqualFold(query[:len(keyword)+1], keyword+" ") {
+			return query
+		}
+		return keyword + " " + query
+	}
+}
+
+//execSP sql server存储过程,proc(@p1,@p2)转换为exec proc @p1,@p2
+func execSP(query string) string {
+	query = strings.Trim(strings.TrimSpace(query), ";,")
+	if len(query) > 5 && strings.EqualFold(query[:5], "exec ") {
+		return query
+	}
+	if i := strings.Index(query, "("); i > 0 && strings.HasSuffix(query, ")") {
+		query = strings.TrimSpace(query[:i]) + " " + query[i+1:len(query)-1]
 	}
-	return nil, fmt.Errorf("不支持的数据库类型:%s", name)
+	return "exec " + strings.TrimSpace(query)
 }
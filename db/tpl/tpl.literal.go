@@ -0,0 +1,221 @@
+package tpl
+
+import (
+	"database/sql/driver"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//literalStyle 数据库字面量与标识符的写法
+type literalStyle struct {
+	//backslash 字符串中的反斜杠为转义符
+	backslash bool
+	//boolean true与false的写法
+	boolean [2]string
+	time    func(t time.Time) string
+	bytes   func(b []byte) string
+	//ident 为标识符加引号,如"name",`name`,[name]
+	ident func(s string) string
+	//like LIKE的转义子句,数据库默认以\为转义符时为空
+	like string
+}
+
+var (
+	//ansiLiteral 未指定写法的模板上下文使用
+	ansiLiteral = &literalStyle{
+		boolean: [2]string{"1", "0"},
+		time:    quotedTime("2006-01-02 15:04:05.999999"),
+		bytes:   func(b []byte) string { return "X'" + hex.EncodeToString(b) + "'" },
+		ident:   quoteIdent(`"`, `"`),
+		like:    ` escape '\'`,
+	}
+	mysqlLiteral = &literalStyle{
+		backslash: true,
+		boolean:   [2]string{"TRUE", "FALSE"},
+		time:      quotedTime("2006-01-02 15:04:05.999999"),
+		bytes:     func(b []byte) string { return "X'" + hex.EncodeToString(b) + "'" },
+		ident:     quoteIdent("`", "`"),
+	}
+	postgresLiteral = &literalStyle{
+		boolean: [2]string{"TRUE", "FALSE"},
+		time:    quotedTime("2006-01-02 15:04:05.999999-07:00"),
+		bytes:   func(b []byte) string { return `'\x` + hex.EncodeToString(b) + "'::bytea" },
+		ident:   quoteIdent(`"`, `"`),
+	}
+	oracleLiteral = &literalStyle{
+		boolean: [2]string{"1", "0"},
+		time: func(t time.Time) string {
+			return "TIMESTAMP '" + t.Format("2006-01-02 15:04:05.999999999") + "'"
+		},
+		bytes: func(b []byte) string { return "HEXTORAW('" + hex.EncodeToString(b) + "')" },
+		ident: quoteIdent(`"`, `"`),
+		like:  ` escape '\'`,
+	}
+	sqlserverLiteral = &literalStyle{
+		boolean: [2]string{"1", "0"},
+		//ISO8601格式不受DATEFORMAT设置影响
+		time:  quotedTime("2006-01-02T15:04:05.999"),
+		bytes: func(b []byte) string { return "0x" + hex.EncodeToString(b) },
+		ident: quoteIdent("[", "]"),
+		like:  ` escape '\'`,
+	}
+	clickhouseLiteral = &literalStyle{
+		backslash: true,
+		boolean:   [2]string{"true", "false"},
+		time:      quotedTime("2006-01-02 15:04:05.999999"),
+		bytes:     func(b []byte) string { return "unhex('" + hex.EncodeToString(b) + "')" },
+		ident:     quoteIdent("`", "`"),
+	}
+)
+
+func quotedTime(layout string) func(t time.Time) string {
+	return func(t time.Time) string {
+		return "'" + t.Format(layout) + "'"
+	}
+}
+
+//quoteIdent 按.分隔后分别加引号,如a.b转换为"a"."b"
+func quoteIdent(open string, close string) func(s string) string {
+	escape := strings.NewReplacer(close, close+close)
+	return func(s string) string {
+		parts := strings.Split(s, ".")
+		for i, p := range parts {
+			parts[i] = open + escape.Replace(p) + close
+		}
+		return strings.Join(parts, ".")
+	}
+}
+
+//render 将值转换为SQL字面量:nil为NULL,数字与布尔值不加引号,时间与[]byte按数据库格式,其它值作为转义后的字符串
+func (l *literalStyle) render(v interface{}) string {
+	if v == nil {
+		return "NULL"
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		return "NULL"
+	}
+	if vr, ok := v.(driver.Valuer); ok {
+		dv, err := vr.Value()
+		if err != nil || dv == nil {
+			return "NULL"
+		}
+		if _, ok := dv.(driver.Valuer); !ok {
+			return l.render(dv)
+		}
+	}
+
+	switch x := v.(type) {
+	case time.Time:
+		return l.time(x)
+	case []byte:
+		return l.bytes(x)
+	}
+	switch rv.Kind() {
+	case reflect.Ptr:
+		return l.render(rv.Elem().Interface())
+	case reflect.Bool:
+		if rv.Bool() {
+			return l.boolean[0]
+		}
+		return l.boolean[1]
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(rv.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(rv.Uint(), 10)
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsNaN(f) || math.IsInf(f, 0) {
+			//NaN与Inf没有数字字面量
+			return l.quote(fmt.Sprint(f))
+		}
+		return strconv.FormatFloat(f, 'f', -1, rv.Type().Bits())
+	case reflect.String:
+		return l.quote(rv.String())
+	}
+	return l.quote(fmt.Sprint(v))
+}
+
+//quote 字符串字面量,单引号转义为两个单引号
+func (l *literalStyle) quote(s string) string {
+	if l.backslash {
+		s = strings.ReplaceAll(s, `\`, `\\`)
+	}
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
+
+//RawMode #与$表达式拼接参数值的方式
+type RawMode int
+
+const (
+	//RawUnsafe 原样拼接,与之前的版本一致,参数值来自外部输入时存在注入风险
+	RawUnsafe RawMode = iota
+	//RawLiteral 按字面量拼接,字符串加引号并转义
+	RawLiteral
+	//RawIdentifier 由字母,数字,下划线组成(可用.分隔)的标识符原样拼接,其它值按字面量拼接
+	RawIdentifier
+	//RawQuoteIdentifier 标识符按数据库规则加引号后拼接,如mysql的`name`,sql server的[name],其它值按字面量拼接
+	RawQuoteIdentifier
+)
+
+//RawPolicy #与$表达式的拼接规则
+type RawPolicy struct {
+	Mode RawMode
+	//Allow 始终原样拼接的值,如"create_time desc","count(*)"
+	Allow []string
+}
+
+var (
+	identReg  = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+	rawLock   sync.RWMutex
+	rawPolicy RawPolicy
+	rawAllow  map[string]bool
+)
+
+//SetRawPolicy 设置#与$表达式的拼接规则,默认为RawUnsafe
+func SetRawPolicy(policy RawPolicy) {
+	allow := make(map[string]bool, len(policy.Allow))
+	for _, v := range policy.Allow {
+		allow[v] = true
+	}
+	policy.Allow = append([]string{}, policy.Allow...)
+
+	rawLock.Lock()
+	defer rawLock.Unlock()
+	rawPolicy, rawAllow = policy, allow
+}
+
+//GetRawPolicy 获取#与$表达式的拼接规则
+func GetRawPolicy() RawPolicy {
+	rawLock.RLock()
+	defer rawLock.RUnlock()
+	return rawPolicy
+}
+
+//raw 按拼接规则转换#与$表达式的参数值
+func (l *literalStyle) raw(v interface{}) string {
+	rawLock.RLock()
+	mode, allow := rawPolicy.Mode, rawAllow
+	rawLock.RUnlock()
+
+	s := fmt.Sprint(v)
+	if mode == RawUnsafe || allow[s] {
+		return s
+	}
+	if _, ok := v.(string); ok && identReg.MatchString(s) {
+		switch mode {
+		case RawIdentifier:
+			return s
+		case RawQuoteIdentifier:
+			return l.ident(s)
+		}
+	}
+	return l.render(v)
+}
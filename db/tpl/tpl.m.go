@@ -6,10 +6,21 @@ import (
 	"strings"
 )
 
-//MTPLContext  SQLite模板
+//MTPLContext  使用?作为占位符的SQL数据库如:mysql,sqlite,clickhouse
 type MTPLContext struct {
 	name   string
 	prefix string
+	//sp 存储过程调用语句,为nil时原样返回
+	sp func(query string) string
+	//literal 字面量的写法,为nil时使用ansiLiteral
+	literal *literalStyle
+}
+
+func (o MTPLContext) style() *literalStyle {
+	if o.literal == nil {
+		return ansiLiteral
+	}
+	return o.literal
 }
 
 //GetSQLContext 获取查询串
@@ -17,12 +28,16 @@ func (o MTPLContext) GetSQLContext(tpl string, input map[string]interface{}) (qu
 	f := func() string {
 		return o.prefix
 	}
-	return AnalyzeTPLFromCache(o.name, tpl, input, f)
+	return analyzeFromCache(tpl, input, f, o.style())
 }
 
 //GetSPContext 获取存储过程
 func (o MTPLContext) GetSPContext(tpl string, input map[string]interface{}) (query string, args []interface{}) {
-	return o.GetSQLContext(tpl, input)
+	query, args = o.GetSQLContext(tpl, input)
+	if o.sp != nil {
+		query = o.sp(query)
+	}
+	return
 }
 
 //Replace 替换SQL中的占位符
@@ -31,13 +46,14 @@ func (o MTPLContext) Replace(sql string, args []interface{}) (r string) {
 		return sql
 	}
 	word, _ := regexp.Compile(fmt.Sprintf(`\%s([,|\ ;)]|$)`, o.prefix))
+	l := o.style()
 	index := -1
 	sql = word.ReplaceAllStringFunc(sql, func(s string) string {
 		index++
 		if index >= len(args) {
 			return "NULL" + s[1:]
 		}
-		return fmt.Sprintf("'%v'%s", args[index], s[1:])
+		return l.render(args[index]) + s[1:]
 	})
 	return sql
 }
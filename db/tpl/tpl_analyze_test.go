@@ -1,6 +1,12 @@
 package tpl
 
-import "testing"
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
 
 //go test -coverprofile=cover.out github.com/zzkkff/lib4go/db/tpl
 // cover -func=cover.out
@@ -96,3 +102,80 @@ func TestAnalyzeTPL(t *testing.T) {
 	/*end*/
 
 }
+
+func TestAnalyzeTPLOperators(t *testing.T) {
+	input := map[string]interface{}{
+		"name":  "colin",
+		"age":   18,
+		"start": "2024-01-01",
+		"end":   "",
+		"key":   `50%_off\`,
+		"ids":   []int{1, 2, 3},
+		"empty": []string{},
+	}
+	//期望结果中的?按数据库替换为对应的占位符,{esc}替换为LIKE的转义子句
+	cases := []struct {
+		tpl    string
+		except string
+		params string
+	}{
+		//比较运算符
+		{`where 1=1 &>age`, `where 1=1 and age>?`, `[18]`},
+		{`where &>=age &<=age`, `where age>=? and age<=?`, `[18 18]`},
+		{`where &<age |<>age &>sex`, `where age<? or age<>? `, `[18 18]`},
+		{`where &>=t.age`, `where t.age>=?`, `[18]`},
+		//:指定参数名,用于范围查询
+		{`where &>=create_time:start &<create_time:end`, `where create_time>=? `, `[2024-01-01]`},
+		//LIKE,参数值中的%,_,\被转义
+		{`where &%name`, `where name like ?{esc}`, `[%colin%]`},
+		{`where 1=1 |^t.name`, `where 1=1 or t.name like ?{esc}`, `[colin%]`},
+		{`where &%key &%sex`, `where key like ?{esc} `, `[%50\%\_off\\%]`},
+		//slice展开为IN列表
+		{`where id in (@ids)`, `where id in (?,?,?)`, `[1 2 3]`},
+		{`where 1=1 &ids |id:ids`, `where 1=1 and ids in (?,?,?) or id in (?,?,?)`, `[1 2 3 1 2 3]`},
+		{`where id in (@empty) &empty`, `where id in (?) `, `[<nil>]`},
+		//可选块,块中参数全部为空时删除
+		{`where 1=1 {{and name=@name}}{{and sex=@sex}}`, `where 1=1 and name=?`, `[colin]`},
+		{`where {{age between @start and @end}}`, `where age between ? and ?`, `[2024-01-01 <nil>]`},
+		{`select * from t {{order by $sort}}`, `select * from t `, `[]`},
+		{`where 1=1 {{and id in (@ids)}} {{and id in (@empty)}}`, `where 1=1 and id in (?,?,?) `, `[1 2 3]`},
+		{`where {{1=1}}`, `where 1=1`, `[]`},
+		//转义与未闭合的块原样输出
+		{`where \{{name}} \&>age \&%name`, `where {{name}} &>age &%name`, `[]`},
+		{`where {{name=@name`, `where {{name=?`, `[colin]`},
+	}
+	escapes := map[string]string{
+		"oracle":     ` escape '\'`,
+		"ora":        ` escape '\'`,
+		"dm":         ` escape '\'`,
+		"sqlite":     ` escape '\'`,
+		"sqlserver":  ` escape '\'`,
+		"mysql":      ``,
+		"clickhouse": ``,
+		"postgres":   ``,
+	}
+	for name, escape := range escapes {
+		ctx, err := GetDBContext(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//由第一个占位符推断占位符格式,如:1,$1,@p1,?
+		first, _ := ctx.GetSQLContext("@name", input)
+		prefix, numbered := strings.CutSuffix(first, "1")
+		for _, c := range cases {
+			index := 0
+			except := strings.ReplaceAll(c.except, "{esc}", escape)
+			except = regexp.MustCompile(`\?`).ReplaceAllStringFunc(except, func(string) string {
+				index++
+				if numbered {
+					return prefix + strconv.Itoa(index)
+				}
+				return prefix
+			})
+			actual, params := ctx.GetSQLContext(c.tpl, input)
+			if actual != except || fmt.Sprint(params) != c.params {
+				t.Errorf("%s %s:\nexcept:%s %s\nactual:%s %v", name, c.tpl, except, c.params, actual, params)
+			}
+		}
+	}
+}
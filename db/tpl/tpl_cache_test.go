@@ -0,0 +1,69 @@
+package tpl
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAnalyzeTPLFromCache(t *testing.T) {
+	f := func() string {
+		return "?"
+	}
+	tpl := "select * from t where id=@id &name |sex $order"
+
+	before := GetCacheStats()
+	cases := []struct {
+		input  map[string]interface{}
+		except string
+		params int
+	}{
+		{map[string]interface{}{"id": 1}, "select * from t where id=?  ", 1},
+		{map[string]interface{}{"id": 1, "name": "a", "order": "order by id"}, "select * from t where id=? and name=? order by id", 2},
+		{map[string]interface{}{"sex": 1}, "select * from t where id=? or sex=? ", 2},
+	}
+	for _, c := range cases {
+		sql, params := AnalyzeTPLFromCache("mysql", tpl, c.input, f)
+		if sql != c.except || len(params) != c.params {
+			t.Errorf("except %q %d actual %q %v", c.except, c.params, sql, params)
+		}
+		// the cached template renders the same as a fresh parse
+		fresh, freshParams, _ := AnalyzeTPL(tpl, c.input, f)
+		if sql != fresh || len(params) != len(freshParams) {
+			t.Errorf("cached %q fresh %q", sql, fresh)
+		}
+	}
+
+	after := GetCacheStats()
+	if after.Misses-before.Misses != 1 || after.Hits-before.Hits != 2 {
+		t.Errorf("template should be parsed once, before %+v after %+v", before, after)
+	}
+}
+
+func TestCacheSize(t *testing.T) {
+	defer SetCacheSize(DefaultCacheSize)
+	SetCacheSize(2)
+
+	f := func() string {
+		return "?"
+	}
+	for i := 0; i < 5; i++ {
+		AnalyzeTPLFromCache("mysql", fmt.Sprintf("select %d from t where id=@id", i), nil, f)
+	}
+	if s := GetCacheStats(); s.Size != 2 || s.Capacity != 2 {
+		t.Errorf("cache should keep 2 templates %+v", s)
+	}
+
+	// the most recent templates are kept
+	before := GetCacheStats()
+	AnalyzeTPLFromCache("mysql", "select 4 from t where id=@id", nil, f)
+	AnalyzeTPLFromCache("mysql", "select 0 from t where id=@id", nil, f)
+	after := GetCacheStats()
+	if after.Hits-before.Hits != 1 || after.Misses-before.Misses != 1 {
+		t.Errorf("unexpected lru %+v %+v", before, after)
+	}
+
+	SetCacheSize(0)
+	if s := GetCacheStats(); s.Size != 0 {
+		t.Errorf("cache should be empty %+v", s)
+	}
+}
@@ -0,0 +1,92 @@
+package tpl
+
+import "testing"
+
+func TestGetDialect(t *testing.T) {
+	drivers := map[string]string{
+		"oracle":     "oci8",
+		"ORA":        "oci8",
+		"dm":         "dm",
+		"mysql":      "mysql",
+		"sqlite":     "sqlite3",
+		"clickhouse": "clickhouse",
+		"postgres":   "postgres",
+		"SqlServer":  "sqlserver",
+	}
+	for name, driver := range drivers {
+		d, err := GetDialect(name)
+		if err != nil || d.Driver != driver || d.Context == nil {
+			t.Errorf("%s: expect driver %s, actual %+v %v", name, driver, d, err)
+		}
+	}
+	if _, err := GetDialect("db2"); err == nil {
+		t.Error("unknown dialect should return error")
+	}
+}
+
+func TestDialectSQLContext(t *testing.T) {
+	input := map[string]interface{}{"id": 1, "name": "colin"}
+	cases := map[string][2]string{
+		"sqlserver":  {"where id=@p1 and name=@p2", "exec order_create @p1,@p2"},
+		"clickhouse": {"where id=? and name=?", "order_create(?,?);"},
+		"dm":         {"where id=:1 and name=:2", "begin order_create(:1,:2);end;"},
+		"postgres":   {"where id=$1 and name=$2", "call order_create($1,$2)"},
+		"mysql":      {"where id=? and name=?", "call order_create(?,?)"},
+	}
+	for name, except := range cases {
+		ctx, _ := GetDBContext(name)
+		query, args := ctx.GetSQLContext("where id=@id and name=@name", input)
+		if query != except[0] || len(args) != 2 || args[1] != "colin" {
+			t.Errorf("%s GetSQLContext: %s", name, query)
+		}
+		query, args = ctx.GetSPContext("order_create(@id,@name);", input)
+		if query != except[1] || len(args) != 2 {
+			t.Errorf("%s GetSPContext: %s", name, query)
+		}
+	}
+
+	ctx, _ := GetDBContext("mysql")
+	if query, _ := ctx.GetSPContext("CALL order_create(@id)", input); query != "CALL order_create(?)" {
+		t.Errorf("call should not be added twice: %s", query)
+	}
+	ctx, _ = GetDBContext("sqlserver")
+	if query, _ := ctx.GetSPContext("order_create", input); query != "exec order_create" {
+		t.Errorf("procedure without arguments: %s", query)
+	}
+}
+
+func TestDialectReplace(t *testing.T) {
+	args := []interface{}{"a", "b"}
+	cases := map[string][2]string{
+		"sqlserver":  {"where id=@p1 and name=@p2 and x=@p12", "where id='a' and name='b' and x=NULL"},
+		"postgres":   {"where id=$1 and name=$2 and x=$3", "where id='a' and name='b' and x=NULL"},
+		"oracle":     {"where id=:1 and name=:2", "where id='a' and name='b'"},
+		"mysql":      {"where id=? and name=? and x=?", "where id='a' and name='b' and x=NULL"},
+		"clickhouse": {"where id=? and name=?", "where id='a' and name='b'"},
+		"sqlite":     {"where id=? and name=?", "where id='a' and name='b'"},
+	}
+	for name, c := range cases {
+		ctx, _ := GetDBContext(name)
+		if actual := ctx.Replace(c[0], args); actual != c[1] {
+			t.Errorf("%s Replace:\nexpect %s\nactual %s", name, c[1], actual)
+		}
+	}
+}
+
+func TestDialectReplaceLiteral(t *testing.T) {
+	args := []interface{}{1, `it's \n`, nil}
+	cases := map[string][2]string{
+		"sqlserver":  {"where id=@p1 and name=@p2 and code=@p3 and x=@p12", `where id=1 and name='it''s \n' and code=NULL and x=NULL`},
+		"postgres":   {"where id=$1 and name=$2", `where id=1 and name='it''s \n'`},
+		"oracle":     {"where id=:1 and name=:2", `where id=1 and name='it''s \n'`},
+		"mysql":      {"where id=? and name=? and code=?", `where id=1 and name='it''s \\n' and code=NULL`},
+		"clickhouse": {"where id=? and name=?", `where id=1 and name='it''s \\n'`},
+		"sqlite":     {"where id=? and name=?", `where id=1 and name='it''s \n'`},
+	}
+	for name, c := range cases {
+		ctx, _ := GetDBContext(name)
+		if actual := ctx.Replace(c[0], args); actual != c[1] {
+			t.Errorf("%s Replace:\nexpect %s\nactual %s", name, c[1], actual)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package tpl
+
+import (
+	"database/sql"
+	"math"
+	"testing"
+	"time"
+)
+
+type status int
+
+func TestLiteralRender(t *testing.T) {
+	at := time.Date(2024, 1, 2, 3, 4, 5, 600000000, time.UTC)
+	name := "colin"
+	var none *string
+	cases := []struct {
+		l      *literalStyle
+		v      interface{}
+		except string
+	}{
+		{ansiLiteral, nil, "NULL"},
+		{ansiLiteral, none, "NULL"},
+		{ansiLiteral, &name, "'colin'"},
+		{ansiLiteral, "it's", "'it''s'"},
+		{ansiLiteral, `a\b`, `'a\b'`},
+		{mysqlLiteral, `a\'b`, `'a\\''b'`},
+		{ansiLiteral, -12, "-12"},
+		{ansiLiteral, uint8(7), "7"},
+		{ansiLiteral, status(2), "2"},
+		{ansiLiteral, 1.5, "1.5"},
+		{ansiLiteral, float32(0.1), "0.1"},
+		{ansiLiteral, math.NaN(), "'NaN'"},
+		{ansiLiteral, true, "1"},
+		{postgresLiteral, false, "FALSE"},
+		{clickhouseLiteral, true, "true"},
+		{ansiLiteral, []byte{0xab, 0x01}, "X'ab01'"},
+		{postgresLiteral, []byte{0xab}, `'\xab'::bytea`},
+		{oracleLiteral, []byte{0xab}, "HEXTORAW('ab')"},
+		{sqlserverLiteral, []byte{0xab}, "0xab"},
+		{mysqlLiteral, at, "'2024-01-02 03:04:05.6'"},
+		{postgresLiteral, at, "'2024-01-02 03:04:05.6+00:00'"},
+		{oracleLiteral, at, "TIMESTAMP '2024-01-02 03:04:05.6'"},
+		{sqlserverLiteral, at, "'2024-01-02T03:04:05.6'"},
+		{ansiLiteral, sql.NullString{}, "NULL"},
+		{ansiLiteral, sql.NullInt64{Int64: 3, Valid: true}, "3"},
+	}
+	for _, c := range cases {
+		if actual := c.l.render(c.v); actual != c.except {
+			t.Errorf("%#v: expect %s, actual %s", c.v, c.except, actual)
+		}
+	}
+}
+
+func TestRawPolicy(t *testing.T) {
+	defer SetRawPolicy(RawPolicy{})
+	ctx, _ := GetDBContext("mysql")
+	input := map[string]interface{}{
+		"table": "t_order",
+		"order": "create_time desc",
+		"bad":   "1;drop table t_order",
+		"id":    10,
+	}
+	tpl := "select * from #table where id=#id and name=#bad order by $order"
+
+	query, _ := ctx.GetSQLContext(tpl, input)
+	if query != "select * from t_order where id=10 and name=1;drop table t_order order by create_time desc" {
+		t.Errorf("RawUnsafe should keep values as is: %s", query)
+	}
+
+	SetRawPolicy(RawPolicy{Mode: RawLiteral})
+	if query, _ = ctx.GetSQLContext(tpl, input); query != "select * from 't_order' where id=10 and name='1;drop table t_order' order by 'create_time desc'" {
+		t.Errorf("RawLiteral: %s", query)
+	}
+
+	SetRawPolicy(RawPolicy{Mode: RawIdentifier, Allow: []string{"create_time desc"}})
+	if query, _ = ctx.GetSQLContext(tpl, input); query != "select * from t_order where id=10 and name='1;drop table t_order' order by create_time desc" {
+		t.Errorf("RawIdentifier: %s", query)
+	}
+
+	SetRawPolicy(RawPolicy{Mode: RawQuoteIdentifier})
+	if query, _ = ctx.GetSQLContext(tpl, input); query != "select * from `t_order` where id=10 and name='1;drop table t_order' order by 'create_time desc'" {
+		t.Errorf("RawQuoteIdentifier: %s", query)
+	}
+	ctx, _ = GetDBContext("sqlserver")
+	if query, _ = ctx.GetSQLContext("select * from #table", map[string]interface{}{"table": "dbo.t_order"}); query != "select * from [dbo].[t_order]" {
+		t.Errorf("RawQuoteIdentifier: %s", query)
+	}
+	if p := GetRawPolicy(); p.Mode != RawQuoteIdentifier {
+		t.Errorf("GetRawPolicy: %+v", p)
+	}
+}
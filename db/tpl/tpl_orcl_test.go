@@ -206,7 +206,7 @@ func TestORCTPLReplace(t *testing.T) {
 	input = append(input, "colin")
 
 	tpl = "begin order_create(:1,:2,:3);end;"
-	except = "begin order_create('1','colin',NULL);end;"
+	except = "begin order_create(1,'colin',NULL);end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
@@ -221,7 +221,7 @@ func TestORCTPLReplace(t *testing.T) {
 
 	/*add by champly 2016年11月9日14:23:20*/
 	tpl = "begin name=:1  where id=:2;end;"
-	except = "begin name='1'  where id='colin';end;"
+	except = "begin name=1  where id='colin';end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
@@ -242,7 +242,7 @@ func TestORCTPLReplace(t *testing.T) {
 	}
 
 	tpl = "begin name=:1  where id=:2|;end;"
-	except = "begin name='1'  where id='colin'|;end;"
+	except = "begin name=1  where id='colin'|;end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
@@ -264,7 +264,7 @@ func TestORCTPLReplace(t *testing.T) {
 	}
 
 	tpl = "begin name=:1  where id=:2  "
-	except = "begin name='1'  where id='colin'  "
+	except = "begin name=1  where id='colin'  "
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
@@ -166,14 +166,14 @@ func TestSqliteTPLReplace(t *testing.T) {
 	input = append(input, "colin")
 
 	tpl = "begin order_create(?,?,?);end;"
-	except = "begin order_create('1','colin',NULL);end;"
+	except = "begin order_create(1,'colin',NULL);end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
 	}
 
 	tpl = "begin order_create(?);end;"
-	except = "begin order_create('1');end;"
+	except = "begin order_create(1);end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
@@ -189,7 +189,7 @@ func TestSqliteTPLReplace(t *testing.T) {
 	/*end*/
 
 	tpl = "begin order_create(?,'?234');end;"
-	except = "begin order_create('1','?234');end;"
+	except = "begin order_create(1,'?234');end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
@@ -197,49 +197,49 @@ func TestSqliteTPLReplace(t *testing.T) {
 
 	/*add by champly 2016年11月10日10:08:52*/
 	tpl = "begin order_create(?,?;end;"
-	except = "begin order_create('1','colin';end;"
+	except = "begin order_create(1,'colin';end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
 	}
 
 	tpl = "begin order_create(?,?）;end;"
-	except = "begin order_create('1',?）;end;"
+	except = "begin order_create(1,?）;end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
 	}
 
 	tpl = "begin order_create(?,? );end;"
-	except = "begin order_create('1','colin' );end;"
+	except = "begin order_create(1,'colin' );end;"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
 	}
 
 	tpl = "begin order_create(?,?"
-	except = "begin order_create('1','colin'"
+	except = "begin order_create(1,'colin'"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
 	}
 
 	tpl = "begin order_create(?,??"
-	except = "begin order_create('1',?'colin'"
+	except = "begin order_create(1,?'colin'"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
 	}
 
 	tpl = "begin order_create(?,??@"
-	except = "begin order_create('1',??@"
+	except = "begin order_create(1,??@"
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
 	}
 
 	tpl = "begin order_create(?,? "
-	except = "begin order_create('1','colin' "
+	except = "begin order_create(1,'colin' "
 	actual = orcl.Replace(tpl, input)
 	if actual != except {
 		t.Error("Replace解析参数有误", actual)
@@ -0,0 +1,260 @@
+package remote
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// Secret supplies credential material such as a password, a private key or a
+// certificate, so it does not have to be kept as plain strings in ServerInfo.
+type Secret func(info *ServerInfo) ([]byte, error)
+
+// StaticSecret returns a Secret holding s.
+func StaticSecret(s string) Secret {
+	return func(*ServerInfo) ([]byte, error) {
+		return []byte(s), nil
+	}
+}
+
+// FileSecret returns a Secret read from file on every use.
+func FileSecret(file string) Secret {
+	return func(*ServerInfo) ([]byte, error) {
+		return os.ReadFile(file)
+	}
+}
+
+// EnvSecret returns a Secret read from the environment variable name.
+func EnvSecret(name string) Secret {
+	return func(*ServerInfo) ([]byte, error) {
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return nil, fmt.Errorf("env %s not found", name)
+		}
+		return []byte(v), nil
+	}
+}
+
+// AuthProvider supplies one authentication method for a host. The providers
+// in ServerInfo.Auth are tried in order.
+type AuthProvider interface {
+	AuthMethod(info *ServerInfo) (ssh.AuthMethod, error)
+}
+
+// signerProvider is implemented by the public key providers, their signers are
+// merged into one method because the ssh client tries each method type only once.
+type signerProvider interface {
+	Signers(info *ServerInfo) ([]ssh.Signer, error)
+}
+
+type passwordAuth struct {
+	password Secret
+}
+
+// PasswordAuth authenticates with the password supplied by secret.
+func PasswordAuth(password Secret) AuthProvider {
+	return &passwordAuth{password: password}
+}
+
+func (p *passwordAuth) AuthMethod(info *ServerInfo) (ssh.AuthMethod, error) {
+	return ssh.PasswordCallback(func() (string, error) {
+		b, err := p.password(info)
+		return string(b), err
+	}), nil
+}
+
+type privateKeyAuth struct {
+	key        Secret
+	passphrase Secret
+	cert       Secret
+}
+
+// PrivateKeyAuth authenticates with a PEM encoded private key, passphrase may be nil.
+func PrivateKeyAuth(key, passphrase Secret) AuthProvider {
+	return &privateKeyAuth{key: key, passphrase: passphrase}
+}
+
+// CertificateAuth authenticates with an OpenSSH user certificate (the content
+// of id_xxx-cert.pub) and its private key, passphrase may be nil.
+func CertificateAuth(cert, key, passphrase Secret) AuthProvider {
+	return &privateKeyAuth{key: key, passphrase: passphrase, cert: cert}
+}
+
+func (p *privateKeyAuth) AuthMethod(info *ServerInfo) (ssh.AuthMethod, error) {
+	signers, err := p.Signers(info)
+	if err != nil {
+		return nil, err
+	}
+	return ssh.PublicKeys(signers...), nil
+}
+
+func (p *privateKeyAuth) Signers(info *ServerInfo) ([]ssh.Signer, error) {
+	key, err := p.key(info)
+	if err != nil {
+		return nil, err
+	}
+
+	var signer ssh.Signer
+	if p.passphrase == nil {
+		signer, err = ssh.ParsePrivateKey(key)
+	} else {
+		var passphrase []byte
+		if passphrase, err = p.passphrase(info); err != nil {
+			return nil, err
+		}
+		signer, err = ssh.ParsePrivateKeyWithPassphrase(key, passphrase)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if p.cert == nil {
+		return []ssh.Signer{signer}, nil
+	}
+
+	b, err := p.cert(info)
+	if err != nil {
+		return nil, err
+	}
+	pub, _, _, _, err := ssh.ParseAuthorizedKey(b)
+	if err != nil {
+		return nil, fmt.Errorf("parse certificate fail:%s", err)
+	}
+	cert, ok := pub.(*ssh.Certificate)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a certificate", pub.Type())
+	}
+	certSigner, err := ssh.NewCertSigner(cert, signer)
+	if err != nil {
+		return nil, err
+	}
+	return []ssh.Signer{certSigner}, nil
+}
+
+type agentAuth struct {
+	socket string
+	l      sync.Mutex
+	conn   net.Conn
+	client agent.ExtendedAgent
+}
+
+// AgentAuth authenticates with the keys of a running ssh-agent, an empty
+// socket uses SSH_AUTH_SOCK.
+func AgentAuth(socket string) AuthProvider {
+	return &agentAuth{socket: socket}
+}
+
+func (a *agentAuth) AuthMethod(info *ServerInfo) (ssh.AuthMethod, error) {
+	return ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+		return a.Signers(info)
+	}), nil
+}
+
+func (a *agentAuth) Signers(info *ServerInfo) ([]ssh.Signer, error) {
+	a.l.Lock()
+	defer a.l.Unlock()
+
+	if a.client != nil {
+		signers, err := a.client.Signers()
+		if err == nil {
+			return signers, nil
+		}
+		// the agent may have been restarted, reconnect once
+		a.conn.Close()
+		a.client = nil
+	}
+
+	socket := a.socket
+	if socket == "" {
+		socket = os.Getenv("SSH_AUTH_SOCK")
+	}
+	if socket == "" {
+		return nil, fmt.Errorf("SSH_AUTH_SOCK is not set")
+	}
+	conn, err := net.Dial("unix", socket)
+	if err != nil {
+		return nil, fmt.Errorf("connect ssh agent %s fail:%s", socket, err)
+	}
+	a.conn = conn
+	a.client = agent.NewClient(conn)
+	return a.client.Signers()
+}
+
+// KeyboardChallenge answers the questions of a keyboard-interactive login.
+type KeyboardChallenge func(info *ServerInfo, name, instruction string, questions []string, echos []bool) ([]string, error)
+
+type keyboardAuth struct {
+	challenge KeyboardChallenge
+}
+
+// KeyboardInteractiveAuth authenticates with keyboard-interactive challenges.
+func KeyboardInteractiveAuth(challenge KeyboardChallenge) AuthProvider {
+	return &keyboardAuth{challenge: challenge}
+}
+
+func (k *keyboardAuth) AuthMethod(info *ServerInfo) (ssh.AuthMethod, error) {
+	return ssh.KeyboardInteractive(func(name, instruction string, questions []string, echos []bool) ([]string, error) {
+		return k.challenge(info, name, instruction, questions, echos)
+	}), nil
+}
+
+// authMethods returns the methods of info.Auth in order, or the legacy
+// Password and Key methods when no provider is set.
+func authMethods(info *ServerInfo) ([]ssh.AuthMethod, error) {
+	providers := info.Auth
+	if len(providers) == 0 {
+		providers = legacyAuth(info)
+	}
+
+	methods := make([]ssh.AuthMethod, 0, len(providers))
+	signerProviders := make([]signerProvider, 0)
+	for _, provider := range providers {
+		if sp, ok := provider.(signerProvider); ok {
+			if len(signerProviders) == 0 {
+				methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+					return mergeSigners(info, signerProviders)
+				}))
+			}
+			signerProviders = append(signerProviders, sp)
+			continue
+		}
+
+		method, err := provider.AuthMethod(info)
+		if err != nil {
+			return nil, err
+		}
+		methods = append(methods, method)
+	}
+	return methods, nil
+}
+
+// mergeSigners skips the providers that fail as long as another one has signers.
+func mergeSigners(info *ServerInfo, providers []signerProvider) ([]ssh.Signer, error) {
+	signers := make([]ssh.Signer, 0)
+	var lastErr error
+	for _, p := range providers {
+		s, err := p.Signers(info)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		signers = append(signers, s...)
+	}
+	if len(signers) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	return signers, nil
+}
+
+func legacyAuth(info *ServerInfo) []AuthProvider {
+	if info.Key == "" {
+		return []AuthProvider{PasswordAuth(StaticSecret(info.Password))}
+	}
+	if info.Password == "" {
+		return []AuthProvider{PrivateKeyAuth(StaticSecret(info.Key), nil)}
+	}
+	return []AuthProvider{PrivateKeyAuth(StaticSecret(info.Key), StaticSecret(info.Password))}
+}
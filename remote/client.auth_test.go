@@ -0,0 +1,147 @@
+package remote
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/champly/lib4go/remote/remotetest"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+func TestPrivateKeyAuth(t *testing.T) {
+	sp := PrivateKeyAuth(StaticSecret(rsaPriv), nil).(signerProvider)
+	signers, err := sp.Signers(&ServerInfo{})
+	if err != nil || len(signers) != 1 {
+		t.Fatalf("parse private key fail:%v", err)
+	}
+	if signers[0].PublicKey().Type() != ssh.KeyAlgoRSA {
+		t.Errorf("unexpected key type %s", signers[0].PublicKey().Type())
+	}
+}
+
+func TestCertificateAuth(t *testing.T) {
+	_, caPriv, _ := ed25519.GenerateKey(rand.Reader)
+	ca, _ := ssh.NewSignerFromKey(caPriv)
+	userSigner, err := ssh.ParsePrivateKey([]byte(rsaPriv))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := &ssh.Certificate{
+		Key:             userSigner.PublicKey(),
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"root"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err = cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	sp := CertificateAuth(StaticSecret(string(ssh.MarshalAuthorizedKey(cert))), StaticSecret(rsaPriv), nil).(signerProvider)
+	signers, err := sp.Signers(&ServerInfo{})
+	if err != nil || len(signers) != 1 {
+		t.Fatalf("certificate signer fail:%v", err)
+	}
+	if _, ok := signers[0].PublicKey().(*ssh.Certificate); !ok {
+		t.Errorf("signer should present the certificate, got %s", signers[0].PublicKey().Type())
+	}
+}
+
+func TestAgentAuth(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Skip(err)
+	}
+	defer l.Close()
+
+	_, priv, _ := ed25519.GenerateKey(rand.Reader)
+	keyring := agent.NewKeyring()
+	keyring.Add(agent.AddedKey{PrivateKey: priv})
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go agent.ServeAgent(keyring, conn)
+		}
+	}()
+
+	sp := AgentAuth(socket).(signerProvider)
+	signers, err := sp.Signers(&ServerInfo{})
+	if err != nil || len(signers) != 1 {
+		t.Fatalf("agent signers fail:%v", err)
+	}
+}
+
+func TestAuthMethodsFallback(t *testing.T) {
+	methods, err := authMethods(&ServerInfo{Auth: []AuthProvider{
+		AgentAuth(filepath.Join(t.TempDir(), "none.sock")),
+		PasswordAuth(EnvSecret("LIB4GO_REMOTE_PASSWORD")),
+		PrivateKeyAuth(StaticSecret(rsaPriv), nil),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the agent and private key signers are merged into one public key method
+	if len(methods) != 2 {
+		t.Errorf("except 2 methods, actual %d", len(methods))
+	}
+
+	methods, err = authMethods(&ServerInfo{Password: "123456"})
+	if err != nil || len(methods) != 1 {
+		t.Errorf("legacy password auth fail:%v", err)
+	}
+}
+
+func TestAuthProviders(t *testing.T) {
+	_, caPriv, _ := ed25519.GenerateKey(rand.Reader)
+	ca, _ := ssh.NewSignerFromKey(caPriv)
+	userSigner, _ := ssh.ParsePrivateKey([]byte(rsaPriv))
+	cert := &ssh.Certificate{
+		Key:             userSigner.PublicKey(),
+		CertType:        ssh.UserCert,
+		ValidPrincipals: []string{"root"},
+		ValidBefore:     ssh.CertTimeInfinity,
+	}
+	if err := cert.SignCert(rand.Reader, ca); err != nil {
+		t.Fatal(err)
+	}
+
+	_, info := newTestServer(t, &remotetest.Options{
+		Passwords:           map[string]string{"root": "secret"},
+		CertAuthorities:     []ssh.PublicKey{ca.PublicKey()},
+		KeyboardInteractive: map[string]string{"root": "otp"},
+	})
+
+	providers := map[string][]AuthProvider{
+		"password":    {PasswordAuth(StaticSecret("secret"))},
+		"certificate": {CertificateAuth(StaticSecret(string(ssh.MarshalAuthorizedKey(cert))), StaticSecret(rsaPriv), nil)},
+		"keyboard": {KeyboardInteractiveAuth(func(info *ServerInfo, name, instruction string, questions []string, echos []bool) ([]string, error) {
+			return []string{"otp"}, nil
+		})},
+		// the plain key is rejected, the password is tried next
+		"fallback": {PrivateKeyAuth(StaticSecret(rsaPriv), nil), PasswordAuth(StaticSecret("secret"))},
+	}
+	for name, auth := range providers {
+		pool := NewPool(nil)
+		i := *info
+		i.Auth = auth
+		if _, err := pool.Client(&i); err != nil {
+			t.Errorf("%s auth fail:%v", name, err)
+		}
+		pool.Close()
+	}
+
+	pool := NewPool(nil)
+	defer pool.Close()
+	info.Auth = []AuthProvider{PasswordAuth(StaticSecret("wrong"))}
+	if _, err := pool.Client(info); err == nil {
+		t.Error("wrong password should fail")
+	}
+}
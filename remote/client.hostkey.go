@@ -0,0 +1,256 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// HostKeyPolicy decides whether the key presented by a remote host is trusted.
+type HostKeyPolicy interface {
+	HostKeyCallback() (ssh.HostKeyCallback, error)
+}
+
+// HostKeyMismatchError is returned when the remote host key is unknown or
+// does not match any of the expected keys.
+type HostKeyMismatchError struct {
+	Host        string
+	Fingerprint string
+	Want        []string
+}
+
+func (e *HostKeyMismatchError) Error() string {
+	if len(e.Want) == 0 {
+		return fmt.Sprintf("remote host (%s) key %s is unknown", e.Host, e.Fingerprint)
+	}
+	return fmt.Sprintf("remote host (%s) key mismatch, got %s want %s", e.Host, e.Fingerprint, strings.Join(e.Want, ","))
+}
+
+func (e *HostKeyMismatchError) Is(target error) bool {
+	return target == ErrHostKeyMismatch
+}
+
+type hostKeyPolicyFunc func() (ssh.HostKeyCallback, error)
+
+func (f hostKeyPolicyFunc) HostKeyCallback() (ssh.HostKeyCallback, error) {
+	return f()
+}
+
+// InsecureIgnoreHostKey accepts any host key, it is what a nil
+// ServerInfo.HostKey does without the warning.
+func InsecureIgnoreHostKey() HostKeyPolicy {
+	return hostKeyPolicyFunc(func() (ssh.HostKeyCallback, error) {
+		return ssh.InsecureIgnoreHostKey(), nil
+	})
+}
+
+// KnownHosts verifies host keys against OpenSSH known_hosts files.
+func KnownHosts(files ...string) HostKeyPolicy {
+	return hostKeyPolicyFunc(func() (ssh.HostKeyCallback, error) {
+		if len(files) == 0 {
+			return nil, fmt.Errorf("known_hosts file must not empty")
+		}
+		cb, err := knownhosts.New(files...)
+		if err != nil {
+			return nil, err
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			err := cb(hostname, remote, key)
+			if err == nil {
+				return nil
+			}
+
+			var kerr *knownhosts.KeyError
+			if !errors.As(err, &kerr) {
+				return err
+			}
+			want := make([]string, 0, len(kerr.Want))
+			for _, k := range kerr.Want {
+				want = append(want, ssh.FingerprintSHA256(k.Key))
+			}
+			return &HostKeyMismatchError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key), Want: want}
+		}, nil
+	})
+}
+
+// FixedFingerprints only accepts host keys whose fingerprint is in the list,
+// both "SHA256:..." and legacy MD5 "aa:bb:..." formats are supported.
+func FixedFingerprints(fingerprints ...string) HostKeyPolicy {
+	return hostKeyPolicyFunc(func() (ssh.HostKeyCallback, error) {
+		if len(fingerprints) == 0 {
+			return nil, fmt.Errorf("fingerprints must not empty")
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			for _, fp := range fingerprints {
+				if matchFingerprint(fp, key) {
+					return nil
+				}
+			}
+			return &HostKeyMismatchError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key), Want: fingerprints}
+		}, nil
+	})
+}
+
+func matchFingerprint(fp string, key ssh.PublicKey) bool {
+	fp = strings.TrimSpace(fp)
+	if strings.HasPrefix(fp, "SHA256:") {
+		return fp == ssh.FingerprintSHA256(key)
+	}
+	fp = strings.TrimPrefix(fp, "MD5:")
+	return strings.EqualFold(fp, ssh.FingerprintLegacyMD5(key))
+}
+
+// HostKeyStore keeps the host keys learned by TrustOnFirstUse, host is
+// the "host:port" address that was dialed.
+type HostKeyStore interface {
+	Lookup(host string) ([]ssh.PublicKey, error)
+	Add(host string, key ssh.PublicKey) error
+}
+
+// TrustOnFirstUse accepts and stores the key of a host never seen before,
+// later connections must present one of the stored keys.
+func TrustOnFirstUse(store HostKeyStore) HostKeyPolicy {
+	return hostKeyPolicyFunc(func() (ssh.HostKeyCallback, error) {
+		if store == nil {
+			return nil, fmt.Errorf("host key store must not nil")
+		}
+		return func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+			keys, err := store.Lookup(hostname)
+			if err != nil {
+				return err
+			}
+			if len(keys) == 0 {
+				return store.Add(hostname, key)
+			}
+
+			want := make([]string, 0, len(keys))
+			for _, k := range keys {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return nil
+				}
+				want = append(want, ssh.FingerprintSHA256(k))
+			}
+			return &HostKeyMismatchError{Host: hostname, Fingerprint: ssh.FingerprintSHA256(key), Want: want}
+		}, nil
+	})
+}
+
+type memoryHostKeyStore struct {
+	l    sync.RWMutex
+	keys map[string][]ssh.PublicKey
+}
+
+// NewMemoryHostKeyStore returns a HostKeyStore that lives only in the current process.
+func NewMemoryHostKeyStore() HostKeyStore {
+	return &memoryHostKeyStore{keys: map[string][]ssh.PublicKey{}}
+}
+
+func (m *memoryHostKeyStore) Lookup(host string) ([]ssh.PublicKey, error) {
+	m.l.RLock()
+	defer m.l.RUnlock()
+	return m.keys[knownhosts.Normalize(host)], nil
+}
+
+func (m *memoryHostKeyStore) Add(host string, key ssh.PublicKey) error {
+	m.l.Lock()
+	defer m.l.Unlock()
+	host = knownhosts.Normalize(host)
+	m.keys[host] = append(m.keys[host], key)
+	return nil
+}
+
+type knownHostsStore struct {
+	l    sync.Mutex
+	file string
+}
+
+// NewKnownHostsStore returns a HostKeyStore backed by an OpenSSH known_hosts file,
+// new keys are appended to the file.
+func NewKnownHostsStore(file string) HostKeyStore {
+	return &knownHostsStore{file: file}
+}
+
+func (k *knownHostsStore) Lookup(host string) ([]ssh.PublicKey, error) {
+	k.l.Lock()
+	defer k.l.Unlock()
+
+	if _, err := os.Stat(k.file); os.IsNotExist(err) {
+		return nil, nil
+	}
+	cb, err := knownhosts.New(k.file)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := net.SplitHostPort(host); err != nil {
+		host = net.JoinHostPort(host, "22")
+	}
+	// check with a key that is never stored, the KeyError carries the known keys
+	err = cb(host, &net.TCPAddr{}, probeKey{})
+	var kerr *knownhosts.KeyError
+	if !errors.As(err, &kerr) {
+		return nil, err
+	}
+	keys := make([]ssh.PublicKey, 0, len(kerr.Want))
+	for _, w := range kerr.Want {
+		keys = append(keys, w.Key)
+	}
+	return keys, nil
+}
+
+func (k *knownHostsStore) Add(host string, key ssh.PublicKey) error {
+	k.l.Lock()
+	defer k.l.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(k.file), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(k.file, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	w := bufio.NewWriter(f)
+	fmt.Fprintln(w, knownhosts.Line([]string{host}, key))
+	return w.Flush()
+}
+
+// probeKey never matches a stored key.
+type probeKey struct{}
+
+func (probeKey) Type() string {
+	return "lib4go-probe"
+}
+
+func (probeKey) Marshal() []byte {
+	return []byte("lib4go-probe")
+}
+
+func (probeKey) Verify(data []byte, sig *ssh.Signature) error {
+	return fmt.Errorf("probe key can not verify")
+}
+
+// insecureWarned are the hosts already warned about a nil HostKey.
+var insecureWarned sync.Map
+
+func hostKeyCallback(info *ServerInfo) (ssh.HostKeyCallback, error) {
+	if info.HostKey == nil {
+		addr := serverAddr(info)
+		if _, warned := insecureWarned.LoadOrStore(addr, true); !warned {
+			log.Printf("WARNING: host key of %s is not verified, set ServerInfo.HostKey, or InsecureIgnoreHostKey() to accept any key explicitly\n", addr)
+		}
+		return ssh.InsecureIgnoreHostKey(), nil
+	}
+	return info.HostKey.HostKeyCallback()
+}
@@ -0,0 +1,152 @@
+package remote
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func newTestHostKey(t *testing.T) ssh.PublicKey {
+	pub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := ssh.NewPublicKey(pub)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func TestFixedFingerprints(t *testing.T) {
+	key := newTestHostKey(t)
+	other := newTestHostKey(t)
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 22}
+
+	for _, fp := range []string{ssh.FingerprintSHA256(key), ssh.FingerprintLegacyMD5(key), "MD5:" + ssh.FingerprintLegacyMD5(key)} {
+		cb, err := FixedFingerprints(fp).HostKeyCallback()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cb("127.0.0.1:22", addr, key); err != nil {
+			t.Errorf("fingerprint %s should match: %s", fp, err)
+		}
+	}
+
+	cb, _ := FixedFingerprints(ssh.FingerprintSHA256(key)).HostKeyCallback()
+	var mismatch *HostKeyMismatchError
+	if err := cb("127.0.0.1:22", addr, other); !errors.As(err, &mismatch) {
+		t.Errorf("expect HostKeyMismatchError, got %v", err)
+	}
+}
+
+func TestTrustOnFirstUse(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("127.0.0.1"), Port: 2222}
+	stores := map[string]HostKeyStore{
+		"memory":     NewMemoryHostKeyStore(),
+		"knownhosts": NewKnownHostsStore(filepath.Join(t.TempDir(), "ssh", "known_hosts")),
+	}
+
+	for name, store := range stores {
+		key := newTestHostKey(t)
+		cb, err := TrustOnFirstUse(store).HostKeyCallback()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cb("127.0.0.1:2222", addr, key); err != nil {
+			t.Errorf("%s: first use should be trusted: %s", name, err)
+		}
+		if err = cb("127.0.0.1:2222", addr, key); err != nil {
+			t.Errorf("%s: stored key should be trusted: %s", name, err)
+		}
+
+		var mismatch *HostKeyMismatchError
+		if err = cb("127.0.0.1:2222", addr, newTestHostKey(t)); !errors.As(err, &mismatch) || len(mismatch.Want) != 1 {
+			t.Errorf("%s: expect HostKeyMismatchError, got %v", name, err)
+		}
+	}
+}
+
+func TestKnownHosts(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "known_hosts")
+	key := newTestHostKey(t)
+	if err := NewKnownHostsStore(file).Add("10.0.0.1:22", key); err != nil {
+		t.Fatal(err)
+	}
+
+	cb, err := KnownHosts(file).HostKeyCallback()
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 22}
+	if err = cb("10.0.0.1:22", addr, key); err != nil {
+		t.Error(err)
+	}
+
+	var mismatch *HostKeyMismatchError
+	if err = cb("10.0.0.1:22", addr, newTestHostKey(t)); !errors.As(err, &mismatch) || len(mismatch.Want) != 1 {
+		t.Errorf("expect HostKeyMismatchError, got %v", err)
+	}
+	if err = cb("10.0.0.2:22", &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 22}, key); !errors.As(err, &mismatch) || len(mismatch.Want) != 0 {
+		t.Errorf("expect unknown host error, got %v", err)
+	}
+}
+
+func TestHostKeyPolicies(t *testing.T) {
+	srv, info := newTestServer(t, nil)
+	store := NewMemoryHostKeyStore()
+
+	policies := []struct {
+		policy HostKeyPolicy
+		ok     bool
+	}{
+		{FixedFingerprints(ssh.FingerprintSHA256(srv.HostKey())), true},
+		{FixedFingerprints(ssh.FingerprintSHA256(newTestHostKey(t))), false},
+		{TrustOnFirstUse(store), true},
+	}
+	for _, p := range policies {
+		pool := NewPool(nil)
+		info.HostKey = p.policy
+		_, err := pool.Client(info)
+		if p.ok != (err == nil) {
+			t.Errorf("policy should accept:%v, actual %v", p.ok, err)
+		}
+		pool.Close()
+	}
+
+	keys, err := store.Lookup(srv.Addr())
+	if err != nil || len(keys) != 1 {
+		t.Errorf("trust on first use should store the key, actual %d %v", len(keys), err)
+	}
+}
+
+func TestInsecureHostKeyWarning(t *testing.T) {
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	info := &ServerInfo{Host: "10.9.9.9"}
+	for i := 0; i < 2; i++ {
+		if _, err := hostKeyCallback(info); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := strings.Count(buf.String(), "WARNING"); n != 1 {
+		t.Errorf("except one warning for a nil HostKey, actual %q", buf.String())
+	}
+
+	buf.Reset()
+	info = &ServerInfo{Host: "10.9.9.10", HostKey: InsecureIgnoreHostKey()}
+	if _, err := hostKeyCallback(info); err != nil || buf.Len() != 0 {
+		t.Errorf("explicit InsecureIgnoreHostKey should not warn, %q %v", buf.String(), err)
+	}
+}
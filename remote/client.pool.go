@@ -1,11 +1,15 @@
 package remote
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/pkg/sftp"
@@ -14,225 +18,667 @@ import (
 
 const expireTime = 60 * 60
 
-type clientModel struct {
-	expireTime time.Time
-	client     *ssh.Client
+const (
+	defaultKeepAliveInterval  = 30 * time.Second
+	defaultKeepAliveMaxMissed = 3
+	defaultMaxSessions        = 10
+	defaultDialTimeout        = 10 * time.Second
+)
+
+// PoolMetrics receives the events of a Pool, it must be safe for concurrent use.
+type PoolMetrics interface {
+	Dial(key string, cost time.Duration, err error)
+	Evict(key string, reason string)
+	SessionOpen(key string, active int)
+	SessionClose(key string, active int)
+	KeepAlive(key string, rtt time.Duration, err error)
 }
 
-type sftpClientModel struct {
-	expireTime time.Time
-	client     *sftp.Client
+type nopPoolMetrics struct{}
+
+func (nopPoolMetrics) Dial(string, time.Duration, error)      {}
+func (nopPoolMetrics) Evict(string, string)                   {}
+func (nopPoolMetrics) SessionOpen(string, int)                {}
+func (nopPoolMetrics) SessionClose(string, int)               {}
+func (nopPoolMetrics) KeepAlive(string, time.Duration, error) {}
+
+// PoolOptions configures a Pool, zero values use the defaults.
+type PoolOptions struct {
+	// IdleTimeout closes connections without sessions for this long, default 1h.
+	IdleTimeout time.Duration
+	// KeepAliveInterval is the interval of keepalive@openssh.com probes, default 30s, negative disables probes.
+	KeepAliveInterval time.Duration
+	// KeepAliveMaxMissed closes a connection after this many failed probes in a row, default 3.
+	KeepAliveMaxMissed int
+	// MaxSessions limits the sessions opened on one connection, a new connection
+	// is dialed when all are busy, default 10 (the OpenSSH MaxSessions default).
+	MaxSessions int
+	// DialTimeout is the tcp and handshake timeout, default 10s.
+	DialTimeout time.Duration
+	// DialRetry retries failed dials, nil dials once.
+	DialRetry *RetryPolicy
+	Metrics   PoolMetrics
+	// Audit receives an event for every command, file transfer and shell of
+	// the clients using the pool, nil disables auditing, see Pool.SetAudit.
+	Audit AuditSink
 }
 
-var (
-	sshClientPool  map[string]*clientModel
-	sftpClientPool map[string]*sftpClientModel
-	l              sync.Mutex
-	closeCh        chan struct{}
-)
+func (o *PoolOptions) complete() {
+	if o.IdleTimeout <= 0 {
+		o.IdleTimeout = time.Second * expireTime
+	}
+	if o.KeepAliveInterval == 0 {
+		o.KeepAliveInterval = defaultKeepAliveInterval
+	}
+	if o.KeepAliveMaxMissed <= 0 {
+		o.KeepAliveMaxMissed = defaultKeepAliveMaxMissed
+	}
+	if o.MaxSessions <= 0 {
+		o.MaxSessions = defaultMaxSessions
+	}
+	if o.DialTimeout <= 0 {
+		o.DialTimeout = defaultDialTimeout
+	}
+	if o.Metrics == nil {
+		o.Metrics = nopPoolMetrics{}
+	}
+}
 
-func init() {
-	sshClientPool = map[string]*clientModel{}
-	sftpClientPool = map[string]*sftpClientModel{}
-	closeCh = make(chan struct{})
+// Pool keeps ssh and sftp connections keyed by user@host:port.
+type Pool struct {
+	opts    PoolOptions
+	l       sync.Mutex
+	conns   map[string][]*poolConn
+	closed  bool
+	closeCh chan struct{}
+}
 
-	go loopDeleteSSHClient(closeCh)
-	go loopDeleteSftpClient(closeCh)
+type poolConn struct {
+	key      string
+	client   *ssh.Client
+	sessions int
+	lastUsed time.Time
+	closed   bool
+
+	// lastAlive is the unix nano of the last successful keepalive
+	lastAlive int64
+	missed    int32
+	probing   int32
+
+	sftpLock sync.Mutex
+	sftp     *sftp.Client
+	// sftpOpen is set under the pool lock once sftp is ready, it takes one session slot
+	sftpOpen bool
 }
 
-func GetSession(info *ServerInfo) (*ssh.Session, error) {
-	client, err := GetSSHClient(info)
+func (c *poolConn) used() int {
+	if c.sftpOpen {
+		return c.sessions + 1
+	}
+	return c.sessions
+}
+
+// Session is a pooled ssh session, Close gives its slot back to the pool.
+type Session struct {
+	*ssh.Session
+	once    sync.Once
+	release func()
+	// pool is the pool of the session, nil when it was not opened by a pool
+	pool *Pool
+}
+
+func (s *Session) Close() error {
+	err := s.Session.Close()
+	s.once.Do(func() {
+		if s.release != nil {
+			s.release()
+		}
+	})
+	return err
+}
+
+// NewPool creates a Pool, opts may be nil.
+func NewPool(opts *PoolOptions) *Pool {
+	p := &Pool{
+		conns:   map[string][]*poolConn{},
+		closeCh: make(chan struct{}),
+	}
+	if opts != nil {
+		p.opts = *opts
+	}
+	p.opts.complete()
+
+	go p.loop()
+	return p
+}
+
+// PoolKey returns the key of the connections to info in a Pool. The jump
+// hosts are part of the key, the same address behind different bastions may
+// be different servers.
+func PoolKey(info *ServerInfo) string {
+	keys := []string{fmt.Sprintf("%s@%s", info.User, serverAddr(info))}
+	for _, jump := range info.JumpHosts {
+		keys = append(keys, PoolKey(jump))
+	}
+	return strings.Join(keys, ",")
+}
+
+func serverAddr(info *ServerInfo) string {
+	port := info.Port
+	if port == 0 {
+		port = 22
+	}
+	return net.JoinHostPort(info.Host, strconv.Itoa(port))
+}
+
+// Client returns the least used pooled ssh.Client of info.
+func (p *Pool) Client(info *ServerInfo) (*ssh.Client, error) {
+	c, err := p.acquire(info, false)
 	if err != nil {
 		return nil, err
 	}
+	return c.client, nil
+}
 
-	session, err := client.NewSession()
-	if err == nil {
-		return session, nil
+// Hold returns a pooled ssh.Client of info and takes one session slot, so the
+// connection is not evicted while idle, release gives the slot back.
+func (p *Pool) Hold(info *ServerInfo) (client *ssh.Client, release func(), err error) {
+	c, err := p.acquire(info, true)
+	if err != nil {
+		return nil, nil, err
 	}
+	var once sync.Once
+	return c.client, func() { once.Do(func() { p.release(c) }) }, nil
+}
 
-	closeClient(info.Host)
+// Session opens a new session on a pooled connection of info.
+func (p *Pool) Session(info *ServerInfo) (*Session, error) {
+	session, err := p.newSession(info)
+	if err == nil || !errors.Is(err, ErrConnectionLost) {
+		return session, err
+	}
 
-	if !strings.EqualFold(err.Error(), "EOF") {
+	log.Printf("remote host (%s) already closed，reconnect\n", info.Host)
+	return p.newSession(info)
+}
+
+func (p *Pool) newSession(info *ServerInfo) (*Session, error) {
+	c, err := p.acquire(info, true)
+	if err != nil {
 		return nil, err
 	}
 
-	log.Printf("remote host (%s) already closed，reconnect\n", info.Host)
-	client, err = GetSSHClient(info)
+	s, err := c.client.NewSession()
 	if err != nil {
+		p.release(c)
+		p.evict(c, "new session: "+err.Error())
+		if errors.Is(err, io.EOF) {
+			err = &ConnectError{Addr: serverAddr(info), Reason: ErrConnectionLost, Err: err}
+		}
 		return nil, err
 	}
-	return client.NewSession()
+	return &Session{Session: s, release: func() { p.release(c) }, pool: p}, nil
 }
 
-func GetSSHClient(info *ServerInfo) (*ssh.Client, error) {
-	l.Lock()
-	c, ok := sshClientPool[info.Host]
-	l.Unlock()
-	if ok {
-		c.expireTime = time.Now().Add(time.Second * expireTime)
-		// if c.client.HandleChannelOpen(channelType string)
-		return c.client, nil
-	}
-
-	log.Printf("connect new host:%s\n", info.Host)
-	auth := make([]ssh.AuthMethod, 0)
-	if info.Key == "" {
-		auth = append(auth, ssh.Password(info.Password))
-	} else {
-		var signer ssh.Signer
-		var err error
-		if info.Password == "" {
-			signer, err = ssh.ParsePrivateKey([]byte(info.Key))
-		} else {
-			signer, err = ssh.ParsePrivateKeyWithPassphrase([]byte(info.Key), []byte(info.Password))
-		}
-		if err != nil {
-			return nil, err
+// Sftp returns the pooled sftp.Client of info, it takes one session slot of its connection.
+func (p *Pool) Sftp(info *ServerInfo) (*sftp.Client, error) {
+	p.l.Lock()
+	for _, c := range p.conns[PoolKey(info)] {
+		if !c.closed && c.sftpOpen {
+			c.lastUsed = time.Now()
+			p.l.Unlock()
+			return c.sftp, nil
 		}
-		auth = append(auth, ssh.PublicKeys(signer))
 	}
+	p.l.Unlock()
 
-	config := &ssh.ClientConfig{
-		User: info.User,
-		Auth: auth,
-		Config: ssh.Config{
-			Ciphers: []string{"aes128-ctr", "aes192-ctr", "aes256-ctr", "aes128-gcm@openssh.com", "arcfour256", "arcfour128", "aes128-cbc", "3des-cbc", "aes192-cbc", "aes256-cbc"},
-		},
-		Timeout:         10 * time.Second,
-		HostKeyCallback: ssh.InsecureIgnoreHostKey(),
+	c, err := p.acquire(info, true)
+	if err != nil {
+		return nil, err
 	}
 
-	port := info.Port
-	if port == 0 {
-		port = 22
+	c.sftpLock.Lock()
+	defer c.sftpLock.Unlock()
+	if c.sftp != nil {
+		p.release(c)
+		return c.sftp, nil
 	}
 
-	addr := fmt.Sprintf("%s:%d", info.Host, port)
-	conn, err := net.DialTimeout("tcp", addr, config.Timeout)
+	sc, err := sftp.NewClient(c.client)
 	if err != nil {
+		p.release(c)
 		return nil, err
 	}
-	scn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+
+	// the session slot taken by acquire now belongs to the sftp client
+	p.l.Lock()
+	c.sftp = sc
+	c.sftpOpen = true
+	c.sessions--
+	p.l.Unlock()
+	return sc, nil
+}
+
+// Remove closes all connections of info.
+func (p *Pool) Remove(info *ServerInfo) {
+	p.l.Lock()
+	conns := append([]*poolConn{}, p.conns[PoolKey(info)]...)
+	p.l.Unlock()
+
+	for _, c := range conns {
+		p.evict(c, "removed")
+	}
+}
+
+// Close closes all connections and stops the keepalive loop.
+func (p *Pool) Close() {
+	p.l.Lock()
+	if p.closed {
+		p.l.Unlock()
+		return
+	}
+	p.closed = true
+	close(p.closeCh)
+
+	conns := make([]*poolConn, 0)
+	for _, cs := range p.conns {
+		conns = append(conns, cs...)
+	}
+	p.l.Unlock()
+
+	for _, c := range conns {
+		p.evict(c, "pool closed")
+	}
+}
+
+// acquire returns a healthy connection of info, when session is true a
+// session slot is taken and must be given back with release.
+func (p *Pool) acquire(info *ServerInfo, session bool) (*poolConn, error) {
+	key := PoolKey(info)
+	for {
+		p.l.Lock()
+		if p.closed {
+			p.l.Unlock()
+			return nil, ErrPoolClosed
+		}
+
+		var best *poolConn
+		for _, c := range p.conns[key] {
+			if c.closed || (session && c.used() >= p.opts.MaxSessions) {
+				continue
+			}
+			if best == nil || c.used() < best.used() {
+				best = c
+			}
+		}
+		if best == nil {
+			p.l.Unlock()
+			break
+		}
+		if session {
+			best.sessions++
+		}
+		best.lastUsed = time.Now()
+		active := best.used()
+		p.l.Unlock()
+
+		if err := p.check(best); err != nil {
+			if session {
+				p.release(best)
+			}
+			p.evict(best, "health check: "+err.Error())
+			continue
+		}
+		if session {
+			p.opts.Metrics.SessionOpen(key, active)
+		}
+		return best, nil
+	}
+
+	client, err := p.dial(info)
 	if err != nil {
 		return nil, err
 	}
-	sc := ssh.NewClient(scn, chans, reqs)
+
+	c := &poolConn{key: key, client: client, lastUsed: time.Now(), lastAlive: time.Now().UnixNano()}
+	if session {
+		c.sessions = 1
+	}
+
+	p.l.Lock()
+	if p.closed {
+		p.l.Unlock()
+		client.Close()
+		return nil, ErrPoolClosed
+	}
+	p.conns[key] = append(p.conns[key], c)
+	p.l.Unlock()
 
 	go func() {
-		<-chans
-		log.Printf("remote %s closed", info.Host)
-		closeSftpClient(info.Host)
-		closeClient(info.Host)
+		client.Wait()
+		log.Printf("remote %s closed", key)
+		p.evict(c, "connection closed")
 	}()
 
-	l.Lock()
-	sshClientPool[info.Host] = &clientModel{expireTime: time.Now().Add(time.Second * expireTime), client: sc}
-	l.Unlock()
-	return sc, nil
+	if session {
+		p.opts.Metrics.SessionOpen(key, 1)
+	}
+	return c, nil
 }
 
-func GetSftpClient(info *ServerInfo) (*sftp.Client, error) {
-	if sc, ok := sftpClientPool[info.Host]; ok {
-		sc.expireTime = time.Now().Add(time.Second * expireTime)
-		return sc.client, nil
+func (p *Pool) release(c *poolConn) {
+	p.l.Lock()
+	if c.sessions > 0 {
+		c.sessions--
 	}
+	c.lastUsed = time.Now()
+	active := c.used()
+	p.l.Unlock()
 
-	client, err := GetSSHClient(info)
-	if err != nil {
-		return nil, err
+	p.opts.Metrics.SessionClose(c.key, active)
+}
+
+// check probes connections that were not confirmed alive within the last keepalive interval.
+func (p *Pool) check(c *poolConn) error {
+	if p.opts.KeepAliveInterval < 0 {
+		return nil
+	}
+	if time.Since(time.Unix(0, atomic.LoadInt64(&c.lastAlive))) < p.opts.KeepAliveInterval {
+		return nil
 	}
-	sc, err := sftp.NewClient(client)
+	return p.keepAlive(c, p.opts.DialTimeout)
+}
+
+func (p *Pool) keepAlive(c *poolConn, timeout time.Duration) error {
+	start := time.Now()
+	errCh := make(chan error, 1)
+	go func() {
+		_, _, err := c.client.SendRequest("keepalive@openssh.com", true, nil)
+		errCh <- err
+	}()
+
+	var err error
+	select {
+	case err = <-errCh:
+	case <-time.After(timeout):
+		err = fmt.Errorf("keepalive timeout")
+	}
+	p.opts.Metrics.KeepAlive(c.key, time.Since(start), err)
+
 	if err != nil {
-		return nil, err
+		atomic.AddInt32(&c.missed, 1)
+		return err
 	}
+	atomic.StoreInt32(&c.missed, 0)
+	atomic.StoreInt64(&c.lastAlive, time.Now().UnixNano())
+	return nil
+}
 
-	l.Lock()
-	sftpClientPool[info.Host] = &sftpClientModel{expireTime: time.Now().Add(time.Second * expireTime), client: sc}
-	l.Unlock()
-	return sc, nil
+func (p *Pool) evict(c *poolConn, reason string) {
+	p.l.Lock()
+	if c.closed {
+		p.l.Unlock()
+		return
+	}
+	c.closed = true
+	conns := p.conns[c.key]
+	for i, cc := range conns {
+		if cc == c {
+			conns = append(conns[:i:i], conns[i+1:]...)
+			break
+		}
+	}
+	if len(conns) == 0 {
+		delete(p.conns, c.key)
+	} else {
+		p.conns[c.key] = conns
+	}
+	p.l.Unlock()
+
+	c.sftpLock.Lock()
+	if c.sftp != nil {
+		c.sftp.Close()
+	}
+	c.sftpLock.Unlock()
+	c.client.Close()
+	p.opts.Metrics.Evict(c.key, reason)
 }
 
-func loopDeleteSSHClient(closeCh chan struct{}) {
-	ticker := time.NewTicker(time.Second * expireTime)
+func (p *Pool) loop() {
+	interval := p.opts.KeepAliveInterval
+	if interval < 0 || interval > p.opts.IdleTimeout {
+		interval = p.opts.IdleTimeout
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
 	for {
 		select {
 		case <-ticker.C:
-			l.Lock()
-			for host, model := range sshClientPool {
-				if time.Now().Before(model.expireTime) {
-					continue
-				}
-
-				model.client.Close()
-				delete(sshClientPool, host)
-			}
-			l.Unlock()
-
-		case <-closeCh:
+			p.sweep()
+		case <-p.closeCh:
 			return
 		}
 	}
 }
 
-func loopDeleteSftpClient(closeCh chan struct{}) {
-	ticker := time.NewTicker(time.Second * expireTime)
-	for {
-		select {
-		case <-ticker.C:
-			l.Lock()
-			for host, model := range sftpClientPool {
-				if time.Now().Before(model.expireTime) {
-					continue
-				}
-
-				model.client.Close()
-				delete(sftpClientPool, host)
+func (p *Pool) sweep() {
+	idle := make([]*poolConn, 0)
+	probe := make([]*poolConn, 0)
+
+	p.l.Lock()
+	for _, conns := range p.conns {
+		for _, c := range conns {
+			if c.sessions == 0 && time.Since(c.lastUsed) > p.opts.IdleTimeout {
+				idle = append(idle, c)
+				continue
 			}
-			l.Unlock()
-		case <-closeCh:
-			return
+			probe = append(probe, c)
 		}
 	}
+	p.l.Unlock()
+
+	for _, c := range idle {
+		p.evict(c, "idle timeout")
+	}
+	if p.opts.KeepAliveInterval < 0 {
+		return
+	}
+
+	for _, c := range probe {
+		if !atomic.CompareAndSwapInt32(&c.probing, 0, 1) {
+			// the last probe is still waiting for a reply, keepAlive counts
+			// the miss when it times out
+			continue
+		}
+		go func(c *poolConn) {
+			defer atomic.StoreInt32(&c.probing, 0)
+			p.keepAlive(c, p.opts.KeepAliveInterval)
+			if atomic.LoadInt32(&c.missed) >= int32(p.opts.KeepAliveMaxMissed) {
+				p.evict(c, "keepalive missed")
+			}
+		}(c)
+	}
 }
 
-func closeClient(host string) {
-	l.Lock()
-	defer l.Unlock()
+func (p *Pool) dial(info *ServerInfo) (*ssh.Client, error) {
+	key := PoolKey(info)
+	log.Printf("connect new host:%s\n", key)
+
+	var client *ssh.Client
+	err := p.opts.DialRetry.do(func() (err error) {
+		start := time.Now()
+		client, err = p.dialSSH(info)
+		p.opts.Metrics.Dial(key, time.Since(start), err)
+		return err
+	})
+	return client, err
+}
 
-	client, ok := sshClientPool[host]
-	if !ok {
-		return
+// dialSSH connects to info directly or, when it has jump hosts, through the
+// pooled connection of the last jump host.
+func (p *Pool) dialSSH(info *ServerInfo) (*ssh.Client, error) {
+	config, err := clientConfig(info, p.opts.DialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	// the handshake error only keeps the text of the host key error
+	var keyErr error
+	hostKeyCb := config.HostKeyCallback
+	config.HostKeyCallback = func(hostname string, remote net.Addr, key ssh.PublicKey) error {
+		keyErr = hostKeyCb(hostname, remote, key)
+		return keyErr
 	}
-	client.client.Close()
-	delete(sshClientPool, host)
+
+	addr := serverAddr(info)
+	var conn net.Conn
+	if len(info.JumpHosts) == 0 {
+		conn, err = net.DialTimeout("tcp", addr, config.Timeout)
+	} else {
+		conn, err = p.dialJump(info, addr)
+	}
+	if err != nil {
+		return nil, &ConnectError{Addr: addr, Reason: ErrHostUnreachable, Err: err}
+	}
+
+	// ssh.NewClientConn has no timeout of its own, a conn through a jump host
+	// does not support deadlines and is closed by a timer instead
+	var timer *time.Timer
+	if conn.SetDeadline(time.Now().Add(p.opts.DialTimeout)) != nil {
+		timer = time.AfterFunc(p.opts.DialTimeout, func() { conn.Close() })
+	}
+	scn, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	if timer != nil && !timer.Stop() && err == nil {
+		scn.Close()
+		err = fmt.Errorf("ssh handshake timeout after %s", p.opts.DialTimeout)
+	}
+	if err != nil {
+		conn.Close()
+		return nil, handshakeError(addr, err, keyErr)
+	}
+	conn.SetDeadline(time.Time{})
+	return ssh.NewClient(scn, chans, reqs), nil
 }
 
-func closeSftpClient(host string) {
-	l.Lock()
-	defer l.Unlock()
+func (p *Pool) dialJump(info *ServerInfo, addr string) (net.Conn, error) {
+	// the jump hosts are dialed in order, so the last one is reached through the others
+	last := len(info.JumpHosts) - 1
+	jump := *info.JumpHosts[last]
+	jump.JumpHosts = info.JumpHosts[:last]
 
-	sftpModel, ok := sftpClientPool[host]
-	if !ok {
-		return
+	bastion, err := p.Client(&jump)
+	if err != nil {
+		return nil, fmt.Errorf("connect jump host %s fail:%w", PoolKey(&jump), err)
+	}
+
+	type dialResult struct {
+		conn net.Conn
+		err  error
+	}
+	ch := make(chan dialResult, 1)
+	go func() {
+		conn, err := bastion.Dial("tcp", addr)
+		ch <- dialResult{conn: conn, err: err}
+	}()
+
+	select {
+	case r := <-ch:
+		if r.err != nil {
+			return nil, fmt.Errorf("dial %s through jump host %s fail:%w", addr, PoolKey(&jump), r.err)
+		}
+		return r.conn, nil
+	case <-time.After(p.opts.DialTimeout):
+		go func() {
+			if r := <-ch; r.conn != nil {
+				r.conn.Close()
+			}
+		}()
+		return nil, fmt.Errorf("dial %s through jump host %s timeout", addr, PoolKey(&jump))
 	}
-	sftpModel.client.Close()
-	delete(sftpClientPool, host)
 }
 
-func Close() {
-	close(closeCh)
+func clientConfig(info *ServerInfo, timeout time.Duration) (*ssh.ClientConfig, error) {
+	auth, err := authMethods(info)
+	if err != nil {
+		return nil, err
+	}
 
-	l.Lock()
-	defer l.Unlock()
+	hostKeyCb, err := hostKeyCallback(info)
+	if err != nil {
+		return nil, err
+	}
 
-	for _, c := range sshClientPool {
-		c.client.Close()
+	return &ssh.ClientConfig{
+		User: info.User,
+		Auth: auth,
+		Config: ssh.Config{
+			Ciphers: []string{"aes128-ctr", "aes192-ctr", "aes256-ctr", "aes128-gcm@openssh.com", "arcfour256", "arcfour128", "aes128-cbc", "3des-cbc", "aes192-cbc", "aes256-cbc"},
+		},
+		Timeout:         timeout,
+		HostKeyCallback: hostKeyCb,
+	}, nil
+}
+
+var (
+	defaultPool *Pool
+	dl          sync.Mutex
+)
+
+// DefaultPool returns the Pool used by the package level functions.
+func DefaultPool() *Pool {
+	dl.Lock()
+	defer dl.Unlock()
+
+	if defaultPool == nil {
+		defaultPool = NewPool(nil)
 	}
-	sshClientPool = nil
+	return defaultPool
+}
+
+// GetSession opens a session on the default pool without taking a session
+// slot, use GetPooledSession to have it counted in PoolOptions.MaxSessions.
+func GetSession(info *ServerInfo) (*ssh.Session, error) {
+	client, err := GetSSHClient(info)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := client.NewSession()
+	if err == nil {
+		return session, nil
+	}
+
+	// like Pool.Session, a connection failing to open sessions is dialed again
+	log.Printf("remote host (%s) new session fail:%s，reconnect\n", info.Host, err)
+	DefaultPool().Remove(info)
+	if client, err = GetSSHClient(info); err != nil {
+		return nil, err
+	}
+	return client.NewSession()
+}
+
+// GetPooledSession returns a session of the default pool, its Close gives
+// the session slot back.
+func GetPooledSession(info *ServerInfo) (*Session, error) {
+	return DefaultPool().Session(info)
+}
+
+func GetSSHClient(info *ServerInfo) (*ssh.Client, error) {
+	return DefaultPool().Client(info)
+}
+
+func GetSftpClient(info *ServerInfo) (*sftp.Client, error) {
+	return DefaultPool().Sftp(info)
+}
+
+// Close closes the default pool, a new one is created on next use.
+func Close() {
+	dl.Lock()
+	defer dl.Unlock()
 
-	for _, sc := range sftpClientPool {
-		sc.client.Close()
+	if defaultPool != nil {
+		defaultPool.Close()
+		defaultPool = nil
 	}
-	sftpClientPool = nil
 }
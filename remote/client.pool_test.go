@@ -2,15 +2,126 @@ package remote
 
 import (
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
 )
 
 func TestGetSSHClient(t *testing.T) {
-	_, err := GetSSHClient(&ServerInfo{
-		User:     "root",
-		Password: "123456",
-		Host:     "192.168.177.128",
-	})
+	_, info := newTestServer(t, nil)
+	defer Close()
+
+	c1, err := GetSSHClient(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c2, err := GetSSHClient(info)
+	if err != nil || c1 != c2 {
+		t.Errorf("except the pooled client, actual %v", err)
+	}
+}
+
+func TestGetSession(t *testing.T) {
+	srv, info := newTestServer(t, nil)
+	defer Close()
+
+	var session *ssh.Session
+	session, err := GetSession(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, err := session.Output("echo hi"); err != nil || string(out) != "hi\n" {
+		t.Errorf("session output %q %v", out, err)
+	}
+	session.Close()
+
+	// a dropped connection is dialed again
+	srv.Drop()
+	if session, err = GetSession(info); err != nil {
+		t.Fatal(err)
+	}
+	session.Close()
+
+	pooled, err := GetPooledSession(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pooled.Close()
+}
+
+func TestPoolReconnect(t *testing.T) {
+	srv, info := newTestServer(t, nil)
+	pool := NewPool(&PoolOptions{KeepAliveInterval: time.Millisecond})
+	defer pool.Close()
+
+	session, err := pool.Session(info)
 	if err != nil {
-		t.Error(err)
+		t.Fatal(err)
+	}
+	session.Close()
+
+	srv.Drop()
+	time.Sleep(10 * time.Millisecond)
+	session, err = pool.Session(info)
+	if err != nil {
+		t.Fatalf("except reconnect, actual %v", err)
+	}
+	session.Close()
+	if srv.Dialed() != 2 {
+		t.Errorf("except 2 dials, actual %d", srv.Dialed())
+	}
+
+	pool.Remove(info)
+	srv.DropNext(1)
+	if _, err = pool.Session(info); err == nil {
+		t.Error("dropped handshake should fail")
+	}
+}
+
+func TestPoolMaxSessions(t *testing.T) {
+	srv, info := newTestServer(t, nil)
+	pool := NewPool(&PoolOptions{MaxSessions: 2})
+	defer pool.Close()
+
+	sessions := make([]*Session, 0, 3)
+	for i := 0; i < 3; i++ {
+		s, err := pool.Session(info)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sessions = append(sessions, s)
+	}
+	if srv.Connections() != 2 {
+		t.Errorf("except a second connection after 2 sessions, actual %d", srv.Connections())
+	}
+	for _, s := range sessions {
+		s.Close()
+	}
+}
+
+func TestPoolKey(t *testing.T) {
+	keys := map[*ServerInfo]string{
+		{User: "root", Host: "10.0.0.1"}:            "root@10.0.0.1:22",
+		{User: "root", Host: "10.0.0.1", Port: 22}:  "root@10.0.0.1:22",
+		{User: "app", Host: "10.0.0.1", Port: 2222}: "app@10.0.0.1:2222",
+		{User: "root", Host: "::1", Port: 22}:       "root@[::1]:22",
+		{User: "root", Host: "10.0.0.1", JumpHosts: []*ServerInfo{
+			{User: "ops", Host: "bastion1"}, {User: "ops", Host: "bastion2", Port: 2222},
+		}}: "root@10.0.0.1:22,ops@bastion1:22,ops@bastion2:2222",
+	}
+	for info, except := range keys {
+		if actual := PoolKey(info); actual != except {
+			t.Errorf("PoolKey except:%s actual:%s", except, actual)
+		}
+	}
+}
+
+func TestPoolClosed(t *testing.T) {
+	pool := NewPool(nil)
+	pool.Close()
+	pool.Close()
+
+	if _, err := pool.Session(&ServerInfo{User: "root", Host: "127.0.0.1"}); err == nil {
+		t.Error("closed pool should not open sessions")
 	}
 }
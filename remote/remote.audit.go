@@ -0,0 +1,121 @@
+package remote
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// AuditType is the kind of an audited operation.
+type AuditType string
+
+const (
+	AuditExec     AuditType = "exec"
+	AuditScript   AuditType = "script"
+	AuditUpload   AuditType = "upload"
+	AuditDownload AuditType = "download"
+	AuditShell    AuditType = "shell"
+)
+
+// AuditEvent records one command, file transfer or interactive shell, the
+// Command of a shell is its input with the secrets masked.
+type AuditEvent struct {
+	Type          AuditType `json:"type"`
+	CorrelationID string    `json:"correlation_id,omitempty"`
+	Host          string    `json:"host"`
+	User          string    `json:"user"`
+	Command       string    `json:"command,omitempty"`
+	LocalFile     string    `json:"local_file,omitempty"`
+	RemoteFile    string    `json:"remote_file,omitempty"`
+	Start         time.Time `json:"start"`
+	End           time.Time `json:"end"`
+	ExitCode      int       `json:"exit_code"`
+	// Bytes is the output size of commands and the transferred size of files
+	Bytes int64  `json:"bytes"`
+	Error string `json:"error,omitempty"`
+}
+
+// AuditSink receives the audit events of a Pool, it is called synchronously
+// and may be called concurrently.
+type AuditSink interface {
+	Audit(e *AuditEvent)
+}
+
+// AuditFunc adapts a function to an AuditSink.
+type AuditFunc func(e *AuditEvent)
+
+func (f AuditFunc) Audit(e *AuditEvent) {
+	f(e)
+}
+
+type jsonLinesAuditSink struct {
+	l   sync.Mutex
+	enc *json.Encoder
+}
+
+// NewJSONLinesAuditSink writes every event as one JSON line to w.
+func NewJSONLinesAuditSink(w io.Writer) AuditSink {
+	return &jsonLinesAuditSink{enc: json.NewEncoder(w)}
+}
+
+func (s *jsonLinesAuditSink) Audit(e *AuditEvent) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.enc.Encode(e)
+}
+
+// NewChanAuditSink sends every event to ch, the operation blocks until it is received.
+func NewChanAuditSink(ch chan<- *AuditEvent) AuditSink {
+	return AuditFunc(func(e *AuditEvent) {
+		ch <- e
+	})
+}
+
+type correlationIDKey struct{}
+
+// WithCorrelationID returns a context whose operations are audited with id.
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationIDKey{}, id)
+}
+
+// CorrelationID returns the correlation id of ctx.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationIDKey{}).(string)
+	return id
+}
+
+// SetAudit replaces the audit sink of p, it is how the default pool used by
+// NewRemoteClient and NewCusReader is audited.
+func (p *Pool) SetAudit(sink AuditSink) {
+	p.l.Lock()
+	defer p.l.Unlock()
+	p.opts.Audit = sink
+}
+
+// audit completes e with the host and the correlation id of ctx and sends it
+// to the audit sink of the pool.
+func (p *Pool) audit(ctx context.Context, info *ServerInfo, e *AuditEvent, err error) {
+	p.l.Lock()
+	sink := p.opts.Audit
+	p.l.Unlock()
+	if sink == nil {
+		return
+	}
+	e.CorrelationID = CorrelationID(ctx)
+	e.Host = info.Host
+	e.User = info.User
+	e.End = time.Now()
+	if err != nil {
+		e.Error = err.Error()
+		if e.ExitCode == 0 {
+			e.ExitCode = -1
+		}
+	}
+	sink.Audit(e)
+}
+
+func (r *RemoteClient) audit(ctx context.Context, e *AuditEvent, err error) {
+	r.pool.audit(ctx, r.ServerInfo, e, err)
+}
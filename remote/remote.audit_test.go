@@ -0,0 +1,126 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAudit(t *testing.T) {
+	srv, info := newTestServer(t, nil)
+	events := make(chan *AuditEvent, 10)
+	pool := NewPool(&PoolOptions{Audit: NewChanAuditSink(events)})
+	defer pool.Close()
+
+	client, err := NewRemoteClientWithPool(info, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := WithCorrelationID(context.Background(), "change-42")
+	client.ExecContext(ctx, "echo hello; exit 2")
+
+	local := filepath.Join(t.TempDir(), "a.txt")
+	os.WriteFile(local, []byte("12345"), 0644)
+	if err = client.ScpFileContext(ctx, local, filepath.Join(srv.Root(), "a.txt"), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err = client.CopyFile(local+".back", filepath.Join(srv.Root(), "a.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	exec, upload, download := <-events, <-events, <-events
+	if exec.Type != AuditExec || exec.Command != "echo hello; exit 2" || exec.ExitCode != 2 || exec.Bytes != 6 ||
+		exec.CorrelationID != "change-42" || exec.User != "root" || exec.Host != info.Host || exec.End.Before(exec.Start) {
+		t.Errorf("unexpected exec event %+v", exec)
+	}
+	if upload.Type != AuditUpload || upload.Bytes != 5 || upload.CorrelationID != "change-42" || upload.Error != "" {
+		t.Errorf("unexpected upload event %+v", upload)
+	}
+	if download.Type != AuditDownload || download.Bytes != 5 || download.CorrelationID != "" {
+		t.Errorf("unexpected download event %+v", download)
+	}
+}
+
+func TestAuditPaths(t *testing.T) {
+	srv, info := newTestServer(t, nil)
+	srv.Handle("", deviceShell)
+	events := make(chan *AuditEvent, 10)
+	pool := NewPool(nil)
+	pool.SetAudit(NewChanAuditSink(events))
+	defer pool.Close()
+
+	client, err := NewRemoteClientWithPool(info, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	script := filepath.Join(srv.Root(), "exec.sh")
+	client.UseBashExecScript(script, "echo script")
+	if upload, exec := <-events, <-events; upload.Type != AuditUpload || upload.RemoteFile != script || upload.Bytes != 11 ||
+		exec.Type != AuditExec || exec.Command != "sh "+shellQuote(script) {
+		t.Errorf("unexpected script events %+v %+v", upload, exec)
+	}
+
+	session, err := pool.Session(info)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := NewCusReaderWithSession(info, session)
+	reader.Exec("echo reader")
+	reader.Close()
+	if e := <-events; e.Type != AuditExec || e.Command != "echo reader" || e.Bytes != 7 {
+		t.Errorf("unexpected reader event %+v", e)
+	}
+
+	sh, err := client.Shell(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sh.Expect(regexp.MustCompile(`Password: $`), time.Second)
+	sh.SendSecret("secret")
+	sh.Expect(regexp.MustCompile(`device# $`), time.Second)
+	sh.SendLine("exit")
+	sh.Wait()
+	sh.Close()
+	if e := <-events; e.Type != AuditShell || e.Command != "******\nexit\n" || e.Bytes == 0 || e.Error != "" {
+		t.Errorf("unexpected shell event %+v", e)
+	}
+
+	ctx, cancel := context.WithCancel(WithCorrelationID(context.Background(), "change-43"))
+	client.RunScript(ctx, &Script{Content: "echo run", Dir: srv.Root()})
+	cancel()
+	if mkdir := <-events; mkdir.Type != AuditExec || !strings.HasPrefix(mkdir.Command, "mkdir -m 0700") || mkdir.CorrelationID != "change-43" {
+		t.Errorf("unexpected mkdir event %+v", mkdir)
+	}
+	if run, cleanup := <-events, <-events; run.Type != AuditScript || cleanup.Type != AuditExec ||
+		!strings.HasPrefix(cleanup.Command, "rm -rf") || cleanup.CorrelationID != "change-43" {
+		t.Errorf("unexpected run script events %+v %+v", run, cleanup)
+	}
+	select {
+	case e := <-events:
+		t.Errorf("unexpected event %+v", e)
+	default:
+	}
+}
+
+func TestJSONLinesAuditSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := NewJSONLinesAuditSink(&buf)
+	sink.Audit(&AuditEvent{Type: AuditExec, Host: "10.0.0.1", Command: "ls"})
+	sink.Audit(&AuditEvent{Type: AuditUpload, Host: "10.0.0.2", Bytes: 10})
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("except 2 lines, actual %q", buf.String())
+	}
+	e := &AuditEvent{}
+	if err := json.Unmarshal([]byte(lines[1]), e); err != nil || e.Host != "10.0.0.2" || e.Bytes != 10 {
+		t.Errorf("unexpected event %+v %v", e, err)
+	}
+}
@@ -1,180 +1,169 @@
 package remote
 
 import (
+	"context"
 	"fmt"
+	"log"
 	"sync"
 )
 
 type ResponseMsg struct {
-	Host  string `json:"host,omitempty"`
-	Msg   string `json:"msg,omitempty"`
-	Error error  `json:"-"`
+	Name     string `json:"name,omitempty"`
+	Host     string `json:"host,omitempty"`
+	Msg      string `json:"msg,omitempty"`
+	ExitCode int    `json:"exit_code"`
+	Error    error  `json:"-"`
 }
 
 type BatchRemoteClient struct {
 	client []*RemoteClient
-	count  int
-	l      sync.Mutex
-	wg     sync.WaitGroup
+	// errs are the connect errors of the unreachable hosts
+	errs     []error
+	count    int
+	strategy *ExecStrategy
+	l        sync.Mutex
+	wg       sync.WaitGroup
 }
 
 func NewBatchRemoteClient(serverList []*ServerInfo) (*BatchRemoteClient, error) {
+	return NewBatchRemoteClientWithPool(serverList, DefaultPool())
+}
+
+// NewBatchRemoteClientWithPool creates a BatchRemoteClient whose connections are kept in pool,
+// the hosts that can not be reached return their connect error in every ResponseMsg.
+func NewBatchRemoteClientWithPool(serverList []*ServerInfo, pool *Pool) (*BatchRemoteClient, error) {
 	if serverList == nil || len(serverList) < 1 {
 		return nil, fmt.Errorf("serverList must not nil")
 	}
 	rclient := &BatchRemoteClient{count: len(serverList)}
 
-	errlist := make([]error, len(serverList))
-	rclient.client = []*RemoteClient{}
+	rclient.errs = make([]error, len(serverList))
+	rclient.client = make([]*RemoteClient, len(serverList))
 	for i, serverInfo := range serverList {
 		rclient.wg.Add(1)
 		go func(serverInfo *ServerInfo, index int) {
 			defer rclient.wg.Done()
 
-			c, err := NewRemoteClient(serverInfo)
+			c, err := NewRemoteClientWithPool(serverInfo, pool)
 			if err != nil {
-				errlist[index] = err
-				return
+				log.Printf("connect remote %s fail:%s", serverInfo.Host, err)
+				rclient.errs[index] = err
+				c = &RemoteClient{ServerInfo: serverInfo, pool: pool}
 			}
-			rclient.l.Lock()
-			rclient.client = append(rclient.client, c)
-			rclient.l.Unlock()
+			rclient.client[index] = c
 		}(serverInfo, i)
 	}
 	rclient.wg.Wait()
+	return rclient, nil
+}
 
-	for _, e := range errlist {
-		if e != nil {
-			return nil, e
+// Unreachable returns the hosts that could not be connected.
+func (b *BatchRemoteClient) Unreachable() []*ResponseMsg {
+	rsl := make([]*ResponseMsg, 0)
+	for i, err := range b.errs {
+		if err != nil {
+			rsl = append(rsl, &ResponseMsg{Name: b.client[i].Name, Host: b.client[i].Host, ExitCode: -1, Error: err})
 		}
 	}
-	return rclient, nil
+	return rsl
 }
 
-func (b *BatchRemoteClient) Exec(cmd string) ([]*ResponseMsg, error) {
+// SetStrategy sets the strategy used by all the operations, nil runs every host at once.
+func (b *BatchRemoteClient) SetStrategy(s *ExecStrategy) {
 	b.l.Lock()
 	defer b.l.Unlock()
+	b.strategy = s
+}
 
-	rsl := make([]*ResponseMsg, 0, b.count)
-
-	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *RemoteClient) {
-			defer b.wg.Done()
-			r, e := c.Exec(cmd)
-			rsl = append(rsl, &ResponseMsg{Msg: r, Error: e, Host: c.Host})
-		}(c)
-	}
-	b.wg.Wait()
-	return rsl, nil
+func (b *BatchRemoteClient) Exec(cmd string) ([]*ResponseMsg, error) {
+	return b.ExecWithStrategy(nil, cmd)
 }
 
-func (b *BatchRemoteClient) ScpFile(localFile string, remoteFile string) ([]*ResponseMsg, error) {
+// ExecWithStrategy runs cmd following s instead of the strategy of b.
+func (b *BatchRemoteClient) ExecWithStrategy(s *ExecStrategy, cmd string) ([]*ResponseMsg, error) {
 	b.l.Lock()
 	defer b.l.Unlock()
 
-	rsl := make([]*ResponseMsg, 0, b.count)
-
-	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *RemoteClient) {
-			defer b.wg.Done()
-			e := c.ScpFile(localFile, remoteFile)
-			rsl = append(rsl, &ResponseMsg{Error: e, Host: c.Host})
-		}(c)
-	}
-	b.wg.Wait()
-	return rsl, nil
+	return b.run(s, func(c *RemoteClient) *ResponseMsg {
+		r, e := c.Exec(cmd)
+		msg := &ResponseMsg{Msg: r, Error: e, Host: c.Host}
+		if e != nil {
+			msg.ExitCode = exitCode(e)
+		}
+		return msg
+	})
 }
 
-func (b *BatchRemoteClient) ScpDir(localDir, remoteDir string) ([]*ResponseMsg, error) {
+// ExecStream runs cmd on every host and calls fn for each output line tagged
+// with its host, fn is never called concurrently.
+func (b *BatchRemoteClient) ExecStream(ctx context.Context, cmd string, fn func(line *StreamLine), opts ...ExecOption) ([]*ResponseMsg, error) {
 	b.l.Lock()
 	defer b.l.Unlock()
 
-	rsl := make([]*ResponseMsg, 0, b.count)
-
-	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *RemoteClient) {
-			defer b.wg.Done()
-			e := c.ScpDir(localDir, remoteDir)
-			rsl = append(rsl, &ResponseMsg{Error: e, Host: c.Host})
-		}(c)
+	var fl sync.Mutex
+	call := func(line *StreamLine) {
+		fl.Lock()
+		defer fl.Unlock()
+		fn(line)
 	}
-	b.wg.Wait()
-	return rsl, nil
+
+	return b.run(nil, func(c *RemoteClient) *ResponseMsg {
+		r, e := c.ExecStream(ctx, cmd,
+			&streamLineWriter{host: c.Host, fn: call},
+			&streamLineWriter{host: c.Host, stderr: true, fn: call},
+			opts...,
+		)
+		msg := &ResponseMsg{Host: c.Host, Error: e, ExitCode: -1}
+		if r != nil {
+			msg.ExitCode = r.ExitCode
+		}
+		return msg
+	})
 }
 
-func (b *BatchRemoteClient) CopyFile(localFile string, remoteFile string) ([]*ResponseMsg, error) {
-	b.l.Lock()
-	defer b.l.Unlock()
+func (b *BatchRemoteClient) ScpFile(localFile string, remoteFile string) ([]*ResponseMsg, error) {
+	return b.Foreach(func(c *RemoteClient) (string, error) {
+		return "", c.ScpFile(localFile, remoteFile)
+	})
+}
 
-	rsl := make([]*ResponseMsg, 0, b.count)
+func (b *BatchRemoteClient) ScpDir(localDir, remoteDir string) ([]*ResponseMsg, error) {
+	return b.Foreach(func(c *RemoteClient) (string, error) {
+		return "", c.ScpDir(localDir, remoteDir)
+	})
+}
 
-	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *RemoteClient) {
-			defer b.wg.Done()
-			e := c.CopyFile(localFile, remoteFile)
-			rsl = append(rsl, &ResponseMsg{Error: e, Host: c.Host})
-		}(c)
-	}
-	b.wg.Wait()
-	return rsl, nil
+func (b *BatchRemoteClient) CopyFile(localFile string, remoteFile string) ([]*ResponseMsg, error) {
+	return b.Foreach(func(c *RemoteClient) (string, error) {
+		return "", c.CopyFile(localFile, remoteFile)
+	})
 }
 
 func (b *BatchRemoteClient) CopyDir(localDir, remoteDir string) ([]*ResponseMsg, error) {
-	b.l.Lock()
-	defer b.l.Unlock()
-
-	rsl := make([]*ResponseMsg, 0, b.count)
-
-	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *RemoteClient) {
-			defer b.wg.Done()
-			e := c.CopyDir(localDir, remoteDir)
-			rsl = append(rsl, &ResponseMsg{Error: e, Host: c.Host})
-		}(c)
-	}
-	b.wg.Wait()
-	return rsl, nil
+	return b.Foreach(func(c *RemoteClient) (string, error) {
+		return "", c.CopyDir(localDir, remoteDir)
+	})
 }
 
 func (b *BatchRemoteClient) UseBashExecScript(remoteFile, script string) ([]*ResponseMsg, error) {
-	b.l.Lock()
-	defer b.l.Unlock()
-
-	rsl := make([]*ResponseMsg, 0, b.count)
-
-	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *RemoteClient) {
-			defer b.wg.Done()
-			r, e := c.UseBashExecScript(remoteFile, script)
-			rsl = append(rsl, &ResponseMsg{Msg: r, Error: e, Host: c.Host})
-		}(c)
-	}
-	b.wg.Wait()
-	return rsl, nil
+	return b.Foreach(func(c *RemoteClient) (string, error) {
+		return c.UseBashExecScript(remoteFile, script)
+	})
 }
 
 func (b *BatchRemoteClient) Foreach(f func(r *RemoteClient) (string, error)) ([]*ResponseMsg, error) {
+	return b.ForeachWithStrategy(nil, f)
+}
+
+// ForeachWithStrategy calls f for every host following s instead of the strategy of b.
+func (b *BatchRemoteClient) ForeachWithStrategy(s *ExecStrategy, f func(r *RemoteClient) (string, error)) ([]*ResponseMsg, error) {
 	b.l.Lock()
 	defer b.l.Unlock()
 
-	rsl := make([]*ResponseMsg, 0, b.count)
-
-	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *RemoteClient) {
-			defer b.wg.Done()
-			str, err := f(c)
-			rsl = append(rsl, &ResponseMsg{Msg: str, Error: err, Host: c.Host})
-		}(c)
-	}
-	b.wg.Wait()
-	return rsl, nil
+	return b.run(s, func(c *RemoteClient) *ResponseMsg {
+		str, err := f(c)
+		return &ResponseMsg{Msg: str, Error: err, Host: c.Host}
+	})
 }
 
 func (b *BatchRemoteClient) Close() {
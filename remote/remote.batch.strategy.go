@@ -0,0 +1,167 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrBatchAborted is returned when a strategy stopped a batch before every host ran.
+	ErrBatchAborted = errors.New("batch aborted")
+	// ErrHostSkipped is the error of the hosts that did not run because the batch was aborted.
+	ErrHostSkipped = errors.New("host skipped")
+)
+
+// ExecStrategy controls how BatchRemoteClient runs an operation on its hosts,
+// the zero value runs all hosts at once.
+type ExecStrategy struct {
+	// MaxParallel limits the hosts running at the same time, 0 means no limit
+	MaxParallel int
+	// BatchSize runs the hosts in batches of N, a batch starts when the previous one finished
+	BatchSize int
+	// BatchPercent is the batch size as a percentage of the hosts, used when BatchSize is 0
+	BatchPercent int
+	// StopOnFailure starts no more hosts after the first failure
+	StopOnFailure bool
+	// MaxFailures starts no more hosts once this many failed, 0 means no limit
+	MaxFailures int
+	// Canary is the Host or Name that runs alone first, the others only run if it succeeds
+	Canary string
+}
+
+func (s *ExecStrategy) batchSize(n int) int {
+	size := n
+	switch {
+	case s.BatchSize > 0:
+		size = s.BatchSize
+	case s.BatchPercent > 0:
+		size = (n*s.BatchPercent + 99) / 100
+	}
+	if size < 1 {
+		size = 1
+	}
+	return size
+}
+
+func (s *ExecStrategy) abort(failures int) bool {
+	if failures == 0 {
+		return false
+	}
+	return s.StopOnFailure || (s.MaxFailures > 0 && failures >= s.MaxFailures)
+}
+
+// run calls f for every host following the strategy, the results are in the
+// order of the hosts.
+func (b *BatchRemoteClient) run(s *ExecStrategy, f func(c *RemoteClient) *ResponseMsg) ([]*ResponseMsg, error) {
+	if s == nil {
+		s = b.strategy
+	}
+	if s == nil {
+		s = &ExecStrategy{}
+	}
+
+	rsl := make([]*ResponseMsg, len(b.client))
+	order := make([]int, 0, len(b.client))
+	for i := range b.client {
+		order = append(order, i)
+	}
+
+	skip := func(indexes []int) {
+		for _, i := range indexes {
+			if rsl[i] == nil {
+				rsl[i] = &ResponseMsg{Name: b.client[i].Name, Host: b.client[i].Host, ExitCode: -1, Error: ErrHostSkipped}
+			}
+		}
+	}
+	call := func(i int) *ResponseMsg {
+		c := b.client[i]
+		if i < len(b.errs) && b.errs[i] != nil {
+			return &ResponseMsg{Name: c.Name, Host: c.Host, ExitCode: -1, Error: b.errs[i]}
+		}
+		msg := f(c)
+		msg.Name = c.Name
+		// failures keep the same exit code as Exec, -1 without an exit status
+		if msg.Error != nil && msg.ExitCode == 0 {
+			msg.ExitCode = exitCode(msg.Error)
+		}
+		return msg
+	}
+
+	if s.Canary != "" {
+		ci := -1
+		for i, c := range b.client {
+			if c.Host == s.Canary || (c.Name != "" && c.Name == s.Canary) {
+				ci = i
+				break
+			}
+		}
+		if ci < 0 {
+			return nil, fmt.Errorf("canary host %s not found", s.Canary)
+		}
+
+		rsl[ci] = call(ci)
+		if rsl[ci].Error != nil {
+			skip(order)
+			return rsl, fmt.Errorf("%w: canary %s failed:%s", ErrBatchAborted, s.Canary, rsl[ci].Error)
+		}
+		order = append(order[:ci], order[ci+1:]...)
+	}
+
+	var l sync.Mutex
+	failures := 0
+	aborted := false
+	size := s.batchSize(len(order))
+
+	for start := 0; start < len(order) && !aborted; start += size {
+		end := start + size
+		if end > len(order) {
+			end = len(order)
+		}
+		batch := order[start:end]
+
+		parallel := s.MaxParallel
+		if parallel <= 0 || parallel > len(batch) {
+			parallel = len(batch)
+		}
+		sem := make(chan struct{}, parallel)
+
+		var wg sync.WaitGroup
+		for _, i := range batch {
+			sem <- struct{}{}
+
+			l.Lock()
+			stop := aborted
+			l.Unlock()
+			if stop {
+				<-sem
+				break
+			}
+
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				defer func() { <-sem }()
+
+				msg := call(i)
+				rsl[i] = msg
+				if msg.Error == nil {
+					return
+				}
+				l.Lock()
+				failures++
+				if s.abort(failures) {
+					aborted = true
+				}
+				l.Unlock()
+			}(i)
+		}
+		wg.Wait()
+	}
+
+	if aborted {
+		skip(order)
+		return rsl, fmt.Errorf("%w: %d hosts failed", ErrBatchAborted, failures)
+	}
+	return rsl, nil
+}
@@ -0,0 +1,110 @@
+package remote
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+)
+
+func newTestBatch(n int) *BatchRemoteClient {
+	b := &BatchRemoteClient{count: n}
+	for i := 0; i < n; i++ {
+		b.client = append(b.client, &RemoteClient{ServerInfo: &ServerInfo{Host: fmt.Sprintf("10.0.0.%d", i)}})
+	}
+	return b
+}
+
+func TestBatchStrategyOrder(t *testing.T) {
+	b := newTestBatch(10)
+	var running, max int32
+	rsl, err := b.ForeachWithStrategy(&ExecStrategy{MaxParallel: 3}, func(r *RemoteClient) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			m := atomic.LoadInt32(&max)
+			if n <= m || atomic.CompareAndSwapInt32(&max, m, n) {
+				break
+			}
+		}
+		defer atomic.AddInt32(&running, -1)
+		return r.Host, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, r := range rsl {
+		if r.Host != b.client[i].Host || r.Msg != r.Host {
+			t.Errorf("result %d out of order: %+v", i, r)
+		}
+	}
+	if max > 3 {
+		t.Errorf("except at most 3 hosts at once, actual %d", max)
+	}
+}
+
+func TestBatchStrategyAbort(t *testing.T) {
+	b := newTestBatch(10)
+	failed := errors.New("failed")
+
+	var count int32
+	rsl, err := b.ForeachWithStrategy(&ExecStrategy{BatchSize: 2, MaxFailures: 3}, func(r *RemoteClient) (string, error) {
+		atomic.AddInt32(&count, 1)
+		return "", failed
+	})
+	if !errors.Is(err, ErrBatchAborted) {
+		t.Fatalf("except batch aborted, actual %v", err)
+	}
+	// batches of 2 run sequentially, the second batch reaches 3 failures
+	if count != 4 {
+		t.Errorf("except 4 hosts ran, actual %d", count)
+	}
+	if rsl[0].ExitCode != -1 {
+		t.Errorf("failure without exit status should have code -1, actual %d", rsl[0].ExitCode)
+	}
+	for i, r := range rsl[4:] {
+		if !errors.Is(r.Error, ErrHostSkipped) {
+			t.Errorf("host %d should be skipped, actual %v", i+4, r.Error)
+		}
+	}
+
+	count = 0
+	_, err = b.ForeachWithStrategy(&ExecStrategy{BatchPercent: 50, StopOnFailure: true}, func(r *RemoteClient) (string, error) {
+		atomic.AddInt32(&count, 1)
+		return "", failed
+	})
+	if !errors.Is(err, ErrBatchAborted) || count != 5 {
+		t.Errorf("except abort after the first batch of 5, actual %d %v", count, err)
+	}
+}
+
+func TestBatchStrategyCanary(t *testing.T) {
+	b := newTestBatch(5)
+	canary := b.client[3].Host
+
+	var first string
+	var count int32
+	rsl, err := b.ForeachWithStrategy(&ExecStrategy{Canary: canary, MaxParallel: 1}, func(r *RemoteClient) (string, error) {
+		if atomic.AddInt32(&count, 1) == 1 {
+			first = r.Host
+		}
+		return "", nil
+	})
+	if err != nil || first != canary || count != 5 || len(rsl) != 5 {
+		t.Errorf("canary should run first, actual first:%s count:%d %v", first, count, err)
+	}
+
+	count = 0
+	rsl, err = b.ForeachWithStrategy(&ExecStrategy{Canary: canary}, func(r *RemoteClient) (string, error) {
+		atomic.AddInt32(&count, 1)
+		return "", errors.New("failed")
+	})
+	if !errors.Is(err, ErrBatchAborted) || count != 1 || !errors.Is(rsl[0].Error, ErrHostSkipped) {
+		t.Errorf("failed canary should abort the batch, actual %d %v", count, err)
+	}
+
+	if _, err = b.ForeachWithStrategy(&ExecStrategy{Canary: "none"}, func(r *RemoteClient) (string, error) {
+		return "", nil
+	}); err == nil {
+		t.Error("except unknown canary error")
+	}
+}
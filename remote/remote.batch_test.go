@@ -1,77 +1,48 @@
 package remote
 
 import (
+	"errors"
 	"testing"
 )
 
-// func TestBatchExec(t *testing.T) {
-// // create client
-// client, err := NewBatchRemoteClient([]*ServerInfo{
-// &ServerInfo{
-// Host:     "10.13.3.6",
-// User:     "root",
-// Password: "dmallk8s",
-// Port:     22,
-// },
-// // &ServerInfo{
-// // Host:     "10.13.3.4",
-// // User:     "root",
-// // Password: "dmallk8s",
-// // Port:     22,
-// // },
-// // &ServerInfo{
-// // Host:     "10.13.3.5",
-// // User:     "root",
-// // Password: "dmallk8s",
-// // Port:     22,
-// // },
-// })
-// if err != nil {
-// t.Error(err)
-// return
-// }
-// defer client.Close()
-// t.Log("connect success")
+func TestBatchExec(t *testing.T) {
+	serverList := make([]*ServerInfo, 0, 3)
+	for i := 0; i < 3; i++ {
+		_, info := newTestServer(t, nil)
+		serverList = append(serverList, info)
+	}
+	// an unreachable host only fails itself
+	_, down := newTestServer(t, nil)
+	down.Port = 1
+	serverList = append(serverList, down)
 
-// // exec cmd
-// r, err := client.Exec("ls /")
-// if err != nil {
-// t.Error(err)
-// return
-// }
-// t.Log(r)
+	pool := NewPool(nil)
+	defer pool.Close()
+	client, err := NewBatchRemoteClientWithPool(serverList, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
 
-// r, err = client.Exec("date")
-// if err != nil {
-// t.Error(err)
-// return
-// }
-// t.Log(r)
+	rsl, err := client.Exec("echo hello")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range rsl[:3] {
+		if r.Error != nil || r.Msg != "hello\n" {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+	if rsl[3].Error == nil || len(client.Unreachable()) != 1 {
+		t.Errorf("unreachable host should fail, actual %+v", rsl[3])
+	}
 
-// // scp file
-// r, err = client.ScpFile("./remote.go", "/root/tmp/src/remote.go")
-// if err != nil {
-// t.Error(err)
-// return
-// }
-// t.Log(r)
-
-// // scp dir
-// r, err = client.ScpDir("/Users/champly/Documents/kops/test/k8s", "/root/tmp/rpm")
-// if err != nil {
-// t.Error(err)
-// return
-// }
-// t.Log(r)
+	_, err = client.ExecWithStrategy(&ExecStrategy{Canary: down.Host, StopOnFailure: true}, "echo hello")
+	if !errors.Is(err, ErrBatchAborted) {
+		t.Errorf("except batch aborted, actual %v", err)
+	}
+}
 
-// // scp bash an exec
-// r, err = client.UseBashExecScript("/root/tmp/exec.sh", "#!/bin/bash\ndate")
-// if err != nil {
-// t.Error(err)
-// return
-// }
-// t.Log(r)
-// }
 func TestBechant(t *testing.T) {
 	// for i := 0; i < 10000; i++ {
 	// client, _ := NewBatchRemoteClient([]*ServerInfo{
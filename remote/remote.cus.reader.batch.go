@@ -19,7 +19,7 @@ func NewBatchCusReader(serverList []*ServerInfo) (*BatchCusReader, error) {
 	rclient := &BatchCusReader{count: len(serverList)}
 
 	errlist := make([]error, len(serverList))
-	rclient.client = []*CusReader{}
+	rclient.client = make([]*CusReader, len(serverList))
 	for i, serverInfo := range serverList {
 		rclient.wg.Add(1)
 		go func(serverInfo *ServerInfo, index int) {
@@ -30,9 +30,7 @@ func NewBatchCusReader(serverList []*ServerInfo) (*BatchCusReader, error) {
 				errlist[index] = err
 				return
 			}
-			rclient.l.Lock()
-			rclient.client = append(rclient.client, c)
-			rclient.l.Unlock()
+			rclient.client[index] = c
 		}(serverInfo, i)
 	}
 	rclient.wg.Wait()
@@ -49,15 +47,15 @@ func (b *BatchCusReader) Exec(cmd string) ([]*ResponseMsg, error) {
 	b.l.Lock()
 	defer b.l.Unlock()
 
-	rsl := make([]*ResponseMsg, 0, b.count)
+	rsl := make([]*ResponseMsg, b.count)
 
 	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *CusReader) {
+	for i, c := range b.client {
+		go func(c *CusReader, index int) {
 			defer b.wg.Done()
 			r, e := c.Exec(cmd)
-			rsl = append(rsl, &ResponseMsg{Msg: r, Error: e, Host: c.Host})
-		}(c)
+			rsl[index] = &ResponseMsg{Msg: r, Error: e, Host: c.Host}
+		}(c, i)
 	}
 	b.wg.Wait()
 	return rsl, nil
@@ -76,15 +74,15 @@ func (b *BatchCusReader) UseBashExecScript(remoteFile, script string) ([]*Respon
 	b.l.Lock()
 	defer b.l.Unlock()
 
-	rsl := make([]*ResponseMsg, 0, b.count)
+	rsl := make([]*ResponseMsg, b.count)
 
 	b.wg.Add(b.count)
-	for _, c := range b.client {
-		go func(c *CusReader) {
+	for i, c := range b.client {
+		go func(c *CusReader, index int) {
 			defer b.wg.Done()
 			r, e := c.UseBashExecScript(remoteFile, script)
-			rsl = append(rsl, &ResponseMsg{Msg: r, Error: e, Host: c.Host})
-		}(c)
+			rsl[index] = &ResponseMsg{Msg: r, Error: e, Host: c.Host}
+		}(c, i)
 	}
 	b.wg.Wait()
 	return rsl, nil
@@ -1,70 +1,33 @@
 package remote
 
 import (
-	"fmt"
 	"testing"
-	"time"
 )
 
 func TestBatchCusReader(t *testing.T) {
-	client, err := NewBatchCusReader([]*ServerInfo{
-		{
-			Host: "10.12.192.131",
-			User: "root",
-			Key:  rsaPriv,
-			Port: 22,
-		},
-		{
-			Host: "10.12.192.132",
-			User: "root",
-			Key:  rsaPriv,
-			Port: 22,
-		},
-		{
-			Host: "10.12.192.133",
-			User: "root",
-			Key:  rsaPriv,
-			Port: 22,
-		},
-	})
-	if err != nil {
-		t.Error(err)
-		return
+	serverList := make([]*ServerInfo, 0, 3)
+	for i := 0; i < 3; i++ {
+		_, info := newTestServer(t, nil)
+		serverList = append(serverList, info)
 	}
-	fmt.Println("connect success")
+	defer Close()
 
-	go func() {
-		for {
-			rl := client.ExecGetResult()
-			fmt.Println("go func:")
-			for _, r := range rl {
-				fmt.Println(r.Host, r.Msg)
-			}
-			time.Sleep(1 * time.Second)
-		}
-	}()
+	client, err := NewBatchCusReader(serverList)
+	if err != nil {
+		t.Fatal(err)
+	}
 
-	// exec cmd
-	// rl, err := client.Exec("for i in `seq 1 10`;do echo $i; sleep 1;done")
-	// rl, err := client.Exec("docker pull nginx")
-	rl, err := client.UseBashExecScript("/root/1.sh", `#!/bin/bash
-echo "123"
-sleep 1
-echo "123"
-sleep 1
-echo "123"
-sleep 1
-echo "123"
-sleep 1
-echo "123"
-sleep 1
-	`)
+	rl, err := client.Exec(`echo "123"; echo "456"`)
 	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal(err)
 	}
 
-	for _, r := range rl {
-		fmt.Println(r.Host, r.Msg)
+	for i, r := range rl {
+		if r.Error != nil || r.Msg != "123\n456\n" || r.Host != serverList[i].Host {
+			t.Errorf("unexpected result %+v", r)
+		}
+	}
+	if rl := client.ExecGetResult(); len(rl) != 3 {
+		t.Errorf("except 3 results, actual %d", len(rl))
 	}
 }
@@ -2,19 +2,21 @@ package remote
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
+	"log"
 	"path"
-
-	"golang.org/x/crypto/ssh"
+	"time"
 )
 
 type CusReader struct {
 	*ServerInfo
-	session *ssh.Session
+	session *Session
 	contBuf *bytes.Buffer
 }
 
-func NewCusReaderWithSession(info *ServerInfo, session *ssh.Session) *CusReader {
+func NewCusReaderWithSession(info *ServerInfo, session *Session) *CusReader {
 	return &CusReader{
 		ServerInfo: info,
 		session:    session,
@@ -32,7 +34,7 @@ func (c *CusReader) Close() error {
 }
 
 func NewCusReader(info *ServerInfo) (*CusReader, error) {
-	session, err := GetSession(info)
+	session, err := GetPooledSession(info)
 	if err != nil {
 		return nil, err
 	}
@@ -41,34 +43,72 @@ func NewCusReader(info *ServerInfo) (*CusReader, error) {
 }
 
 func (c *CusReader) Exec(cmd string) (string, error) {
+	event := &AuditEvent{Type: AuditExec, Command: cmd, Start: time.Now()}
 	c.session.Stdout = c
 	c.session.Stderr = c
 
 	err := c.session.Run(cmd)
+	event.Bytes = int64(c.contBuf.Len())
+	if err != nil {
+		event.ExitCode = exitCode(err)
+	}
+	c.pool().audit(context.Background(), c.ServerInfo, event, err)
 	if err != nil {
 		return "", fmt.Errorf("%s%s", c.contBuf.String(), err.Error())
 	}
 	return c.contBuf.String(), nil
 }
 
+// pool returns the pool of the session, the default pool when it has none.
+func (c *CusReader) pool() *Pool {
+	if c.session.pool != nil {
+		return c.session.pool
+	}
+	return DefaultPool()
+}
+
 func (c *CusReader) ExecGetResult() string {
 	return c.contBuf.String()
 }
 
 func (c *CusReader) UseBashExecScript(remoteFile, script string) (string, error) {
-	sclient, err := GetSftpClient(c.ServerInfo)
+	sclient, err := c.pool().Sftp(c.ServerInfo)
 	if err != nil {
 		return "", err
 	}
 
 	if err := sclient.MkdirAll(path.Dir(remoteFile)); err != nil {
-		return "", fmt.Errorf("create remote dir(%s) fail:%s", path.Dir(remoteFile), err)
+		return "", fmt.Errorf("create remote dir(%s) fail:%w", path.Dir(remoteFile), err)
 	}
 
+	event := &AuditEvent{Type: AuditUpload, RemoteFile: remoteFile, Bytes: int64(len(script)), Start: time.Now()}
 	dsf, err := sclient.Create(remoteFile)
 	if err != nil {
-		return "", fmt.Errorf("create remote file fail:%s", err)
+		err = fmt.Errorf("create remote file fail:%w", err)
+		c.pool().audit(context.Background(), c.ServerInfo, event, err)
+		return "", err
+	}
+	defer func() {
+		if err := sclient.Remove(remoteFile); err != nil {
+			log.Printf("remove remote file(%s) fail:%s", remoteFile, err)
+		}
+	}()
+	err = uploadScript(dsf, script)
+	c.pool().audit(context.Background(), c.ServerInfo, event, err)
+	if err != nil {
+		return "", err
+	}
+	return c.Exec("sh " + shellQuote(remoteFile))
+}
+
+// uploadScript writes script to the remote file dsf and closes it.
+func uploadScript(dsf io.WriteCloser, script string) error {
+	if _, err := dsf.Write([]byte(script)); err != nil {
+		dsf.Close()
+		return fmt.Errorf("write remote file fail:%w", err)
+	}
+	if err := dsf.Close(); err != nil {
+		return fmt.Errorf("close remote file fail:%w", err)
 	}
-	dsf.Write([]byte(script))
-	return c.Exec("sh " + remoteFile)
+	return nil
 }
@@ -0,0 +1,201 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+var (
+	// ErrAuthFailed is matched by connect errors when the server rejected all
+	// authentication methods.
+	ErrAuthFailed = errors.New("ssh auth failed")
+	// ErrHostUnreachable is matched by connect errors when the tcp dial or the
+	// ssh handshake failed.
+	ErrHostUnreachable = errors.New("host unreachable")
+	// ErrHostKeyMismatch is matched by connect errors when the host key policy
+	// rejected the key of the server.
+	ErrHostKeyMismatch = errors.New("host key mismatch")
+	// ErrConnectionLost is matched when a pooled connection was closed by the
+	// remote side.
+	ErrConnectionLost = errors.New("connection lost")
+	// ErrPoolClosed is returned by a closed Pool.
+	ErrPoolClosed = errors.New("remote pool already closed")
+	// ErrTimeout is returned when a command did not finish before its
+	// deadline, it also matches context.DeadlineExceeded.
+	ErrTimeout error = timeoutError{}
+
+	// ErrNotExist and ErrPermission are matched by sftp errors of missing
+	// files and denied access.
+	ErrNotExist   = fs.ErrNotExist
+	ErrPermission = fs.ErrPermission
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "exec timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func (timeoutError) Is(target error) bool {
+	return target == context.DeadlineExceeded
+}
+
+// ctxErr returns the error of a done ctx, a deadline becomes ErrTimeout.
+func ctxErr(ctx context.Context) error {
+	err := ctx.Err()
+	if errors.Is(err, context.DeadlineExceeded) {
+		return ErrTimeout
+	}
+	return err
+}
+
+// ConnectError is returned when a connection to Addr can not be established
+// or was lost, it matches its Reason (ErrHostUnreachable, ErrAuthFailed,
+// ErrHostKeyMismatch or ErrConnectionLost) and the underlying Err.
+type ConnectError struct {
+	Addr   string
+	Reason error
+	Err    error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("connect %s fail:%s", e.Addr, e.Err)
+}
+
+func (e *ConnectError) Unwrap() []error {
+	return []error{e.Reason, e.Err}
+}
+
+// handshakeError classifies an error of ssh.NewClientConn, keyErr is the
+// error returned by the host key callback during the handshake.
+func handshakeError(addr string, err, keyErr error) error {
+	switch {
+	case keyErr != nil:
+		return &ConnectError{Addr: addr, Reason: ErrHostKeyMismatch, Err: keyErr}
+	case strings.Contains(err.Error(), "unable to authenticate"):
+		return &ConnectError{Addr: addr, Reason: ErrAuthFailed, Err: err}
+	default:
+		return &ConnectError{Addr: addr, Reason: ErrHostUnreachable, Err: err}
+	}
+}
+
+// ExitError is returned when a command exited with a non-zero code or
+// without an exit status, Code is -1 in the latter case.
+type ExitError struct {
+	Host string
+	Cmd  string
+	Code int
+	// Output is the combined output of the command, it is empty for streamed commands
+	Output string
+	Err    error
+}
+
+func (e *ExitError) Error() string {
+	return e.Output + e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// exitError wraps the exit errors of the ssh package into an ExitError and
+// returns other errors as is.
+func exitError(host, cmd, output string, err error) error {
+	var ee *ssh.ExitError
+	var em *ssh.ExitMissingError
+	if !errors.As(err, &ee) && !errors.As(err, &em) {
+		return err
+	}
+	return &ExitError{Host: host, Cmd: cmd, Code: exitCode(err), Output: output, Err: err}
+}
+
+// IsRetryable reports whether err is a connection problem that may go away
+// by trying again. Command timeouts and exit errors are not retryable since
+// the command may already have had effects.
+func IsRetryable(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, ErrAuthFailed),
+		errors.Is(err, ErrHostKeyMismatch),
+		errors.Is(err, ErrPoolClosed),
+		errors.Is(err, context.Canceled),
+		errors.Is(err, ErrTimeout):
+		return false
+	}
+	var ee *ExitError
+	if errors.As(err, &ee) {
+		return false
+	}
+	if errors.Is(err, ErrHostUnreachable) || errors.Is(err, ErrConnectionLost) || errors.Is(err, io.EOF) {
+		return true
+	}
+	var ne net.Error
+	return errors.As(err, &ne)
+}
+
+// RetryPolicy retries an operation with exponential backoff.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, default 3.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, it doubles after every
+	// attempt up to MaxBackoff, default 1s.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Retryable decides whether an error is retried, default IsRetryable.
+	Retryable func(err error) bool
+}
+
+// Do calls fn until it succeeds, returns an error that is not retryable, the
+// attempts are used up or ctx is done. The last error of fn is returned.
+func (p *RetryPolicy) Do(ctx context.Context, fn func() error) error {
+	attempts, backoff, retryable := 3, time.Second, IsRetryable
+	if p != nil {
+		if p.MaxAttempts > 0 {
+			attempts = p.MaxAttempts
+		}
+		if p.Backoff > 0 {
+			backoff = p.Backoff
+		}
+		if p.Retryable != nil {
+			retryable = p.Retryable
+		}
+	}
+
+	var err error
+	for i := 0; i < attempts; i++ {
+		if i > 0 {
+			timer := time.NewTimer(backoff)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+			backoff *= 2
+			if p != nil && p.MaxBackoff > 0 && backoff > p.MaxBackoff {
+				backoff = p.MaxBackoff
+			}
+		}
+
+		if err = fn(); err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// do calls fn once when p is nil.
+func (p *RetryPolicy) do(fn func() error) error {
+	if p == nil {
+		return fn()
+	}
+	return p.Do(context.Background(), fn)
+}
@@ -0,0 +1,159 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/champly/lib4go/remote/remotetest"
+)
+
+func TestConnectErrors(t *testing.T) {
+	_, info := newTestServer(t, &remotetest.Options{Passwords: map[string]string{"root": "123456"}})
+	pool := NewPool(&PoolOptions{DialTimeout: time.Second})
+	defer pool.Close()
+
+	wrongPassword := *info
+	wrongPassword.Password = "wrong"
+	wrongKey := *info
+	wrongKey.HostKey = FixedFingerprints("SHA256:unknown")
+	closed := *info
+	closed.Port = 1
+
+	cases := []struct {
+		name   string
+		info   *ServerInfo
+		except error
+	}{
+		{"auth", &wrongPassword, ErrAuthFailed},
+		{"host key", &wrongKey, ErrHostKeyMismatch},
+		{"unreachable", &closed, ErrHostUnreachable},
+	}
+	for _, c := range cases {
+		_, err := pool.Client(c.info)
+		var ce *ConnectError
+		if !errors.Is(err, c.except) || !errors.As(err, &ce) || ce.Addr != serverAddr(c.info) {
+			t.Errorf("%s except %v, actual %v", c.name, c.except, err)
+		}
+		if IsRetryable(err) != (c.except == ErrHostUnreachable) {
+			t.Errorf("%s retryable should be %v", c.name, c.except == ErrHostUnreachable)
+		}
+	}
+
+	_, err := pool.Client(&wrongKey)
+	var me *HostKeyMismatchError
+	if !errors.As(err, &me) || me.Host == "" {
+		t.Errorf("except HostKeyMismatchError, actual %v", err)
+	}
+
+	if _, err = NewRemoteClientWithPool(&wrongPassword, pool); !errors.Is(err, ErrAuthFailed) {
+		t.Errorf("new client except auth failed, actual %v", err)
+	}
+
+	pool.Close()
+	if _, err = pool.Client(info); !errors.Is(err, ErrPoolClosed) {
+		t.Errorf("except pool closed, actual %v", err)
+	}
+}
+
+func TestHandshakeTimeout(t *testing.T) {
+	_, silent := newTestServer(t, &remotetest.Options{Silent: true})
+	_, bastion := newTestServer(t, nil)
+	jumped := *silent
+	jumped.JumpHosts = []*ServerInfo{bastion}
+
+	pool := NewPool(&PoolOptions{DialTimeout: 200 * time.Millisecond})
+	defer pool.Close()
+	for _, info := range []*ServerInfo{silent, &jumped} {
+		start := time.Now()
+		_, err := pool.Client(info)
+		if !errors.Is(err, ErrHostUnreachable) {
+			t.Errorf("%s except unreachable, actual %v", PoolKey(info), err)
+		}
+		if d := time.Since(start); d > 2*time.Second {
+			t.Errorf("%s handshake should time out after DialTimeout, took %s", PoolKey(info), d)
+		}
+	}
+}
+
+func TestSftpErrors(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+
+	err := client.CopyFile(filepath.Join(t.TempDir(), "a"), filepath.Join(srv.Root(), "missing"))
+	if !errors.Is(err, ErrNotExist) {
+		t.Errorf("except not exist, actual %v", err)
+	}
+	err = client.ScpFile(filepath.Join(t.TempDir(), "missing"), filepath.Join(srv.Root(), "a"))
+	if !errors.Is(err, ErrNotExist) {
+		t.Errorf("except local not exist, actual %v", err)
+	}
+}
+
+func TestStreamExitError(t *testing.T) {
+	_, client := newTestClient(t, nil)
+	res, err := client.ExecStream(context.Background(), "exit 4", nil, nil)
+	var ee *ExitError
+	if !errors.As(err, &ee) || ee.Code != 4 || res.ExitCode != 4 {
+		t.Errorf("except exit 4, actual %+v %v", res, err)
+	}
+	if IsRetryable(err) {
+		t.Error("exit error should not be retryable")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	p := &RetryPolicy{MaxAttempts: 3, Backoff: time.Millisecond}
+
+	n := 0
+	err := p.Do(context.Background(), func() error {
+		n++
+		if n < 3 {
+			return &ConnectError{Addr: "h:22", Reason: ErrHostUnreachable, Err: io.EOF}
+		}
+		return nil
+	})
+	if err != nil || n != 3 {
+		t.Errorf("except success after 3 attempts, actual %d %v", n, err)
+	}
+
+	n = 0
+	err = p.Do(context.Background(), func() error {
+		n++
+		return &ConnectError{Addr: "h:22", Reason: ErrAuthFailed, Err: fmt.Errorf("denied")}
+	})
+	if !errors.Is(err, ErrAuthFailed) || n != 1 {
+		t.Errorf("auth failure should not be retried, actual %d %v", n, err)
+	}
+
+	n = 0
+	p.Retryable = func(err error) bool { return errors.Is(err, ErrTimeout) }
+	err = p.Do(context.Background(), func() error {
+		n++
+		return ErrTimeout
+	})
+	if err != ErrTimeout || n != 3 {
+		t.Errorf("custom retryable should retry timeouts, actual %d %v", n, err)
+	}
+}
+
+func TestPoolDialRetry(t *testing.T) {
+	srv, info := newTestServer(t, nil)
+	once := NewPool(nil)
+	defer once.Close()
+	pool := NewPool(&PoolOptions{DialRetry: &RetryPolicy{MaxAttempts: 2, Backoff: time.Millisecond}})
+	defer pool.Close()
+
+	srv.DropNext(1)
+	if _, err := once.Client(info); !errors.Is(err, ErrHostUnreachable) {
+		t.Errorf("dropped dial except unreachable, actual %v", err)
+	}
+
+	srv.DropNext(1)
+	if _, err := pool.Client(info); err != nil {
+		t.Errorf("dial should be retried, actual %v", err)
+	}
+}
@@ -0,0 +1,83 @@
+package remote
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// killWait is how long a cancelled command may take to exit after the
+// signal was sent and its session closed.
+const killWait = 5 * time.Second
+
+type execOptions struct {
+	pty    bool
+	signal ssh.Signal
+}
+
+// ExecOption configures how a command is run.
+type ExecOption func(o *execOptions)
+
+// WithPty requests a pseudo terminal for the command, so closing the session
+// hangs up the whole remote process group.
+func WithPty() ExecOption {
+	return func(o *execOptions) {
+		o.pty = true
+	}
+}
+
+// WithSignal sets the signal sent to the remote process when the context is
+// done, the default is SIGKILL.
+func WithSignal(sig ssh.Signal) ExecOption {
+	return func(o *execOptions) {
+		o.signal = sig
+	}
+}
+
+func newExecOptions(opts []ExecOption) *execOptions {
+	o := &execOptions{signal: ssh.SIGKILL}
+	for _, opt := range opts {
+		opt(o)
+	}
+	return o
+}
+
+// runSession runs cmd on the session and stops it when ctx is done, only the
+// session is closed, the underlying ssh.Client stays usable.
+func runSession(ctx context.Context, session *ssh.Session, cmd string, o *execOptions) error {
+	if o.pty {
+		modes := ssh.TerminalModes{
+			ssh.ECHO:          0,
+			ssh.TTY_OP_ISPEED: 14400,
+			ssh.TTY_OP_OSPEED: 14400,
+		}
+		if err := session.RequestPty("xterm", 40, 80, modes); err != nil {
+			return err
+		}
+	}
+
+	if err := session.Start(cmd); err != nil {
+		return err
+	}
+
+	waitCh := make(chan error, 1)
+	go func() {
+		waitCh <- session.Wait()
+	}()
+
+	select {
+	case err := <-waitCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	session.Signal(o.signal)
+	session.Close()
+
+	select {
+	case <-waitCh:
+	case <-time.After(killWait):
+	}
+	return ctx.Err()
+}
@@ -0,0 +1,326 @@
+package remote
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	socks5Version = 0x05
+
+	socks5NoAuth       = 0x00
+	socks5NoAcceptable = 0xff
+
+	socks5Connect = 0x01
+
+	socks5IPv4   = 0x01
+	socks5Domain = 0x03
+	socks5IPv6   = 0x04
+
+	socks5Succeeded           = 0x00
+	socks5HostUnreachable     = 0x04
+	socks5CommandNotSupported = 0x07
+	socks5AddrNotSupported    = 0x08
+	// socks5NoReply is not a reply code, the handshake failed before the
+	// request and the connection is closed without a reply
+	socks5NoReply = 0xff
+)
+
+// Forwarder is a running port forward, Close stops it and all its connections.
+type Forwarder struct {
+	listener net.Listener
+	// target is the dialed address, empty for SOCKS5 where the client chooses it
+	target string
+	dial   func(addr string) (net.Conn, error)
+
+	active  int32
+	tunnels *int32
+	release func()
+
+	l      sync.Mutex
+	conns  map[net.Conn]struct{}
+	closed bool
+	wg     sync.WaitGroup
+	done   chan struct{}
+}
+
+func newForwarder(listener net.Listener, target string, dial func(addr string) (net.Conn, error), tunnels *int32, release func()) *Forwarder {
+	f := &Forwarder{
+		listener: listener,
+		target:   target,
+		dial:     dial,
+		tunnels:  tunnels,
+		release:  release,
+		conns:    map[net.Conn]struct{}{},
+		done:     make(chan struct{}),
+	}
+	go f.serve()
+	return f
+}
+
+// ForwardLocal listens on localAddr and forwards every connection to
+// remoteAddr as seen from the remote host, like ssh -L.
+func (r *RemoteClient) ForwardLocal(localAddr, remoteAddr string) (*Forwarder, error) {
+	client, release, err := r.pool.Hold(r.ServerInfo)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("listen local %s fail:%w", localAddr, err)
+	}
+	return newForwarder(l, remoteAddr, func(addr string) (net.Conn, error) {
+		return client.Dial("tcp", addr)
+	}, &r.tunnels, release), nil
+}
+
+// ForwardRemote listens on remoteAddr of the remote host and forwards every
+// connection to localAddr, like ssh -R.
+func (r *RemoteClient) ForwardRemote(remoteAddr, localAddr string) (*Forwarder, error) {
+	client, release, err := r.pool.Hold(r.ServerInfo)
+	if err != nil {
+		return nil, err
+	}
+	l, err := client.Listen("tcp", remoteAddr)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("listen remote %s fail:%w", remoteAddr, err)
+	}
+	return newForwarder(l, localAddr, func(addr string) (net.Conn, error) {
+		return net.Dial("tcp", addr)
+	}, &r.tunnels, release), nil
+}
+
+// ForwardDynamic runs a SOCKS5 proxy on localAddr whose connections are
+// dialed from the remote host, like ssh -D.
+func (r *RemoteClient) ForwardDynamic(localAddr string) (*Forwarder, error) {
+	client, release, err := r.pool.Hold(r.ServerInfo)
+	if err != nil {
+		return nil, err
+	}
+	l, err := net.Listen("tcp", localAddr)
+	if err != nil {
+		release()
+		return nil, fmt.Errorf("listen local %s fail:%w", localAddr, err)
+	}
+	return newForwarder(l, "", func(addr string) (net.Conn, error) {
+		return client.Dial("tcp", addr)
+	}, &r.tunnels, release), nil
+}
+
+// ActiveTunnels returns the open connections of all forwarders of r.
+func (r *RemoteClient) ActiveTunnels() int {
+	return int(atomic.LoadInt32(&r.tunnels))
+}
+
+// Addr returns the listening address.
+func (f *Forwarder) Addr() net.Addr {
+	return f.listener.Addr()
+}
+
+// Active returns the open connections of f.
+func (f *Forwarder) Active() int {
+	return int(atomic.LoadInt32(&f.active))
+}
+
+// Close stops listening, closes the open connections and waits for them.
+func (f *Forwarder) Close() error {
+	err := f.listener.Close()
+	<-f.done
+	if errors.Is(err, net.ErrClosed) {
+		return nil
+	}
+	return err
+}
+
+func (f *Forwarder) serve() {
+	defer close(f.done)
+
+	for {
+		conn, err := f.listener.Accept()
+		if err != nil {
+			break
+		}
+		if !f.track(conn) {
+			conn.Close()
+			break
+		}
+		f.wg.Add(1)
+		go f.handle(conn)
+	}
+
+	// the listener is closed by Close or by the ssh connection going away
+	f.l.Lock()
+	f.closed = true
+	for c := range f.conns {
+		c.Close()
+	}
+	f.l.Unlock()
+
+	f.wg.Wait()
+	if f.release != nil {
+		f.release()
+	}
+}
+
+func (f *Forwarder) track(c net.Conn) bool {
+	f.l.Lock()
+	defer f.l.Unlock()
+	if f.closed {
+		return false
+	}
+	f.conns[c] = struct{}{}
+	return true
+}
+
+func (f *Forwarder) untrack(c net.Conn) {
+	f.l.Lock()
+	delete(f.conns, c)
+	f.l.Unlock()
+	c.Close()
+}
+
+func (f *Forwarder) handle(conn net.Conn) {
+	defer f.wg.Done()
+	defer f.untrack(conn)
+
+	target := f.target
+	socks := target == ""
+	if socks {
+		var code byte
+		target, code = socks5Handshake(conn)
+		if code == socks5NoReply {
+			return
+		}
+		if code != socks5Succeeded {
+			socks5Reply(conn, code)
+			return
+		}
+	}
+
+	remote, err := f.dial(target)
+	if err != nil {
+		log.Printf("forward to %s fail:%s", target, err)
+		if socks {
+			socks5Reply(conn, socks5HostUnreachable)
+		}
+		return
+	}
+	if !f.track(remote) {
+		remote.Close()
+		return
+	}
+	defer f.untrack(remote)
+
+	if socks {
+		if err = socks5Reply(conn, socks5Succeeded); err != nil {
+			return
+		}
+	}
+
+	atomic.AddInt32(&f.active, 1)
+	atomic.AddInt32(f.tunnels, 1)
+	defer atomic.AddInt32(f.tunnels, -1)
+	defer atomic.AddInt32(&f.active, -1)
+
+	pipe(conn, remote)
+}
+
+type closeWriter interface {
+	CloseWrite() error
+}
+
+// pipe copies both directions until both are done, each side is half closed
+// when its source reaches EOF.
+func pipe(a, b net.Conn) {
+	var wg sync.WaitGroup
+	cp := func(dst, src net.Conn) {
+		defer wg.Done()
+		io.Copy(dst, src)
+		if cw, ok := dst.(closeWriter); ok {
+			cw.CloseWrite()
+		} else {
+			dst.Close()
+		}
+	}
+
+	wg.Add(2)
+	go cp(a, b)
+	go cp(b, a)
+	wg.Wait()
+}
+
+// socks5Handshake reads the greeting and the CONNECT request of a no auth
+// SOCKS5 client, and returns the requested address or a failure reply code,
+// socks5NoReply when it failed before the request.
+func socks5Handshake(conn net.Conn) (string, byte) {
+	buf := make([]byte, 258)
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil || buf[0] != socks5Version {
+		return "", socks5NoReply
+	}
+	methods := buf[2 : 2+int(buf[1])]
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", socks5NoReply
+	}
+	// only "no authentication required" is supported
+	if bytes.IndexByte(methods, socks5NoAuth) < 0 {
+		conn.Write([]byte{socks5Version, socks5NoAcceptable})
+		return "", socks5NoReply
+	}
+	if _, err := conn.Write([]byte{socks5Version, socks5NoAuth}); err != nil {
+		return "", socks5NoReply
+	}
+
+	if _, err := io.ReadFull(conn, buf[:4]); err != nil || buf[0] != socks5Version {
+		return "", socks5NoReply
+	}
+	if buf[1] != socks5Connect {
+		return "", socks5CommandNotSupported
+	}
+
+	var host string
+	switch buf[3] {
+	case socks5IPv4:
+		if _, err := io.ReadFull(conn, buf[:net.IPv4len]); err != nil {
+			return "", socks5AddrNotSupported
+		}
+		host = net.IP(buf[:net.IPv4len]).String()
+	case socks5IPv6:
+		if _, err := io.ReadFull(conn, buf[:net.IPv6len]); err != nil {
+			return "", socks5AddrNotSupported
+		}
+		host = net.IP(buf[:net.IPv6len]).String()
+	case socks5Domain:
+		if _, err := io.ReadFull(conn, buf[:1]); err != nil {
+			return "", socks5AddrNotSupported
+		}
+		n := int(buf[0])
+		if _, err := io.ReadFull(conn, buf[:n]); err != nil {
+			return "", socks5AddrNotSupported
+		}
+		host = string(buf[:n])
+	default:
+		return "", socks5AddrNotSupported
+	}
+
+	if _, err := io.ReadFull(conn, buf[:2]); err != nil {
+		return "", socks5AddrNotSupported
+	}
+	port := binary.BigEndian.Uint16(buf[:2])
+	return net.JoinHostPort(host, strconv.Itoa(int(port))), socks5Succeeded
+}
+
+// socks5Reply answers a CONNECT request, the bound address is always 0.0.0.0:0.
+func socks5Reply(conn net.Conn, code byte) error {
+	_, err := conn.Write([]byte{socks5Version, code, 0x00, socks5IPv4, 0, 0, 0, 0, 0, 0})
+	return err
+}
@@ -0,0 +1,220 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func echoServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				io.Copy(conn, conn)
+				conn.Close()
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func newTestForwarder(t *testing.T, target string) (*Forwarder, *int32, *bool) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tunnels int32
+	released := false
+	f := newForwarder(l, target, func(addr string) (net.Conn, error) {
+		return net.Dial("tcp", addr)
+	}, &tunnels, func() { released = true })
+	return f, &tunnels, &released
+}
+
+func waitActive(f *Forwarder, n int) bool {
+	for i := 0; i < 100; i++ {
+		if f.Active() == n {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestForwarder(t *testing.T) {
+	f, tunnels, released := newTestForwarder(t, echoServer(t))
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Write([]byte("hello\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "hello\n" {
+		t.Fatalf("except echo, actual %q %v", line, err)
+	}
+	if !waitActive(f, 1) || atomic.LoadInt32(tunnels) != 1 {
+		t.Errorf("except 1 active tunnel, actual %d", f.Active())
+	}
+
+	if err = f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if f.Active() != 0 || atomic.LoadInt32(tunnels) != 0 || !*released {
+		t.Errorf("close should drop all tunnels, active:%d released:%v", f.Active(), *released)
+	}
+	if _, err = conn.Read(make([]byte, 1)); err == nil {
+		t.Error("connection should be closed")
+	}
+}
+
+func TestForwarderSocks5(t *testing.T) {
+	target := echoServer(t)
+	f, _, _ := newTestForwarder(t, "")
+	defer f.Close()
+
+	conn, err := net.Dial("tcp", f.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	host, port, _ := net.SplitHostPort(target)
+	p, _ := net.LookupPort("tcp", port)
+	req := []byte{socks5Version, 1, 0x00, socks5Version, socks5Connect, 0x00, socks5Domain, byte(len(host))}
+	req = append(req, host...)
+	req = append(req, byte(p>>8), byte(p))
+	conn.Write(req)
+
+	resp := make([]byte, 12)
+	if _, err = io.ReadFull(conn, resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp[0] != socks5Version || resp[1] != 0x00 || resp[3] != socks5Succeeded {
+		t.Fatalf("unexpected socks5 response %v", resp)
+	}
+
+	conn.Write([]byte("ping\n"))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	if err != nil || line != "ping\n" {
+		t.Errorf("except echo through socks5, actual %q %v", line, err)
+	}
+}
+
+func TestForwarderSocks5Rejected(t *testing.T) {
+	f, _, _ := newTestForwarder(t, "")
+	defer f.Close()
+
+	cases := map[string]struct {
+		greeting []byte
+		except   []byte
+	}{
+		// only username/password is offered
+		"no acceptable method": {[]byte{socks5Version, 1, 0x02}, []byte{socks5Version, socks5NoAcceptable}},
+		"socks4":               {[]byte{0x04, 0x01, 0x00, 0x50}, []byte{}},
+	}
+	for name, c := range cases {
+		conn, err := net.Dial("tcp", f.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Write(c.greeting)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		// the server may reset the connection since the greeting is not read completely
+		resp, err := io.ReadAll(conn)
+		conn.Close()
+		if ne, ok := err.(net.Error); (ok && ne.Timeout()) || !bytes.Equal(resp, c.except) {
+			t.Errorf("%s except %v and close, actual %v %v", name, c.except, resp, err)
+		}
+	}
+}
+
+func TestForwardThroughServer(t *testing.T) {
+	_, client := newTestClient(t, nil)
+	target := echoServer(t)
+
+	echo := func(addr string) string {
+		conn, err := net.Dial("tcp", addr)
+		if err != nil {
+			return err.Error()
+		}
+		defer conn.Close()
+		conn.Write([]byte("ping\n"))
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		return line
+	}
+
+	local, err := client.ForwardLocal("127.0.0.1:0", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer local.Close()
+	if line := echo(local.Addr().String()); line != "ping\n" {
+		t.Errorf("local forward %q", line)
+	}
+
+	remote, err := client.ForwardRemote("127.0.0.1:0", target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer remote.Close()
+	if line := echo(remote.Addr().String()); line != "ping\n" {
+		t.Errorf("remote forward %q", line)
+	}
+}
+
+func TestJumpHosts(t *testing.T) {
+	bastion, bastionInfo := newTestServer(t, nil)
+	_, info := newTestServer(t, nil)
+	info.JumpHosts = []*ServerInfo{bastionInfo}
+
+	pool := NewPool(nil)
+	defer pool.Close()
+	client, err := NewRemoteClientWithPool(info, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, err := client.Exec("echo jumped"); err != nil || r != "jumped\n" {
+		t.Errorf("exec through jump host %q %v", r, err)
+	}
+	if bastion.Dialed() != 1 {
+		t.Errorf("except the bastion dialed once, actual %d", bastion.Dialed())
+	}
+}
+
+func TestJumpHostsPoolKey(t *testing.T) {
+	bastion1, bastion1Info := newTestServer(t, nil)
+	bastion2, bastion2Info := newTestServer(t, nil)
+	_, info := newTestServer(t, nil)
+
+	// the same target address behind two bastions must not share a connection
+	pool := NewPool(nil)
+	defer pool.Close()
+	for _, bastion := range []*ServerInfo{bastion1Info, bastion2Info} {
+		target := *info
+		target.JumpHosts = []*ServerInfo{bastion}
+		client, err := NewRemoteClientWithPool(&target, pool)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r, err := client.Exec("echo jumped"); err != nil || r != "jumped\n" {
+			t.Errorf("exec through %s %q %v", PoolKey(bastion), r, err)
+		}
+	}
+	if bastion1.Dialed() != 1 || bastion2.Dialed() != 1 {
+		t.Errorf("except each bastion dialed once, actual %d %d", bastion1.Dialed(), bastion2.Dialed())
+	}
+}
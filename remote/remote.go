@@ -1,11 +1,10 @@
 package remote
 
 import (
+	"context"
 	"fmt"
-	"io"
-	"os"
+	"log"
 	"path"
-	"strings"
 	"time"
 )
 
@@ -15,29 +14,55 @@ type ServerInfo struct {
 	Key      string
 	Host     string
 	Port     int
+	// HostKey verifies the host key. When nil any key is accepted and a warning
+	// is logged once per host, use InsecureIgnoreHostKey() to opt in explicitly.
+	HostKey HostKeyPolicy
+	// Auth are tried in order, Password and Key are used when it is empty
+	Auth []AuthProvider
+	// JumpHosts are the bastions dialed in order before Host, like ssh -J
+	JumpHosts []*ServerInfo
+	// Name is the inventory name of the host
+	Name string
+	// Vars are the inventory variables of the host
+	Vars map[string]string
 }
 
 type RemoteClient struct {
 	*ServerInfo
+	pool *Pool
+	// tunnels counts the open connections of all forwarders
+	tunnels int32
 }
 
 func NewRemoteClient(info *ServerInfo) (*RemoteClient, error) {
-	_, err := GetSSHClient(info)
+	return NewRemoteClientWithPool(info, DefaultPool())
+}
+
+// NewRemoteClientWithPool creates a RemoteClient whose connections are kept in pool.
+func NewRemoteClientWithPool(info *ServerInfo, pool *Pool) (*RemoteClient, error) {
+	_, err := pool.Client(info)
 	if err != nil {
 		return nil, err
 	}
 	rclient := &RemoteClient{
 		ServerInfo: info,
+		pool:       pool,
 	}
 	return rclient, nil
 }
 
 func (r *RemoteClient) Exec(cmd string) (string, error) {
-	closeSftpClient(r.Host)
+	return r.ExecContext(context.Background(), cmd)
+}
+
+// ExecContext runs cmd and kills the remote process when ctx is done.
+func (r *RemoteClient) ExecContext(ctx context.Context, cmd string, opts ...ExecOption) (string, error) {
+	event := &AuditEvent{Type: AuditExec, Command: cmd, Start: time.Now()}
 
-	session, err := GetSession(r.ServerInfo)
+	session, err := r.pool.Session(r.ServerInfo)
 	if err != nil {
-		err = fmt.Errorf("get session err:%s", err.Error())
+		err = fmt.Errorf("get session err:%w", err)
+		r.audit(ctx, event, err)
 		return "", err
 	}
 	obj := NewCusReaderWithSession(r.ServerInfo, session)
@@ -47,177 +72,75 @@ func (r *RemoteClient) Exec(cmd string) (string, error) {
 	session.Stdout = obj
 	session.Stderr = obj
 
-	err = session.Run(cmd)
+	err = runSession(ctx, session.Session, cmd, newExecOptions(opts))
+	event.Bytes = int64(obj.contBuf.Len())
+	if ctx.Err() != nil {
+		err = ctxErr(ctx)
+		r.audit(ctx, event, err)
+		return "", err
+	}
 	if err != nil {
-		return "", fmt.Errorf("%s%s", obj.contBuf.String(), err.Error())
+		event.ExitCode = exitCode(err)
+		r.audit(ctx, event, err)
+		return "", exitError(r.Host, cmd, obj.contBuf.String(), err)
 	}
+	r.audit(ctx, event, nil)
 	return obj.contBuf.String(), nil
 }
 
 func (r *RemoteClient) ExecWithTimeout(cmd string, t time.Duration) (string, error) {
-	var result string
-	var err error
-
-	done := make(chan bool)
-	go func() {
-		result, err = r.Exec(cmd)
-		done <- true
-	}()
+	ctx, cancel := context.WithTimeout(context.Background(), t)
+	defer cancel()
 
-	select {
-	case <-time.After(t):
-		r.Close()
-		return "", fmt.Errorf("exec timeout")
-	case <-done:
-		return result, err
-	}
+	return r.ExecContext(ctx, cmd)
 }
 
 func (r *RemoteClient) ScpFile(file string, remoteFile string) error {
-	sclient, err := GetSftpClient(r.ServerInfo)
-
-	if err != nil {
-		return err
-	}
-
-	f, err := os.Open(file)
-	if err != nil {
-		return fmt.Errorf("read file:%s fail:%s", file, err)
-	}
-	defer f.Close()
-
-	if err = sclient.MkdirAll(path.Dir(remoteFile)); err != nil {
-		return fmt.Errorf("create remote dir(%s) fail:%s", path.Dir(remoteFile), err)
-	}
-
-	dsf, err := sclient.Create(remoteFile)
-	if err != nil {
-		return fmt.Errorf("create remote file fail:%s", err)
-	}
-	defer dsf.Close()
-
-	io.Copy(dsf, f)
-	return nil
+	return r.ScpFileContext(context.Background(), file, remoteFile, nil)
 }
 
 func (r *RemoteClient) ScpDir(localDir, remoteDir string) error {
-	sclient, err := GetSftpClient(r.ServerInfo)
-
-	if err != nil {
-		return err
-	}
-
-	localDir = strings.TrimRight(localDir, "/")
-	remoteDir = strings.TrimRight(remoteDir, "/")
-
-	dir, err := os.ReadDir(localDir)
-	if err != nil {
-		return err
-	}
-
-	sclient.MkdirAll(remoteDir)
-	for _, f := range dir {
-		rf := fmt.Sprintf("%s/%s", remoteDir, f.Name())
-		lf := fmt.Sprintf("%s/%s", localDir, f.Name())
-
-		if f.IsDir() {
-			sclient.MkdirAll(rf)
-			if err = r.ScpDir(lf, rf); err != nil {
-				return err
-			}
-			continue
-		}
-		if err = r.ScpFile(lf, rf); err != nil {
-			return err
-		}
-	}
-	return nil
+	return r.ScpDirContext(context.Background(), localDir, remoteDir, nil)
 }
 
 func (r *RemoteClient) CopyFile(localFile string, remoteFile string) error {
-	sclient, err := GetSftpClient(r.ServerInfo)
-	if err != nil {
-		return err
-	}
-
-	rf, err := sclient.OpenFile(remoteFile, os.O_RDONLY)
-	if err != nil {
-		return fmt.Errorf("remote read file %s fail:%s", remoteFile, err)
-	}
-
-	b, err := io.ReadAll(rf)
-	if err != nil {
-		return err
-	}
-
-	if err := os.MkdirAll(path.Dir(localFile), os.ModePerm.Perm()); err != nil {
-		return err
-	}
-
-	lf, err := os.OpenFile(localFile, os.O_RDWR|os.O_CREATE, 0644)
-	if err != nil {
-		return fmt.Errorf("create or read local file %s fail:%s", localFile, err)
-	}
-	defer lf.Close()
-
-	lf.Write(b)
-	return nil
+	return r.CopyFileContext(context.Background(), localFile, remoteFile, nil)
 }
 
 func (r *RemoteClient) CopyDir(localDir, remoteDir string) error {
-	sclient, err := GetSftpClient(r.ServerInfo)
-	if err != nil {
-		return err
-	}
-
-	dir, err := sclient.ReadDir(remoteDir)
-	if err != nil {
-		return err
-	}
-
-	if err := os.MkdirAll(localDir, os.ModePerm.Perm()); err != nil {
-		return err
-	}
-	for _, f := range dir {
-		rf := fmt.Sprintf("%s/%s", remoteDir, f.Name())
-		lf := fmt.Sprintf("%s/%s", localDir, f.Name())
-
-		if f.IsDir() {
-			if err := os.MkdirAll(lf, os.ModePerm.Perm()); err != nil {
-				return err
-			}
-
-			if err = r.CopyDir(lf, rf); err != nil {
-				return err
-			}
-			continue
-		}
-		if err := r.CopyFile(lf, rf); err != nil {
-			return err
-		}
-	}
-	return nil
+	return r.CopyDirContext(context.Background(), localDir, remoteDir, nil)
 }
 
 func (r *RemoteClient) UseBashExecScript(remoteFile, script string) (string, error) {
-	sclient, err := GetSftpClient(r.ServerInfo)
+	sclient, err := r.pool.Sftp(r.ServerInfo)
 	if err != nil {
 		return "", err
 	}
 
 	if err := sclient.MkdirAll(path.Dir(remoteFile)); err != nil {
-		return "", fmt.Errorf("create remote dir(%s) fail:%s", path.Dir(remoteFile), err)
+		return "", fmt.Errorf("create remote dir(%s) fail:%w", path.Dir(remoteFile), err)
 	}
 
+	event := &AuditEvent{Type: AuditUpload, RemoteFile: remoteFile, Bytes: int64(len(script)), Start: time.Now()}
 	dsf, err := sclient.Create(remoteFile)
 	if err != nil {
-		return "", fmt.Errorf("create remote file fail:%s", err)
+		err = fmt.Errorf("create remote file fail:%w", err)
+		r.audit(context.Background(), event, err)
+		return "", err
+	}
+	defer func() {
+		if err := sclient.Remove(remoteFile); err != nil {
+			log.Printf("remove remote file(%s) fail:%s", remoteFile, err)
+		}
+	}()
+	err = uploadScript(dsf, script)
+	r.audit(context.Background(), event, err)
+	if err != nil {
+		return "", err
 	}
-	dsf.Write([]byte(script))
-	return r.Exec("sh " + remoteFile)
+	return r.Exec("sh " + shellQuote(remoteFile))
 }
 
 func (r *RemoteClient) Close() {
-	closeSftpClient(r.Host)
-	closeClient(r.Host)
+	r.pool.Remove(r.ServerInfo)
 }
@@ -0,0 +1,620 @@
+package remote
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"os/user"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+const (
+	inventoryAll       = "all"
+	inventoryUngrouped = "ungrouped"
+)
+
+// InventoryGroup is a group of an Ansible style inventory.
+type InventoryGroup struct {
+	Name     string
+	Hosts    []string
+	Children []string
+	Vars     map[string]string
+}
+
+// Inventory is an Ansible style inventory, host variables are resolved with
+// the same precedence: all, parent groups, child groups, then the host itself.
+type Inventory struct {
+	hosts  map[string]map[string]string
+	order  []string
+	groups map[string]*InventoryGroup
+	// hostGroups are the groups of every host in the order their vars apply,
+	// resolved once after parsing
+	hostGroups map[string][]string
+}
+
+func newInventory() *Inventory {
+	return &Inventory{
+		hosts:  map[string]map[string]string{},
+		groups: map[string]*InventoryGroup{},
+	}
+}
+
+// LoadInventory reads an inventory file, .yaml and .yml files are parsed as
+// YAML and the others as INI.
+func LoadInventory(file string) (*Inventory, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		return ParseInventoryYAML(data)
+	default:
+		return ParseInventoryINI(data)
+	}
+}
+
+func (inv *Inventory) group(name string) *InventoryGroup {
+	g, ok := inv.groups[name]
+	if !ok {
+		g = &InventoryGroup{Name: name, Vars: map[string]string{}}
+		inv.groups[name] = g
+	}
+	return g
+}
+
+func (inv *Inventory) addHost(group, host string, vars map[string]string) {
+	hv, ok := inv.hosts[host]
+	if !ok {
+		hv = map[string]string{}
+		inv.hosts[host] = hv
+		inv.order = append(inv.order, host)
+	}
+	for k, v := range vars {
+		hv[k] = v
+	}
+
+	g := inv.group(group)
+	for _, h := range g.Hosts {
+		if h == host {
+			return
+		}
+	}
+	g.Hosts = append(g.Hosts, host)
+}
+
+func (inv *Inventory) addChild(parent, child string) {
+	inv.group(child)
+	g := inv.group(parent)
+	for _, c := range g.Children {
+		if c == child {
+			return
+		}
+	}
+	g.Children = append(g.Children, child)
+}
+
+// ParseInventoryINI parses an Ansible INI inventory with [group],
+// [group:vars] and [group:children] sections, hosts before the first section
+// are ungrouped.
+func ParseInventoryINI(data []byte) (*Inventory, error) {
+	inv := newInventory()
+	section, kind := inventoryUngrouped, ""
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || line[0] == '#' || line[0] == ';' {
+			continue
+		}
+
+		if line[0] == '[' {
+			if !strings.HasSuffix(line, "]") {
+				return nil, fmt.Errorf("inventory line %d: invalid section %s", n, line)
+			}
+			section, kind = line[1:len(line)-1], ""
+			if i := strings.LastIndex(section, ":"); i > 0 {
+				section, kind = section[:i], section[i+1:]
+			}
+			if kind != "" && kind != "vars" && kind != "children" {
+				return nil, fmt.Errorf("inventory line %d: unknown section type %s", n, kind)
+			}
+			inv.group(section)
+			continue
+		}
+
+		switch kind {
+		case "vars":
+			k, v, ok := strings.Cut(line, "=")
+			if !ok {
+				return nil, fmt.Errorf("inventory line %d: invalid var %s", n, line)
+			}
+			inv.group(section).Vars[strings.TrimSpace(k)] = unquote(strings.TrimSpace(v))
+		case "children":
+			inv.addChild(section, line)
+		default:
+			fields, err := splitInventoryLine(line)
+			if err != nil {
+				return nil, fmt.Errorf("inventory line %d: %s", n, err)
+			}
+			vars := map[string]string{}
+			for _, f := range fields[1:] {
+				k, v, ok := strings.Cut(f, "=")
+				if !ok {
+					return nil, fmt.Errorf("inventory line %d: invalid host var %s", n, f)
+				}
+				vars[k] = v
+			}
+			hosts, err := expandHostRange(fields[0])
+			if err != nil {
+				return nil, fmt.Errorf("inventory line %d: %s", n, err)
+			}
+			for _, h := range hosts {
+				inv.addHost(section, h, vars)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	inv.resolve()
+	return inv, nil
+}
+
+type yamlInventoryGroup struct {
+	Hosts    map[string]map[string]interface{} `json:"hosts"`
+	Vars     map[string]interface{}            `json:"vars"`
+	Children map[string]*yamlInventoryGroup    `json:"children"`
+}
+
+// ParseInventoryYAML parses an Ansible YAML inventory, the hosts are ordered by name.
+func ParseInventoryYAML(data []byte) (*Inventory, error) {
+	root := map[string]*yamlInventoryGroup{}
+	if err := yaml.Unmarshal(data, &root); err != nil {
+		return nil, fmt.Errorf("parse inventory fail:%s", err)
+	}
+
+	inv := newInventory()
+	var walk func(name string, g *yamlInventoryGroup) error
+	walk = func(name string, g *yamlInventoryGroup) error {
+		group := inv.group(name)
+		if g == nil {
+			return nil
+		}
+		for k, v := range g.Vars {
+			group.Vars[k] = fmt.Sprint(v)
+		}
+		for host, hv := range g.Hosts {
+			hosts, err := expandHostRange(host)
+			if err != nil {
+				return err
+			}
+			vars := map[string]string{}
+			for k, v := range hv {
+				vars[k] = fmt.Sprint(v)
+			}
+			for _, h := range hosts {
+				inv.addHost(name, h, vars)
+			}
+		}
+		for child, cg := range g.Children {
+			inv.addChild(name, child)
+			if err := walk(child, cg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	for name, g := range root {
+		if err := walk(name, g); err != nil {
+			return nil, err
+		}
+	}
+
+	sort.Strings(inv.order)
+	for _, g := range inv.groups {
+		sort.Strings(g.Hosts)
+		sort.Strings(g.Children)
+	}
+	inv.resolve()
+	return inv, nil
+}
+
+// expandHostRange expands a numeric range like web[01:03], keeping the zero padding.
+func expandHostRange(host string) ([]string, error) {
+	start := strings.Index(host, "[")
+	if start < 0 {
+		return []string{host}, nil
+	}
+	end := strings.Index(host[start:], "]")
+	if end < 0 {
+		return nil, fmt.Errorf("invalid host range %s", host)
+	}
+	end += start
+
+	from, to, ok := strings.Cut(host[start+1:end], ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid host range %s", host)
+	}
+	a, err1 := strconv.Atoi(from)
+	b, err2 := strconv.Atoi(to)
+	if err1 != nil || err2 != nil || a > b {
+		return nil, fmt.Errorf("invalid host range %s", host)
+	}
+
+	format := "%d"
+	if len(from) > 1 && from[0] == '0' {
+		format = "%0" + strconv.Itoa(len(from)) + "d"
+	}
+	hosts := make([]string, 0, b-a+1)
+	for i := a; i <= b; i++ {
+		rest, err := expandHostRange(host[end+1:])
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rest {
+			hosts = append(hosts, host[:start]+fmt.Sprintf(format, i)+r)
+		}
+	}
+	return hosts, nil
+}
+
+// splitInventoryLine splits a host line like a POSIX shell: single and double
+// quotes keep spaces and are removed, a backslash escapes the next character
+// outside single quotes.
+func splitInventoryLine(line string) ([]string, error) {
+	var (
+		fields []string
+		field  strings.Builder
+		quote  rune
+		inWord bool
+		escape bool
+	)
+	for _, c := range line {
+		switch {
+		case escape:
+			if quote == '"' && c != '"' && c != '\\' {
+				field.WriteRune('\\')
+			}
+			field.WriteRune(c)
+			escape = false
+		case c == '\\' && quote != '\'':
+			escape, inWord = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				field.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, inWord = c, true
+		case c == ' ' || c == '\t':
+			if inWord {
+				fields = append(fields, field.String())
+				field.Reset()
+				inWord = false
+			}
+		default:
+			field.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 || escape {
+		return nil, fmt.Errorf("unterminated quote or escape in %s", line)
+	}
+	if inWord {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// expandHome expands a leading ~ or ~user of file to the home dir on the
+// local machine, like Ansible does for ansible_ssh_private_key_file.
+func expandHome(file string) (string, error) {
+	if !strings.HasPrefix(file, "~") {
+		return file, nil
+	}
+	name, rest, _ := strings.Cut(file[1:], "/")
+	var home string
+	if name == "" {
+		dir, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		home = dir
+	} else {
+		u, err := user.Lookup(name)
+		if err != nil {
+			return "", err
+		}
+		home = u.HomeDir
+	}
+	return filepath.Join(home, rest), nil
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') && s[len(s)-1] == s[0] {
+		return s[1 : len(s)-1]
+	}
+	return s
+}
+
+// Groups returns the group names, sorted.
+func (inv *Inventory) Groups() []string {
+	names := make([]string, 0, len(inv.groups))
+	for name := range inv.groups {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Group returns the group of name, nil if it does not exist.
+func (inv *Inventory) Group(name string) *InventoryGroup {
+	return inv.groups[name]
+}
+
+// groupHosts returns the hosts of the group and of its children.
+func (inv *Inventory) groupHosts(name string) map[string]bool {
+	hosts := map[string]bool{}
+	if name == inventoryAll {
+		for _, h := range inv.order {
+			hosts[h] = true
+		}
+		return hosts
+	}
+
+	seen := map[string]bool{}
+	var walk func(name string)
+	walk = func(name string) {
+		g, ok := inv.groups[name]
+		if !ok || seen[name] {
+			return
+		}
+		seen[name] = true
+		for _, h := range g.Hosts {
+			hosts[h] = true
+		}
+		for _, c := range g.Children {
+			walk(c)
+		}
+	}
+	walk(name)
+	return hosts
+}
+
+// groupDepth returns the distance of every group from all, the vars of
+// deeper groups override the shallower ones.
+func (inv *Inventory) groupDepth() map[string]int {
+	parents := map[string][]string{}
+	for name, g := range inv.groups {
+		for _, c := range g.Children {
+			if name != inventoryAll {
+				parents[c] = append(parents[c], name)
+			}
+		}
+	}
+
+	depth := map[string]int{inventoryAll: 0}
+	var walk func(name string, visiting map[string]bool) int
+	walk = func(name string, visiting map[string]bool) int {
+		if d, ok := depth[name]; ok {
+			return d
+		}
+		if visiting[name] {
+			return 1
+		}
+		visiting[name] = true
+		d := 1
+		for _, p := range parents[name] {
+			if pd := walk(p, visiting) + 1; pd > d {
+				d = pd
+			}
+		}
+		depth[name] = d
+		return d
+	}
+	for name := range inv.groups {
+		walk(name, map[string]bool{})
+	}
+	return depth
+}
+
+// resolve computes the groups of every host, ordered by their depth from all.
+func (inv *Inventory) resolve() {
+	depth := inv.groupDepth()
+	groups := make([]string, 0, len(inv.groups))
+	for name := range inv.groups {
+		groups = append(groups, name)
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if depth[groups[i]] != depth[groups[j]] {
+			return depth[groups[i]] < depth[groups[j]]
+		}
+		return groups[i] < groups[j]
+	})
+
+	inv.hostGroups = make(map[string][]string, len(inv.hosts))
+	for _, name := range groups {
+		if name == inventoryAll {
+			continue
+		}
+		for h := range inv.groupHosts(name) {
+			inv.hostGroups[h] = append(inv.hostGroups[h], name)
+		}
+	}
+	if _, ok := inv.groups[inventoryAll]; ok {
+		for _, h := range inv.order {
+			inv.hostGroups[h] = append([]string{inventoryAll}, inv.hostGroups[h]...)
+		}
+	}
+}
+
+// Vars returns the resolved variables of host.
+func (inv *Inventory) Vars(host string) map[string]string {
+	hv, ok := inv.hosts[host]
+	if !ok {
+		return nil
+	}
+
+	vars := map[string]string{}
+	for _, name := range inv.hostGroups[host] {
+		for k, v := range inv.groups[name].Vars {
+			vars[k] = v
+		}
+	}
+	for k, v := range hv {
+		vars[k] = v
+	}
+	return vars
+}
+
+// Host returns the ServerInfo of host built from its ansible_* variables.
+func (inv *Inventory) Host(host string) (*ServerInfo, error) {
+	vars := inv.Vars(host)
+	if vars == nil {
+		return nil, fmt.Errorf("host %s not found in inventory", host)
+	}
+
+	info := &ServerInfo{Name: host, Host: host, Vars: vars}
+	if v := firstVar(vars, "ansible_host", "ansible_ssh_host"); v != "" {
+		info.Host = v
+	}
+	if v := firstVar(vars, "ansible_port", "ansible_ssh_port"); v != "" {
+		port, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("host %s invalid port %s", host, v)
+		}
+		info.Port = port
+	}
+	info.User = firstVar(vars, "ansible_user", "ansible_ssh_user")
+	info.Password = firstVar(vars, "ansible_password", "ansible_ssh_pass")
+	if v := firstVar(vars, "ansible_ssh_private_key_file", "ansible_private_key_file"); v != "" {
+		file, err := expandHome(v)
+		if err != nil {
+			return nil, fmt.Errorf("host %s invalid private key file %s:%s", host, v, err)
+		}
+		info.Auth = []AuthProvider{PrivateKeyAuth(FileSecret(file), nil)}
+		if info.Password != "" {
+			info.Auth = append(info.Auth, PasswordAuth(StaticSecret(info.Password)))
+		}
+	}
+	return info, nil
+}
+
+func firstVar(vars map[string]string, keys ...string) string {
+	for _, k := range keys {
+		if v, ok := vars[k]; ok {
+			return v
+		}
+	}
+	return ""
+}
+
+// Select returns the hosts matched by pattern in inventory order. Like
+// Ansible, terms are separated by ':' or ',', a term is a group, a host, a
+// glob of them or key=value matched against the host variables, '&' prefix
+// intersects and '!' prefix excludes.
+func (inv *Inventory) Select(pattern string) ([]*ServerInfo, error) {
+	terms := strings.FieldsFunc(pattern, func(r rune) bool { return r == ':' || r == ',' })
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("empty inventory pattern")
+	}
+
+	union := map[string]bool{}
+	intersect := make([]map[string]bool, 0)
+	exclude := map[string]bool{}
+	for _, term := range terms {
+		term = strings.TrimSpace(term)
+		switch {
+		case strings.HasPrefix(term, "&"):
+			intersect = append(intersect, inv.match(term[1:]))
+		case strings.HasPrefix(term, "!"):
+			for h := range inv.match(term[1:]) {
+				exclude[h] = true
+			}
+		default:
+			for h := range inv.match(term) {
+				union[h] = true
+			}
+		}
+	}
+
+	selected := union
+	for _, set := range intersect {
+		for h := range selected {
+			if !set[h] {
+				delete(selected, h)
+			}
+		}
+	}
+	for h := range exclude {
+		delete(selected, h)
+	}
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("pattern %s matches no host", pattern)
+	}
+
+	list := make([]*ServerInfo, 0, len(selected))
+	for _, h := range inv.order {
+		if !selected[h] {
+			continue
+		}
+		info, err := inv.Host(h)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, info)
+	}
+	return list, nil
+}
+
+func (inv *Inventory) match(term string) map[string]bool {
+	if term == "*" {
+		term = inventoryAll
+	}
+	if _, ok := inv.groups[term]; ok || term == inventoryAll {
+		return inv.groupHosts(term)
+	}
+
+	hosts := map[string]bool{}
+	if k, v, ok := strings.Cut(term, "="); ok {
+		for _, h := range inv.order {
+			if ok, _ := path.Match(v, inv.Vars(h)[k]); ok {
+				hosts[h] = true
+			}
+		}
+		return hosts
+	}
+
+	for _, h := range inv.order {
+		if ok, _ := path.Match(term, h); ok {
+			hosts[h] = true
+		}
+	}
+	for name := range inv.groups {
+		if ok, _ := path.Match(term, name); ok {
+			for h := range inv.groupHosts(name) {
+				hosts[h] = true
+			}
+		}
+	}
+	return hosts
+}
+
+// NewBatchRemoteClientFromInventory creates a BatchRemoteClient of the hosts
+// of inv matched by pattern.
+func NewBatchRemoteClientFromInventory(inv *Inventory, pattern string) (*BatchRemoteClient, error) {
+	serverList, err := inv.Select(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return NewBatchRemoteClient(serverList)
+}
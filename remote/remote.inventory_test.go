@@ -0,0 +1,249 @@
+package remote
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const iniInventory = `
+bastion ansible_host=10.0.0.1
+
+[web]
+web[01:03] ansible_port=2222
+
+[db]
+db1 ansible_host=10.0.1.1 role=primary
+db2 ansible_host=10.0.1.2 role=replica ansible_user=admin
+
+[db:vars]
+ansible_user=postgres
+
+[prod:children]
+web
+db
+
+[prod:vars]
+ansible_user=deploy
+ansible_ssh_private_key_file=/etc/deploy.key
+
+[all:vars]
+ansible_user=root
+ansible_port=22
+`
+
+const yamlInventory = `
+all:
+  vars:
+    ansible_user: root
+  hosts:
+    bastion:
+      ansible_host: 10.0.0.1
+  children:
+    prod:
+      vars:
+        ansible_user: deploy
+      children:
+        web:
+          hosts:
+            web[01:03]:
+              ansible_port: 2222
+        db:
+          vars:
+            ansible_user: postgres
+          hosts:
+            db1:
+              ansible_host: 10.0.1.1
+              role: primary
+            db2:
+              ansible_host: 10.0.1.2
+              role: replica
+              ansible_user: admin
+`
+
+func hostNames(list []*ServerInfo) []string {
+	names := make([]string, 0, len(list))
+	for _, info := range list {
+		names = append(names, info.Name)
+	}
+	return names
+}
+
+func TestInventory(t *testing.T) {
+	iniInv, err := ParseInventoryINI([]byte(iniInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+	yamlInv, err := ParseInventoryYAML([]byte(yamlInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patterns := map[string][]string{
+		"all":              {"bastion", "db1", "db2", "web01", "web02", "web03"},
+		"prod":             {"db1", "db2", "web01", "web02", "web03"},
+		"web:db":           {"db1", "db2", "web01", "web02", "web03"},
+		"prod:!web":        {"db1", "db2"},
+		"prod:&db":         {"db1", "db2"},
+		"web0[12]":         {"web01", "web02"},
+		"role=primary":     {"db1"},
+		"db,bastion":       {"bastion", "db1", "db2"},
+		"all:!role=r*":     {"bastion", "db1", "web01", "web02", "web03"},
+		"ansible_user=de*": {"web01", "web02", "web03"},
+	}
+	for name, inv := range map[string]*Inventory{"ini": iniInv, "yaml": yamlInv} {
+		for pattern, except := range patterns {
+			list, err := inv.Select(pattern)
+			if err != nil {
+				t.Errorf("%s select %s fail:%s", name, pattern, err)
+				continue
+			}
+			actual := hostNames(list)
+			if name == "ini" {
+				// ini keeps the file order
+				actual = sortedCopy(actual)
+			}
+			if !reflect.DeepEqual(actual, except) {
+				t.Errorf("%s select %s except:%v actual:%v", name, pattern, except, actual)
+			}
+		}
+
+		if _, err = inv.Select("cache"); err == nil {
+			t.Errorf("%s select unknown pattern should fail", name)
+		}
+	}
+}
+
+func TestInventoryHost(t *testing.T) {
+	inv, err := ParseInventoryINI([]byte(iniInventory))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hosts := map[string]ServerInfo{
+		"bastion": {Host: "10.0.0.1", User: "root", Port: 22},
+		"web02":   {Host: "web02", User: "deploy", Port: 2222},
+		"db1":     {Host: "10.0.1.1", User: "postgres", Port: 22},
+		"db2":     {Host: "10.0.1.2", User: "admin", Port: 22},
+	}
+	for name, except := range hosts {
+		info, err := inv.Host(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Name != name || info.Host != except.Host || info.User != except.User || info.Port != except.Port {
+			t.Errorf("host %s except:%+v actual:%+v", name, except, info)
+		}
+	}
+
+	info, _ := inv.Host("db1")
+	if len(info.Auth) != 1 || info.Vars["role"] != "primary" {
+		t.Errorf("db1 should use the prod key, actual auth:%d vars:%v", len(info.Auth), info.Vars)
+	}
+	if _, err = inv.Host("none"); err == nil {
+		t.Error("except unknown host error")
+	}
+}
+
+func TestInventoryQuotedVars(t *testing.T) {
+	inv, err := ParseInventoryINI([]byte(`
+web1 label="web tier" ansible_ssh_common_args='-o ProxyCommand="ssh -W %h:%p bastion"' path=/opt/my\ app
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := inv.Host("web1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	except := map[string]string{
+		"label":                   "web tier",
+		"ansible_ssh_common_args": `-o ProxyCommand="ssh -W %h:%p bastion"`,
+		"path":                    "/opt/my app",
+	}
+	for k, v := range except {
+		if info.Vars[k] != v {
+			t.Errorf("var %s except:%q actual:%q", k, v, info.Vars[k])
+		}
+	}
+
+	if _, err = ParseInventoryINI([]byte(`web1 label="web tier`)); err == nil {
+		t.Error("except unterminated quote error")
+	}
+}
+
+func TestInventoryKeyFileHome(t *testing.T) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		t.Skip(err)
+	}
+	cases := map[string]string{
+		"~/.ssh/id_rsa":   filepath.Join(home, ".ssh", "id_rsa"),
+		"~":               home,
+		"/etc/deploy.key": "/etc/deploy.key",
+		"keys/~/id_rsa":   "keys/~/id_rsa",
+	}
+	for file, except := range cases {
+		if actual, err := expandHome(file); err != nil || actual != except {
+			t.Errorf("expandHome(%s) except:%s actual:%s %v", file, except, actual, err)
+		}
+	}
+	if _, err = expandHome("~no-such-user-lib4go/id_rsa"); err == nil {
+		t.Error("except unknown user error")
+	}
+
+	inv, err := ParseInventoryINI([]byte("web1 ansible_ssh_private_key_file=~/.ssh/missing_lib4go_key"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := inv.Host("web1")
+	if err != nil || len(info.Auth) != 1 {
+		t.Fatalf("except a key auth, actual %+v %v", info, err)
+	}
+	if _, err = info.Auth[0].AuthMethod(info); err == nil || !strings.Contains(err.Error(), home) {
+		t.Errorf("key file should be read from the home dir, actual %v", err)
+	}
+}
+
+func TestExpandHostRange(t *testing.T) {
+	hosts, err := expandHostRange("node[8:10].rack[1:2]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	except := []string{"node8.rack1", "node8.rack2", "node9.rack1", "node9.rack2", "node10.rack1", "node10.rack2"}
+	if !reflect.DeepEqual(hosts, except) {
+		t.Errorf("except:%v actual:%v", except, hosts)
+	}
+	if _, err = expandHostRange("web[3:1]"); err == nil {
+		t.Error("except invalid range error")
+	}
+}
+
+func TestBatchUnreachable(t *testing.T) {
+	b := newTestBatch(3)
+	unreachable := errors.New("connect fail")
+	b.errs = []error{nil, unreachable, nil}
+
+	rsl, err := b.Foreach(func(r *RemoteClient) (string, error) {
+		return "ok", nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsl[0].Msg != "ok" || !errors.Is(rsl[1].Error, unreachable) || rsl[2].Msg != "ok" {
+		t.Errorf("unreachable host should only fail itself, actual %+v %+v %+v", rsl[0], rsl[1], rsl[2])
+	}
+	if u := b.Unreachable(); len(u) != 1 || u[0].Host != b.client[1].Host {
+		t.Errorf("unexpected unreachable hosts %v", u)
+	}
+}
+
+func sortedCopy(s []string) []string {
+	c := append([]string{}, s...)
+	sort.Strings(c)
+	return c
+}
@@ -0,0 +1,227 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const defaultScriptDir = "/tmp"
+
+var (
+	envNameRegexp     = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	interpreterRegexp = regexp.MustCompile(`^[A-Za-z0-9_./+-]+$`)
+)
+
+// Script is a text/template rendered for every host and run from a private
+// temporary dir that is removed afterwards.
+type Script struct {
+	// Content is the template, its data is a ScriptData
+	Content string
+	// Vars override the inventory Vars of the host
+	Vars map[string]interface{}
+	// Interpreter runs the script, a command name or path like bash or
+	// /usr/bin/python3 without arguments, default sh
+	Interpreter string
+	// Env are exported to the script
+	Env map[string]string
+	// Assets are local files uploaded next to the script, under their base name
+	Assets []string
+	// Dir is where the temporary dir is created, default /tmp
+	Dir string
+}
+
+// ScriptData is the data of a Script template.
+type ScriptData struct {
+	Host *ServerInfo
+	Vars map[string]interface{}
+	// Dir is the temporary dir holding the script and its assets
+	Dir string
+}
+
+// ScriptResult is the result of a Script run on one host.
+type ScriptResult struct {
+	ExecResult
+	Stdout string `json:"stdout,omitempty"`
+	Stderr string `json:"stderr,omitempty"`
+	Error  error  `json:"-"`
+}
+
+// Render renders the script for info with dir as its temporary dir.
+func (s *Script) Render(info *ServerInfo, dir string) (string, error) {
+	tpl, err := template.New("script").
+		Option("missingkey=error").
+		Funcs(template.FuncMap{"quote": shellQuote}).
+		Parse(s.Content)
+	if err != nil {
+		return "", fmt.Errorf("parse script fail:%s", err)
+	}
+
+	vars := map[string]interface{}{}
+	for k, v := range info.Vars {
+		vars[k] = v
+	}
+	for k, v := range s.Vars {
+		vars[k] = v
+	}
+
+	var buf bytes.Buffer
+	if err = tpl.Execute(&buf, &ScriptData{Host: info, Vars: vars, Dir: dir}); err != nil {
+		return "", fmt.Errorf("render script fail:%s", err)
+	}
+	return buf.String(), nil
+}
+
+// command returns the command line running file with the script env.
+func (s *Script) command(file string) (string, error) {
+	interpreter := s.Interpreter
+	if interpreter == "" {
+		interpreter = "sh"
+	}
+	if !interpreterRegexp.MatchString(interpreter) {
+		return "", fmt.Errorf("invalid interpreter %s", interpreter)
+	}
+
+	keys := make([]string, 0, len(s.Env))
+	for k := range s.Env {
+		if !envNameRegexp.MatchString(k) {
+			return "", fmt.Errorf("invalid env name %s", k)
+		}
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	cmd := make([]string, 0, len(keys)+4)
+	cmd = append(cmd, "cd", shellQuote(path.Dir(file)), "&&")
+	if len(keys) > 0 {
+		cmd = append(cmd, "env")
+		for _, k := range keys {
+			cmd = append(cmd, k+"="+shellQuote(s.Env[k]))
+		}
+	}
+	cmd = append(cmd, interpreter, shellQuote(file))
+	return strings.Join(cmd, " "), nil
+}
+
+// RunScript renders s for the host, uploads it with its assets to a new 0700
+// dir, runs it and removes the dir.
+func (r *RemoteClient) RunScript(ctx context.Context, s *Script, opts ...ExecOption) (*ScriptResult, error) {
+	sclient, err := r.pool.Sftp(r.ServerInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	base := s.Dir
+	if base == "" {
+		base = defaultScriptDir
+	}
+	suffix := make([]byte, 8)
+	if _, err = rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	dir := path.Join(base, "lib4go-script-"+hex.EncodeToString(suffix))
+
+	script, err := s.Render(r.ServerInfo, dir)
+	if err != nil {
+		return nil, err
+	}
+	cmd, err := s.command(path.Join(dir, "script"))
+	if err != nil {
+		return nil, err
+	}
+
+	// mkdir fails when dir exists, so the dir is never shared, and -m creates
+	// it private instead of with the umask default
+	if _, err = r.ExecContext(ctx, "mkdir -m 0700 -- "+shellQuote(dir)); err != nil {
+		return nil, fmt.Errorf("create remote dir(%s) fail:%w", dir, err)
+	}
+	defer func() {
+		// the cleanup runs even when ctx is done, audited with its correlation id
+		cleanup := WithCorrelationID(context.Background(), CorrelationID(ctx))
+		if _, err := r.ExecContext(cleanup, "rm -rf -- "+shellQuote(dir)); err != nil {
+			log.Printf("remove remote dir(%s) fail:%s", dir, err)
+		}
+	}()
+
+	dsf, err := sclient.OpenFile(path.Join(dir, "script"), os.O_WRONLY|os.O_CREATE|os.O_EXCL)
+	if err != nil {
+		return nil, fmt.Errorf("create remote file fail:%w", err)
+	}
+	if _, err = dsf.Write([]byte(script)); err != nil {
+		dsf.Close()
+		return nil, fmt.Errorf("write remote file fail:%w", err)
+	}
+	if err = dsf.Chmod(0700); err != nil {
+		dsf.Close()
+		return nil, fmt.Errorf("chmod remote file fail:%w", err)
+	}
+	if err = dsf.Close(); err != nil {
+		return nil, fmt.Errorf("close remote file fail:%w", err)
+	}
+
+	for _, asset := range s.Assets {
+		if err = r.ScpFileContext(ctx, asset, path.Join(dir, filepath.Base(asset)), nil); err != nil {
+			return nil, err
+		}
+	}
+
+	event := &AuditEvent{Type: AuditScript, Command: cmd, RemoteFile: path.Join(dir, "script"), Start: time.Now()}
+	var stdout, stderr bytes.Buffer
+	res, err := r.execStream(ctx, cmd, &stdout, &stderr, opts...)
+	event.Bytes = int64(stdout.Len() + stderr.Len())
+	if res != nil {
+		event.ExitCode = res.ExitCode
+	}
+	r.audit(ctx, event, err)
+	if res == nil {
+		return nil, err
+	}
+	return &ScriptResult{ExecResult: *res, Stdout: stdout.String(), Stderr: stderr.String(), Error: err}, err
+}
+
+// RunScript runs s on every host following the strategy of b, the results are
+// in the order of the hosts.
+func (b *BatchRemoteClient) RunScript(ctx context.Context, s *Script, opts ...ExecOption) ([]*ScriptResult, error) {
+	b.l.Lock()
+	defer b.l.Unlock()
+
+	var l sync.Mutex
+	results := map[*RemoteClient]*ScriptResult{}
+	rsl, err := b.run(nil, func(c *RemoteClient) *ResponseMsg {
+		res, e := c.RunScript(ctx, s, opts...)
+		msg := &ResponseMsg{Host: c.Host, Error: e, ExitCode: -1}
+		if res != nil {
+			msg.Msg = res.Stdout
+			msg.ExitCode = res.ExitCode
+			l.Lock()
+			results[c] = res
+			l.Unlock()
+		}
+		return msg
+	})
+
+	list := make([]*ScriptResult, len(b.client))
+	for i, c := range b.client {
+		if res, ok := results[c]; ok {
+			list[i] = res
+			continue
+		}
+		list[i] = &ScriptResult{ExecResult: ExecResult{Host: c.Host, ExitCode: -1}}
+		if rsl != nil && rsl[i] != nil {
+			list[i].Error = rsl[i].Error
+		}
+	}
+	return list, err
+}
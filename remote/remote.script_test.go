@@ -0,0 +1,55 @@
+package remote
+
+import (
+	"testing"
+)
+
+func TestScriptRender(t *testing.T) {
+	s := &Script{
+		Content: `echo {{ quote .Vars.msg }} > {{ .Dir }}/out; ls {{ .Host.Name }} {{ .Vars.role }}`,
+		Vars:    map[string]interface{}{"msg": "it's"},
+	}
+	info := &ServerInfo{Name: "db1", Vars: map[string]string{"role": "primary", "msg": "ignored"}}
+
+	out, err := s.Render(info, "/tmp/x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	except := `echo 'it'\''s' > /tmp/x/out; ls db1 primary`
+	if out != except {
+		t.Errorf("except:%s actual:%s", except, out)
+	}
+
+	s.Content = `{{ .Vars.none }}`
+	if _, err = s.Render(info, "/tmp/x"); err == nil {
+		t.Error("except missing var error")
+	}
+}
+
+func TestScriptCommand(t *testing.T) {
+	s := &Script{}
+	cmd, err := s.command("/tmp/x/script")
+	if err != nil || cmd != `cd '/tmp/x' && sh '/tmp/x/script'` {
+		t.Errorf("unexpected command %s %v", cmd, err)
+	}
+
+	s = &Script{Interpreter: "python3", Env: map[string]string{"B": "b c", "A": "1"}}
+	cmd, err = s.command("/tmp/x/script")
+	if err != nil || cmd != `cd '/tmp/x' && env A='1' B='b c' python3 '/tmp/x/script'` {
+		t.Errorf("unexpected command %s %v", cmd, err)
+	}
+
+	s.Env["A;rm"] = "1"
+	if _, err = s.command("/tmp/x/script"); err == nil {
+		t.Error("except invalid env name error")
+	}
+
+	for _, interpreter := range []string{"sh; rm -rf /", "bash -c", "$(id)"} {
+		if _, err = (&Script{Interpreter: interpreter}).command("/tmp/x/script"); err == nil {
+			t.Errorf("except invalid interpreter error for %q", interpreter)
+		}
+	}
+	if _, err = (&Script{Interpreter: "/usr/bin/python3.11"}).command("/tmp/x/script"); err != nil {
+		t.Errorf("interpreter path should be valid, %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ErrExpectTimeout is returned by Shell.Expect when the pattern did not
+// appear in time.
+var ErrExpectTimeout = errors.New("expect timeout")
+
+const secretMask = "******"
+
+// ShellOptions configures the pty of RemoteClient.Shell, nil means an
+// 80x40 xterm with echo.
+type ShellOptions struct {
+	Term   string
+	Width  int
+	Height int
+	// Modes override the default terminal modes
+	Modes ssh.TerminalModes
+}
+
+// ShellRecord is one entry of a Shell transcript.
+type ShellRecord struct {
+	Time time.Time `json:"time"`
+	// Input is true for the data sent to the shell
+	Input bool   `json:"input,omitempty"`
+	Data  string `json:"data"`
+}
+
+// Shell is an interactive pty session automated with Send and Expect.
+type Shell struct {
+	client  *RemoteClient
+	session *Session
+	stdin   io.WriteCloser
+	event   *AuditEvent
+	audited sync.Once
+
+	l          sync.Mutex
+	buf        []byte
+	transcript []ShellRecord
+	notify     chan struct{}
+	err        error
+	done       chan struct{}
+}
+
+// Shell starts an interactive shell on a pty.
+func (r *RemoteClient) Shell(opts *ShellOptions) (*Shell, error) {
+	if opts == nil {
+		opts = &ShellOptions{}
+	}
+	term, width, height := opts.Term, opts.Width, opts.Height
+	if term == "" {
+		term = "xterm"
+	}
+	if width <= 0 {
+		width = 80
+	}
+	if height <= 0 {
+		height = 40
+	}
+	modes := ssh.TerminalModes{
+		ssh.ECHO:          1,
+		ssh.TTY_OP_ISPEED: 14400,
+		ssh.TTY_OP_OSPEED: 14400,
+	}
+	for k, v := range opts.Modes {
+		modes[k] = v
+	}
+
+	event := &AuditEvent{Type: AuditShell, Start: time.Now()}
+	session, err := r.pool.Session(r.ServerInfo)
+	if err != nil {
+		err = fmt.Errorf("get session err:%w", err)
+		r.audit(context.Background(), event, err)
+		return nil, err
+	}
+
+	s := &Shell{client: r, session: session, event: event, notify: make(chan struct{}, 1), done: make(chan struct{})}
+	if err = session.RequestPty(term, height, width, modes); err != nil {
+		session.Close()
+		err = fmt.Errorf("request pty fail:%w", err)
+		s.audit(err)
+		return nil, err
+	}
+	if s.stdin, err = session.StdinPipe(); err != nil {
+		session.Close()
+		s.audit(err)
+		return nil, err
+	}
+	stdout, err := session.StdoutPipe()
+	if err != nil {
+		session.Close()
+		s.audit(err)
+		return nil, err
+	}
+	if err = session.Shell(); err != nil {
+		session.Close()
+		err = fmt.Errorf("start shell fail:%w", err)
+		s.audit(err)
+		return nil, err
+	}
+
+	go s.read(stdout)
+	return s, nil
+}
+
+func (s *Shell) read(stdout io.Reader) {
+	defer close(s.done)
+
+	p := make([]byte, 4096)
+	for {
+		n, err := stdout.Read(p)
+		s.l.Lock()
+		if n > 0 {
+			s.buf = append(s.buf, p[:n]...)
+			s.transcript = append(s.transcript, ShellRecord{Time: time.Now(), Data: string(p[:n])})
+		}
+		if err != nil {
+			s.err = err
+		}
+		s.l.Unlock()
+
+		select {
+		case s.notify <- struct{}{}:
+		default:
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Send writes data to the shell.
+func (s *Shell) Send(data string) error {
+	return s.send(data, data)
+}
+
+// SendLine writes line and a newline to the shell.
+func (s *Shell) SendLine(line string) error {
+	return s.send(line+"\n", line+"\n")
+}
+
+// SendSecret writes secret and a newline to the shell, the transcript only
+// records a mask.
+func (s *Shell) SendSecret(secret string) error {
+	return s.send(secret+"\n", secretMask+"\n")
+}
+
+func (s *Shell) send(data, record string) error {
+	s.l.Lock()
+	s.transcript = append(s.transcript, ShellRecord{Time: time.Now(), Input: true, Data: record})
+	s.l.Unlock()
+
+	_, err := io.WriteString(s.stdin, data)
+	return err
+}
+
+// Expect waits until re matches the output not consumed by a previous
+// Expect, consumes it up to the end of the match and returns the submatches.
+func (s *Shell) Expect(re *regexp.Regexp, timeout time.Duration) ([]string, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		s.l.Lock()
+		loc := re.FindSubmatchIndex(s.buf)
+		if loc != nil {
+			match := make([]string, len(loc)/2)
+			for i := range match {
+				if loc[2*i] >= 0 {
+					match[i] = string(s.buf[loc[2*i]:loc[2*i+1]])
+				}
+			}
+			s.buf = s.buf[loc[1]:]
+			s.l.Unlock()
+			return match, nil
+		}
+		err, pending := s.err, string(s.buf)
+		s.l.Unlock()
+
+		if err != nil {
+			return nil, fmt.Errorf("expect %s fail:%w, output:%q", re, err, pending)
+		}
+
+		select {
+		case <-s.notify:
+		case <-timer.C:
+			return nil, fmt.Errorf("%w: %s, output:%q", ErrExpectTimeout, re, pending)
+		}
+	}
+}
+
+// Resize changes the window size of the pty.
+func (s *Shell) Resize(width, height int) error {
+	return s.session.WindowChange(height, width)
+}
+
+// Transcript returns the input and output of the shell so far.
+func (s *Shell) Transcript() []ShellRecord {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return append([]ShellRecord{}, s.transcript...)
+}
+
+// Wait closes the input and waits for the shell to exit.
+func (s *Shell) Wait() error {
+	s.stdin.Close()
+	err := s.session.Wait()
+	<-s.done
+	s.session.Close()
+	s.audit(err)
+	return err
+}
+
+// Close ends the shell.
+func (s *Shell) Close() error {
+	err := s.session.Close()
+	<-s.done
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+	s.audit(err)
+	return err
+}
+
+// audit sends the shell event once, with the masked input as its command.
+func (s *Shell) audit(err error) {
+	s.audited.Do(func() {
+		var input strings.Builder
+		s.l.Lock()
+		for _, r := range s.transcript {
+			if r.Input {
+				input.WriteString(r.Data)
+			} else {
+				s.event.Bytes += int64(len(r.Data))
+			}
+		}
+		s.l.Unlock()
+		s.event.Command = input.String()
+		if err != nil {
+			s.event.ExitCode = exitCode(err)
+		}
+		s.client.audit(context.Background(), s.event, err)
+	})
+}
@@ -0,0 +1,100 @@
+package remote
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/champly/lib4go/remote/remotetest"
+)
+
+// deviceShell is a shell that asks a password before running any command.
+func deviceShell(cmd *remotetest.Command) int {
+	in := bufio.NewReader(cmd.Stdin)
+	fmt.Fprint(cmd.Stdout, "Password: ")
+	line, _ := in.ReadString('\n')
+	if strings.TrimSpace(line) != "secret" {
+		fmt.Fprintln(cmd.Stdout, "denied")
+		return 1
+	}
+
+	for {
+		fmt.Fprint(cmd.Stdout, "device# ")
+		line, err := in.ReadString('\n')
+		if err != nil {
+			return 0
+		}
+		switch line = strings.TrimSpace(line); line {
+		case "size":
+			w := <-cmd.Resize()
+			fmt.Fprintf(cmd.Stdout, "%dx%d\n", w.Width, w.Height)
+		case "exit":
+			return 0
+		default:
+			fmt.Fprintf(cmd.Stdout, "%s: %s\n", cmd.Pty.Term, line)
+		}
+	}
+}
+
+func TestShell(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	srv.Handle("", deviceShell)
+
+	sh, err := client.Shell(&ShellOptions{Term: "vt100"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sh.Close()
+
+	prompt := regexp.MustCompile(`device# $`)
+	steps := []func() error{
+		func() error { _, err := sh.Expect(regexp.MustCompile(`Password: $`), time.Second); return err },
+		func() error { return sh.SendSecret("secret") },
+		func() error { _, err := sh.Expect(prompt, time.Second); return err },
+		func() error { return sh.SendLine("show version") },
+		func() error {
+			m, err := sh.Expect(regexp.MustCompile(`(\w+): show version`), time.Second)
+			if err == nil && m[1] != "vt100" {
+				err = fmt.Errorf("unexpected term %v", m)
+			}
+			return err
+		},
+		func() error { _, err := sh.Expect(prompt, time.Second); return err },
+		func() error { return sh.SendLine("size") },
+		func() error { return sh.Resize(120, 50) },
+		func() error { _, err := sh.Expect(regexp.MustCompile(`120x50`), time.Second); return err },
+	}
+	for i, step := range steps {
+		if err := step(); err != nil {
+			t.Fatalf("step %d fail:%v", i, err)
+		}
+	}
+
+	if _, err = sh.Expect(regexp.MustCompile("never"), 50*time.Millisecond); !errors.Is(err, ErrExpectTimeout) {
+		t.Errorf("except timeout, actual %v", err)
+	}
+
+	sh.SendLine("exit")
+	if err = sh.Wait(); err != nil {
+		t.Errorf("shell exit %v", err)
+	}
+
+	var input, output strings.Builder
+	for _, r := range sh.Transcript() {
+		if r.Input {
+			input.WriteString(r.Data)
+		} else {
+			output.WriteString(r.Data)
+		}
+	}
+	if strings.Contains(input.String(), "secret") || !strings.Contains(input.String(), secretMask) {
+		t.Errorf("secret should be masked in the transcript, actual %q", input.String())
+	}
+	if !strings.Contains(output.String(), "vt100: show version") {
+		t.Errorf("transcript misses the output %q", output.String())
+	}
+}
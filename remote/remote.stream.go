@@ -0,0 +1,158 @@
+package remote
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// ExecResult is the result of a streamed command.
+type ExecResult struct {
+	Host     string        `json:"host,omitempty"`
+	ExitCode int           `json:"exit_code"`
+	Duration time.Duration `json:"duration"`
+}
+
+// StreamLine is one line of output sent by BatchRemoteClient.ExecStream.
+type StreamLine struct {
+	Host   string `json:"host,omitempty"`
+	Stderr bool   `json:"stderr,omitempty"`
+	Line   string `json:"line,omitempty"`
+}
+
+// lineWriter forwards complete lines to w, the last incomplete line is
+// kept until Flush is called.
+type lineWriter struct {
+	l   *sync.Mutex
+	w   io.Writer
+	buf []byte
+}
+
+func newLineWriter(w io.Writer, l *sync.Mutex) *lineWriter {
+	return &lineWriter{w: w, l: l}
+}
+
+func (lw *lineWriter) Write(p []byte) (int, error) {
+	lw.buf = append(lw.buf, p...)
+	for {
+		i := bytes.IndexByte(lw.buf, '\n')
+		if i < 0 {
+			break
+		}
+		if err := lw.write(lw.buf[:i+1]); err != nil {
+			return 0, err
+		}
+		lw.buf = lw.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (lw *lineWriter) Flush() error {
+	if len(lw.buf) == 0 {
+		return nil
+	}
+	err := lw.write(lw.buf)
+	lw.buf = nil
+	return err
+}
+
+func (lw *lineWriter) write(line []byte) error {
+	lw.l.Lock()
+	defer lw.l.Unlock()
+	_, err := lw.w.Write(line)
+	return err
+}
+
+// ExecStream runs cmd and writes stdout and stderr line by line to the given
+// writers as soon as the lines arrive. A nil writer discards the stream.
+func (r *RemoteClient) ExecStream(ctx context.Context, cmd string, stdout, stderr io.Writer, opts ...ExecOption) (*ExecResult, error) {
+	event := &AuditEvent{Type: AuditExec, Command: cmd, Start: time.Now()}
+	out := &countWriter{w: stdout}
+	errOut := &countWriter{w: stderr}
+
+	result, err := r.execStream(ctx, cmd, out, errOut, opts...)
+	event.Bytes = out.n + errOut.n
+	if result != nil {
+		event.ExitCode = result.ExitCode
+	}
+	r.audit(ctx, event, err)
+	return result, err
+}
+
+// countWriter counts the bytes written to w, a nil w discards them.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	if c.w == nil {
+		return len(p), nil
+	}
+	return c.w.Write(p)
+}
+
+func (r *RemoteClient) execStream(ctx context.Context, cmd string, stdout, stderr io.Writer, opts ...ExecOption) (*ExecResult, error) {
+	if stdout == nil {
+		stdout = io.Discard
+	}
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	session, err := r.pool.Session(r.ServerInfo)
+	if err != nil {
+		return nil, fmt.Errorf("get session err:%w", err)
+	}
+	defer session.Close()
+
+	l := &sync.Mutex{}
+	outWriter := newLineWriter(stdout, l)
+	errWriter := newLineWriter(stderr, l)
+	session.Stdout = outWriter
+	session.Stderr = errWriter
+
+	result := &ExecResult{Host: r.Host}
+	start := time.Now()
+	err = runSession(ctx, session.Session, cmd, newExecOptions(opts))
+	result.Duration = time.Since(start)
+
+	outWriter.Flush()
+	errWriter.Flush()
+
+	if ctx.Err() != nil {
+		result.ExitCode = -1
+		return result, ctxErr(ctx)
+	}
+	if err != nil {
+		result.ExitCode = exitCode(err)
+		return result, exitError(r.Host, cmd, "", err)
+	}
+	return result, nil
+}
+
+func exitCode(err error) int {
+	var ee *ssh.ExitError
+	if errors.As(err, &ee) {
+		return ee.ExitStatus()
+	}
+	return -1
+}
+
+type streamLineWriter struct {
+	host   string
+	stderr bool
+	fn     func(line *StreamLine)
+}
+
+func (s *streamLineWriter) Write(p []byte) (int, error) {
+	s.fn(&StreamLine{Host: s.host, Stderr: s.stderr, Line: string(bytes.TrimRight(p, "\r\n"))})
+	return len(p), nil
+}
@@ -0,0 +1,85 @@
+package remote
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recordWriter struct {
+	writes []string
+}
+
+func (r *recordWriter) Write(p []byte) (int, error) {
+	r.writes = append(r.writes, string(p))
+	return len(p), nil
+}
+
+func TestLineWriter(t *testing.T) {
+	rw := &recordWriter{}
+	lw := newLineWriter(rw, &sync.Mutex{})
+
+	for _, chunk := range []string{"he", "llo\nwor", "ld\n\nlast"} {
+		if _, err := lw.Write([]byte(chunk)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := lw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	except := []string{"hello\n", "world\n", "\n", "last"}
+	if len(rw.writes) != len(except) {
+		t.Fatalf("except %q, actual %q", except, rw.writes)
+	}
+	for i := range except {
+		if rw.writes[i] != except[i] {
+			t.Errorf("except %q, actual %q", except[i], rw.writes[i])
+		}
+	}
+}
+
+func TestStreamLineWriter(t *testing.T) {
+	var lines []*StreamLine
+	w := &streamLineWriter{host: "h1", stderr: true, fn: func(line *StreamLine) {
+		lines = append(lines, line)
+	}}
+	lw := newLineWriter(w, &sync.Mutex{})
+	lw.Write([]byte("a\r\nb\n"))
+
+	if len(lines) != 2 || lines[0].Line != "a" || lines[1].Line != "b" || !lines[0].Stderr || lines[0].Host != "h1" {
+		t.Errorf("unexpected lines: %+v", lines)
+	}
+}
+
+func TestBatchExecStream(t *testing.T) {
+	serverList := make([]*ServerInfo, 0, 2)
+	for i := 0; i < 2; i++ {
+		srv, info := newTestServer(t, nil)
+		srv.SetOutputDelay(time.Millisecond)
+		serverList = append(serverList, info)
+	}
+	pool := NewPool(nil)
+	defer pool.Close()
+	client, err := NewBatchRemoteClientWithPool(serverList, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []*StreamLine
+	rsl, err := client.ExecStream(context.Background(), "echo out; echo err >&2; exit 4", func(line *StreamLine) {
+		lines = append(lines, line)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 4 {
+		t.Errorf("except 4 lines, actual %d", len(lines))
+	}
+	for _, r := range rsl {
+		if r.ExitCode != 4 {
+			t.Errorf("except exit code 4, actual %+v", r)
+		}
+	}
+}
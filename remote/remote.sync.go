@@ -0,0 +1,261 @@
+package remote
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// sha256sumBatch limits the files hashed by one remote sha256sum command.
+const sha256sumBatch = 200
+
+// SyncOptions configures RemoteClient.SyncDir.
+type SyncOptions struct {
+	// Delete removes remote files that do not exist locally, the remote dirs
+	// holding excluded files are kept
+	Delete bool
+	// Exclude are path.Match globs checked against the relative path and the base name
+	Exclude []string
+	// DryRun only returns the plan
+	DryRun bool
+	// Checksum compares the sha256 of files with the same size instead of their mtime
+	Checksum bool
+	// Parallel is the number of files uploaded at once, default 1
+	Parallel int
+}
+
+// SyncPlan lists the changes of a sync, paths are relative to the synced dirs.
+type SyncPlan struct {
+	Mkdir  []string `json:"mkdir,omitempty"`
+	Upload []string `json:"upload,omitempty"`
+	Delete []string `json:"delete,omitempty"`
+}
+
+func (o *SyncOptions) excluded(rel string) bool {
+	for _, pattern := range o.Exclude {
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncDir uploads the files of localDir that differ from remoteDir in size or
+// mtime (or sha256 with opts.Checksum), and returns the applied plan. A remote
+// entry whose type differs from the local one is replaced with opts.Delete,
+// unless it holds excluded files, otherwise SyncDir fails for every such path.
+func (r *RemoteClient) SyncDir(localDir, remoteDir string, opts *SyncOptions) (*SyncPlan, error) {
+	return r.SyncDirContext(context.Background(), localDir, remoteDir, opts)
+}
+
+// SyncDirContext is SyncDir with a context.
+func (r *RemoteClient) SyncDirContext(ctx context.Context, localDir, remoteDir string, opts *SyncOptions) (*SyncPlan, error) {
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	sclient, err := r.pool.Sftp(r.ServerInfo)
+	if err != nil {
+		return nil, err
+	}
+
+	localDir = filepath.Clean(localDir)
+	remoteDir = strings.TrimRight(remoteDir, "/")
+
+	locals := map[string]os.FileInfo{}
+	err = filepath.Walk(localDir, func(lf string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, lf)
+		if err != nil || rel == "." {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if opts.excluded(rel) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		locals[rel] = info
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	remotes := map[string]os.FileInfo{}
+	// kept are the remote dirs holding excluded entries, they are never deleted
+	kept := map[string]bool{}
+	if _, err := sclient.Stat(remoteDir); err == nil {
+		walker := sclient.Walk(remoteDir)
+		for walker.Step() {
+			if err := walker.Err(); err != nil {
+				return nil, err
+			}
+			rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), remoteDir), "/")
+			if rel == "" {
+				continue
+			}
+			if opts.excluded(rel) {
+				if walker.Stat().IsDir() {
+					walker.SkipDir()
+				}
+				for dir := path.Dir(rel); dir != "."; dir = path.Dir(dir) {
+					kept[dir] = true
+				}
+				continue
+			}
+			remotes[rel] = walker.Stat()
+		}
+	}
+
+	plan := &SyncPlan{}
+	compare := make([]string, 0)
+	conflicts := make([]string, 0)
+	for rel, li := range locals {
+		ri, ok := remotes[rel]
+		// a remote entry of the other type must be deleted before it is replaced
+		if ok && li.IsDir() != ri.IsDir() {
+			if !opts.Delete || kept[rel] {
+				conflicts = append(conflicts, rel)
+				continue
+			}
+			plan.Delete = append(plan.Delete, rel)
+		}
+		switch {
+		case li.IsDir():
+			if !ok || !ri.IsDir() {
+				plan.Mkdir = append(plan.Mkdir, rel)
+			}
+		case !ok || ri.IsDir() || li.Size() != ri.Size():
+			plan.Upload = append(plan.Upload, rel)
+		case opts.Checksum:
+			compare = append(compare, rel)
+		case li.ModTime().Unix() != ri.ModTime().Unix():
+			plan.Upload = append(plan.Upload, rel)
+		}
+	}
+
+	if len(conflicts) > 0 {
+		sort.Strings(conflicts)
+		errs := make([]error, 0, len(conflicts))
+		for _, rel := range conflicts {
+			if locals[rel].IsDir() {
+				errs = append(errs, fmt.Errorf("sync %s fail:local is a dir but remote is a file", rel))
+			} else {
+				errs = append(errs, fmt.Errorf("sync %s fail:local is a file but remote is a dir", rel))
+			}
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	if len(compare) > 0 {
+		changed, err := r.changedByChecksum(ctx, localDir, remoteDir, compare)
+		if err != nil {
+			return nil, err
+		}
+		plan.Upload = append(plan.Upload, changed...)
+	}
+
+	if opts.Delete {
+		for rel := range remotes {
+			if _, ok := locals[rel]; !ok && !kept[rel] {
+				plan.Delete = append(plan.Delete, rel)
+			}
+		}
+	}
+
+	sort.Strings(plan.Mkdir)
+	sort.Strings(plan.Upload)
+	// deeper paths first, so files are removed before their dirs
+	sort.Slice(plan.Delete, func(i, j int) bool {
+		return plan.Delete[i] > plan.Delete[j]
+	})
+
+	if opts.DryRun {
+		return plan, nil
+	}
+
+	for _, rel := range plan.Delete {
+		rf := path.Join(remoteDir, rel)
+		if remotes[rel].IsDir() {
+			err = sclient.RemoveDirectory(rf)
+		} else {
+			err = sclient.Remove(rf)
+		}
+		if err != nil {
+			return plan, fmt.Errorf("delete remote %s fail:%w", rf, err)
+		}
+	}
+
+	if err = sclient.MkdirAll(remoteDir); err != nil {
+		return plan, fmt.Errorf("create remote dir(%s) fail:%w", remoteDir, err)
+	}
+	for _, rel := range plan.Mkdir {
+		rf := path.Join(remoteDir, rel)
+		if err = sclient.MkdirAll(rf); err != nil {
+			return plan, fmt.Errorf("create remote dir(%s) fail:%w", rf, err)
+		}
+	}
+
+	jobs := make([]transferJob, 0, len(plan.Upload))
+	for _, rel := range plan.Upload {
+		jobs = append(jobs, transferJob{local: filepath.Join(localDir, filepath.FromSlash(rel)), remote: path.Join(remoteDir, rel)})
+	}
+	topts := &TransferOptions{Preserve: true, Parallel: opts.Parallel}
+	err = runTransferJobs(ctx, jobs, topts.parallel(), func(ctx context.Context, job transferJob) error {
+		return r.ScpFileContext(ctx, job.local, job.remote, topts)
+	})
+	return plan, err
+}
+
+// changedByChecksum returns the files whose local and remote sha256 differ,
+// the remote hashes are computed by sha256sum in batches.
+func (r *RemoteClient) changedByChecksum(ctx context.Context, localDir, remoteDir string, rels []string) ([]string, error) {
+	remoteSums := map[string]string{}
+	for start := 0; start < len(rels); start += sha256sumBatch {
+		end := start + sha256sumBatch
+		if end > len(rels) {
+			end = len(rels)
+		}
+
+		args := make([]string, 0, end-start)
+		for _, rel := range rels[start:end] {
+			args = append(args, shellQuote(path.Join(remoteDir, rel)))
+		}
+		out, err := r.ExecContext(ctx, "sha256sum -- "+strings.Join(args, " "))
+		if err != nil {
+			return nil, fmt.Errorf("sha256sum fail:%w", err)
+		}
+
+		scanner := bufio.NewScanner(strings.NewReader(out))
+		for scanner.Scan() {
+			fields := strings.SplitN(scanner.Text(), "  ", 2)
+			if len(fields) == 2 {
+				remoteSums[fields[1]] = fields[0]
+			}
+		}
+	}
+
+	changed := make([]string, 0)
+	for _, rel := range rels {
+		local, err := fileSha256(filepath.Join(localDir, filepath.FromSlash(rel)))
+		if err != nil {
+			return nil, err
+		}
+		if remoteSums[path.Join(remoteDir, rel)] != local {
+			changed = append(changed, rel)
+		}
+	}
+	return changed, nil
+}
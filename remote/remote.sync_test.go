@@ -0,0 +1,22 @@
+package remote
+
+import "testing"
+
+func TestSyncExclude(t *testing.T) {
+	opts := &SyncOptions{Exclude: []string{"*.log", ".git", "tmp/*"}}
+	excludes := map[string]bool{
+		"app.log":        true,
+		"logs/app.log":   true,
+		".git":           true,
+		"sub/.git":       true,
+		"tmp/a.conf":     true,
+		"tmp":            false,
+		"conf/app.conf":  false,
+		"conf/tmp/a.txt": false,
+	}
+	for rel, except := range excludes {
+		if actual := opts.excluded(rel); actual != except {
+			t.Errorf("excluded(%s) except:%v actual:%v", rel, except, actual)
+		}
+	}
+}
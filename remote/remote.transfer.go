@@ -0,0 +1,498 @@
+package remote
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/sftp"
+)
+
+const defaultChunkSize = 1 << 20
+
+// ChecksumMode selects how a transferred file is verified.
+type ChecksumMode int
+
+const (
+	// ChecksumNone does not verify the transfer
+	ChecksumNone ChecksumMode = iota
+	// ChecksumRemote runs sha256sum on the remote host
+	ChecksumRemote
+	// ChecksumStream reads the remote file back over sftp and hashes it locally
+	ChecksumStream
+)
+
+// TransferProgress is reported after every chunk of a transfer.
+type TransferProgress struct {
+	LocalFile   string
+	RemoteFile  string
+	Transferred int64
+	Total       int64
+}
+
+// TransferOptions configures the Scp*Context and Copy*Context methods, nil
+// means plain streaming without resume or checksum.
+type TransferOptions struct {
+	// ChunkSize is the size of every read and write, default 1MB
+	ChunkSize int
+	// Resume continues a partial transfer from the size of the existing target file,
+	// the target is rewritten when it is not a prefix of the source
+	Resume   bool
+	Checksum ChecksumMode
+	// Preserve keeps the file mode and modification time
+	Preserve bool
+	// Progress may be called concurrently when Parallel > 1
+	Progress func(p *TransferProgress)
+	// Parallel is the number of files ScpDirContext and CopyDirContext copy at once, default 1
+	Parallel int
+}
+
+func (o *TransferOptions) chunkSize() int {
+	if o == nil || o.ChunkSize <= 0 {
+		return defaultChunkSize
+	}
+	return o.ChunkSize
+}
+
+func (o *TransferOptions) parallel() int {
+	if o == nil || o.Parallel <= 0 {
+		return 1
+	}
+	return o.Parallel
+}
+
+// ChecksumError is returned when the checksum of the copied file differs.
+type ChecksumError struct {
+	File   string
+	Local  string
+	Remote string
+}
+
+func (e *ChecksumError) Error() string {
+	return fmt.Sprintf("checksum of %s mismatch, local %s remote %s", e.File, e.Local, e.Remote)
+}
+
+type progressReader struct {
+	ctx      context.Context
+	r        io.Reader
+	progress TransferProgress
+	fn       func(p *TransferProgress)
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.r.Read(b)
+	if n > 0 {
+		p.progress.Transferred += int64(n)
+		if p.fn != nil {
+			pg := p.progress
+			p.fn(&pg)
+		}
+	}
+	return n, err
+}
+
+// copyChunks copies src to dst in chunks of size, io.Copy would hand the
+// whole reader to sftp.File.ReadFrom.
+func copyChunks(dst io.Writer, src io.Reader, size int) error {
+	_, err := io.CopyBuffer(struct{ io.Writer }{dst}, src, make([]byte, size))
+	return err
+}
+
+// ScpFileContext uploads file to remoteFile.
+func (r *RemoteClient) ScpFileContext(ctx context.Context, file string, remoteFile string, opts *TransferOptions) (err error) {
+	event := &AuditEvent{Type: AuditUpload, LocalFile: file, RemoteFile: remoteFile, Start: time.Now()}
+	defer func() { r.audit(ctx, event, err) }()
+
+	sclient, err := r.pool.Sftp(r.ServerInfo)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("read file:%s fail:%w", file, err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err = sclient.MkdirAll(path.Dir(remoteFile)); err != nil {
+		return fmt.Errorf("create remote dir(%s) fail:%w", path.Dir(remoteFile), err)
+	}
+
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts != nil && opts.Resume {
+		if rs, err := sclient.Stat(remoteFile); err == nil && rs.Size() <= stat.Size() {
+			if ok, err := remotePrefixEqual(sclient, remoteFile, f, rs.Size()); err == nil && ok {
+				offset = rs.Size()
+				flags = os.O_WRONLY | os.O_CREATE
+			}
+		}
+	}
+
+	dsf, err := sclient.OpenFile(remoteFile, flags)
+	if err != nil {
+		return fmt.Errorf("create remote file fail:%w", err)
+	}
+	defer dsf.Close()
+
+	if offset > 0 {
+		if _, err = f.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err = dsf.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	pr := &progressReader{
+		ctx:      ctx,
+		r:        f,
+		progress: TransferProgress{LocalFile: file, RemoteFile: remoteFile, Transferred: offset, Total: stat.Size()},
+	}
+	if opts != nil {
+		pr.fn = opts.Progress
+	}
+	err = copyChunks(dsf, pr, opts.chunkSize())
+	event.Bytes = pr.progress.Transferred - offset
+	if err != nil {
+		return fmt.Errorf("upload %s fail:%w", file, err)
+	}
+	if err = dsf.Close(); err != nil {
+		return fmt.Errorf("upload %s fail:%w", file, err)
+	}
+
+	if opts == nil {
+		return nil
+	}
+	if opts.Preserve {
+		if err = sclient.Chmod(remoteFile, stat.Mode().Perm()); err != nil {
+			return err
+		}
+		if err = sclient.Chtimes(remoteFile, stat.ModTime(), stat.ModTime()); err != nil {
+			return err
+		}
+	}
+	return r.verify(ctx, sclient, file, remoteFile, opts.Checksum)
+}
+
+// CopyFileContext downloads remoteFile to localFile.
+func (r *RemoteClient) CopyFileContext(ctx context.Context, localFile string, remoteFile string, opts *TransferOptions) (err error) {
+	event := &AuditEvent{Type: AuditDownload, LocalFile: localFile, RemoteFile: remoteFile, Start: time.Now()}
+	defer func() { r.audit(ctx, event, err) }()
+
+	sclient, err := r.pool.Sftp(r.ServerInfo)
+	if err != nil {
+		return err
+	}
+
+	rf, err := sclient.OpenFile(remoteFile, os.O_RDONLY)
+	if err != nil {
+		return fmt.Errorf("remote read file %s fail:%w", remoteFile, err)
+	}
+	defer rf.Close()
+
+	stat, err := rf.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(localFile), 0755); err != nil {
+		return err
+	}
+
+	var offset int64
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if opts != nil && opts.Resume {
+		if ls, err := os.Stat(localFile); err == nil && ls.Size() <= stat.Size() {
+			if ok, err := localPrefixEqual(localFile, rf, ls.Size()); err == nil && ok {
+				offset = ls.Size()
+				flags = os.O_WRONLY | os.O_CREATE
+			}
+		}
+	}
+
+	lf, err := os.OpenFile(localFile, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("create or read local file %s fail:%w", localFile, err)
+	}
+	defer lf.Close()
+
+	if offset > 0 {
+		if _, err = rf.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err = lf.Seek(offset, io.SeekStart); err != nil {
+			return err
+		}
+	}
+
+	pr := &progressReader{
+		ctx:      ctx,
+		r:        rf,
+		progress: TransferProgress{LocalFile: localFile, RemoteFile: remoteFile, Transferred: offset, Total: stat.Size()},
+	}
+	if opts != nil {
+		pr.fn = opts.Progress
+	}
+	err = copyChunks(lf, pr, opts.chunkSize())
+	event.Bytes = pr.progress.Transferred - offset
+	if err != nil {
+		return fmt.Errorf("download %s fail:%w", remoteFile, err)
+	}
+	if err = lf.Close(); err != nil {
+		return err
+	}
+
+	if opts == nil {
+		return nil
+	}
+	if opts.Preserve {
+		if err = os.Chmod(localFile, stat.Mode().Perm()); err != nil {
+			return err
+		}
+		if err = os.Chtimes(localFile, stat.ModTime(), stat.ModTime()); err != nil {
+			return err
+		}
+	}
+	return r.verify(ctx, sclient, localFile, remoteFile, opts.Checksum)
+}
+
+// remotePrefixEqual reports whether the first n bytes of remoteFile equal those of src.
+func remotePrefixEqual(sclient *sftp.Client, remoteFile string, src io.ReaderAt, n int64) (bool, error) {
+	f, err := sclient.Open(remoteFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return prefixEqual(f, src, n)
+}
+
+// localPrefixEqual reports whether the first n bytes of localFile equal those of src.
+func localPrefixEqual(localFile string, src io.ReaderAt, n int64) (bool, error) {
+	f, err := os.Open(localFile)
+	if err != nil {
+		return false, err
+	}
+	defer f.Close()
+	return prefixEqual(f, src, n)
+}
+
+// prefixEqual compares the first n bytes of a and b, ReadAt leaves the
+// offsets of both untouched.
+func prefixEqual(a, b io.ReaderAt, n int64) (bool, error) {
+	ha, err := readerSha256(io.NewSectionReader(a, 0, n))
+	if err != nil {
+		return false, err
+	}
+	hb, err := readerSha256(io.NewSectionReader(b, 0, n))
+	if err != nil {
+		return false, err
+	}
+	return ha == hb, nil
+}
+
+func (r *RemoteClient) verify(ctx context.Context, sclient *sftp.Client, localFile, remoteFile string, mode ChecksumMode) error {
+	if mode == ChecksumNone {
+		return nil
+	}
+
+	local, err := fileSha256(localFile)
+	if err != nil {
+		return err
+	}
+
+	var remote string
+	switch mode {
+	case ChecksumRemote:
+		remote, err = r.remoteSha256(ctx, remoteFile)
+	case ChecksumStream:
+		remote, err = remoteStreamSha256(sclient, remoteFile)
+	default:
+		return fmt.Errorf("unknown checksum mode %d", mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	if local != remote {
+		return &ChecksumError{File: remoteFile, Local: local, Remote: remote}
+	}
+	return nil
+}
+
+func (r *RemoteClient) remoteSha256(ctx context.Context, remoteFile string) (string, error) {
+	out, err := r.ExecContext(ctx, "sha256sum "+shellQuote(remoteFile))
+	if err != nil {
+		return "", fmt.Errorf("sha256sum %s fail:%w", remoteFile, err)
+	}
+	fields := strings.Fields(out)
+	if len(fields) == 0 {
+		return "", fmt.Errorf("sha256sum %s return empty", remoteFile)
+	}
+	return fields[0], nil
+}
+
+func fileSha256(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readerSha256(f)
+}
+
+func remoteStreamSha256(sclient *sftp.Client, remoteFile string) (string, error) {
+	f, err := sclient.Open(remoteFile)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	return readerSha256(f)
+}
+
+func readerSha256(r io.Reader) (string, error) {
+	h := sha256.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// shellQuote quotes s as one single quoted shell word.
+func shellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+type transferJob struct {
+	local  string
+	remote string
+}
+
+// ScpDirContext uploads localDir to remoteDir, opts.Parallel files at once.
+func (r *RemoteClient) ScpDirContext(ctx context.Context, localDir, remoteDir string, opts *TransferOptions) error {
+	sclient, err := r.pool.Sftp(r.ServerInfo)
+	if err != nil {
+		return err
+	}
+
+	localDir = strings.TrimRight(localDir, "/")
+	remoteDir = strings.TrimRight(remoteDir, "/")
+
+	jobs := make([]transferJob, 0)
+	err = filepath.Walk(localDir, func(lf string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, lf)
+		if err != nil {
+			return err
+		}
+		rf := path.Join(remoteDir, filepath.ToSlash(rel))
+		if info.IsDir() {
+			if err := sclient.MkdirAll(rf); err != nil {
+				return fmt.Errorf("create remote dir(%s) fail:%w", rf, err)
+			}
+			return nil
+		}
+		jobs = append(jobs, transferJob{local: lf, remote: rf})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return runTransferJobs(ctx, jobs, opts.parallel(), func(ctx context.Context, job transferJob) error {
+		return r.ScpFileContext(ctx, job.local, job.remote, opts)
+	})
+}
+
+// CopyDirContext downloads remoteDir to localDir, opts.Parallel files at once.
+func (r *RemoteClient) CopyDirContext(ctx context.Context, localDir, remoteDir string, opts *TransferOptions) error {
+	sclient, err := r.pool.Sftp(r.ServerInfo)
+	if err != nil {
+		return err
+	}
+
+	remoteDir = strings.TrimRight(remoteDir, "/")
+	jobs := make([]transferJob, 0)
+	walker := sclient.Walk(remoteDir)
+	for walker.Step() {
+		if err := walker.Err(); err != nil {
+			return err
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(walker.Path(), remoteDir), "/")
+		lf := filepath.Join(localDir, filepath.FromSlash(rel))
+		if walker.Stat().IsDir() {
+			if err := os.MkdirAll(lf, 0755); err != nil {
+				return err
+			}
+			continue
+		}
+		jobs = append(jobs, transferJob{local: lf, remote: walker.Path()})
+	}
+
+	return runTransferJobs(ctx, jobs, opts.parallel(), func(ctx context.Context, job transferJob) error {
+		return r.CopyFileContext(ctx, job.local, job.remote, opts)
+	})
+}
+
+// runTransferJobs runs the jobs on parallel workers and stops at the first error.
+func runTransferJobs(ctx context.Context, jobs []transferJob, parallel int, fn func(ctx context.Context, job transferJob) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	ch := make(chan transferJob)
+	var once sync.Once
+	var firstErr error
+	var wg sync.WaitGroup
+
+	wg.Add(parallel)
+	for i := 0; i < parallel; i++ {
+		go func() {
+			defer wg.Done()
+			for job := range ch {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := fn(ctx, job); err != nil {
+					once.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+loop:
+	for _, job := range jobs {
+		select {
+		case ch <- job:
+		case <-ctx.Done():
+			break loop
+		}
+	}
+	close(ch)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
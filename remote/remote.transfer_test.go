@@ -0,0 +1,75 @@
+package remote
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestShellQuote(t *testing.T) {
+	quotes := map[string]string{
+		"/tmp/a":      `'/tmp/a'`,
+		"/tmp/a b":    `'/tmp/a b'`,
+		"/tmp/it's":   `'/tmp/it'\''s'`,
+		"$(rm -rf /)": `'$(rm -rf /)'`,
+		"":            `''`,
+	}
+	for s, except := range quotes {
+		if actual := shellQuote(s); actual != except {
+			t.Errorf("shellQuote except:%s actual:%s", except, actual)
+		}
+	}
+}
+
+func TestProgressReader(t *testing.T) {
+	var last TransferProgress
+	pr := &progressReader{
+		ctx:      context.Background(),
+		r:        strings.NewReader(strings.Repeat("a", 10)),
+		progress: TransferProgress{Transferred: 5, Total: 15},
+		fn: func(p *TransferProgress) {
+			last = *p
+		},
+	}
+
+	var sb strings.Builder
+	if err := copyChunks(&sb, pr, 3); err != nil {
+		t.Fatal(err)
+	}
+	if sb.Len() != 10 || last.Transferred != 15 || last.Total != 15 {
+		t.Errorf("unexpected progress %+v, copied %d", last, sb.Len())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	pr = &progressReader{ctx: ctx, r: strings.NewReader("abc")}
+	if err := copyChunks(&sb, pr, 3); !errors.Is(err, context.Canceled) {
+		t.Errorf("except context canceled, actual %v", err)
+	}
+}
+
+func TestRunTransferJobs(t *testing.T) {
+	jobs := make([]transferJob, 20)
+	var count int32
+	err := runTransferJobs(context.Background(), jobs, 4, func(ctx context.Context, job transferJob) error {
+		atomic.AddInt32(&count, 1)
+		return nil
+	})
+	if err != nil || count != 20 {
+		t.Errorf("except 20 jobs without error, actual %d %v", count, err)
+	}
+
+	failed := errors.New("failed")
+	count = 0
+	err = runTransferJobs(context.Background(), jobs, 1, func(ctx context.Context, job transferJob) error {
+		if atomic.AddInt32(&count, 1) == 3 {
+			return failed
+		}
+		return nil
+	})
+	if !errors.Is(err, failed) || count != 3 {
+		t.Errorf("except stop at the first error, actual %d %v", count, err)
+	}
+}
@@ -1,76 +1,357 @@
 package remote
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/champly/lib4go/remote/remotetest"
+	"golang.org/x/crypto/ssh"
 )
 
+// newTestServer starts a test server and returns the ServerInfo to reach it.
+func newTestServer(t *testing.T, opts *remotetest.Options) (*remotetest.Server, *ServerInfo) {
+	srv := remotetest.NewServer(t, opts)
+	fp := ssh.FingerprintSHA256(srv.HostKey())
+	return srv, &ServerInfo{
+		User:     "root",
+		Password: "123456",
+		Host:     srv.Host(),
+		Port:     srv.Port(),
+		HostKey:  FixedFingerprints(fp),
+	}
+}
+
+// newTestClient connects to a new test server through its own pool.
+func newTestClient(t *testing.T, opts *remotetest.Options) (*remotetest.Server, *RemoteClient) {
+	srv, info := newTestServer(t, opts)
+	pool := NewPool(nil)
+	t.Cleanup(pool.Close)
+
+	client, err := NewRemoteClientWithPool(info, pool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return srv, client
+}
+
 func TestExec(t *testing.T) {
-	// create client
-	client, err := NewRemoteClient(&ServerInfo{
-		Host: "10.12.192.131",
-		User: "root",
-		Key:  rsaPriv,
-		Port: 22,
+	srv, client := newTestClient(t, nil)
+	defer client.Close()
+
+	r, err := client.Exec("echo hello; pwd")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r != "hello\n"+srv.Root()+"\n" {
+		t.Errorf("unexpected output %q", r)
+	}
+
+	r, err = client.Exec("echo fail >&2; exit 3")
+	var ee *ExitError
+	if !errors.As(err, &ee) || ee.Code != 3 || ee.Output != "fail\n" || ee.Cmd != "echo fail >&2; exit 3" {
+		t.Errorf("except exit 3 with its output, actual %q %v", r, err)
+	}
+	if !strings.Contains(err.Error(), "fail") || !strings.Contains(err.Error(), "status 3") {
+		t.Errorf("error should keep the output, actual %v", err)
+	}
+
+	srv.Handle("uptime", remotetest.Reply("up 1 day\n", 0))
+	if r, err = client.Exec("uptime"); err != nil || r != "up 1 day\n" {
+		t.Errorf("handler output %q %v", r, err)
+	}
+}
+
+func TestExecWithTimeout(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	srv.Handle("wait", remotetest.Hang("started\n"))
+
+	start := time.Now()
+	if _, err := client.ExecWithTimeout("wait", 100*time.Millisecond); !errors.Is(err, ErrTimeout) || !errors.Is(err, context.DeadlineExceeded) || err.Error() != "exec timeout" {
+		t.Errorf("except exec timeout, actual %v", err)
+	}
+	if time.Since(start) > killWait {
+		t.Error("timeout should not wait for the command")
+	}
+
+	// the connection is still usable
+	if r, err := client.Exec("echo ok"); err != nil || r != "ok\n" {
+		t.Errorf("exec after timeout %q %v", r, err)
+	}
+}
+
+func TestExecContextSignal(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	signals := make(chan string, 1)
+	srv.Handle("wait", func(cmd *remotetest.Command) int {
+		sig := <-cmd.Signals()
+		signals <- sig
+		return 130
 	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(100*time.Millisecond, cancel)
+	if _, err := client.ExecContext(ctx, "wait", WithSignal(ssh.SIGINT)); !errors.Is(err, context.Canceled) {
+		t.Errorf("except context canceled, actual %v", err)
+	}
+	select {
+	case sig := <-signals:
+		if sig != string(ssh.SIGINT) {
+			t.Errorf("except INT, actual %s", sig)
+		}
+	case <-time.After(time.Second):
+		t.Error("signal not received")
+	}
+}
+
+func TestExecPty(t *testing.T) {
+	_, client := newTestClient(t, nil)
+	r, err := client.ExecContext(context.Background(), "echo $TERM; echo err >&2", WithPty())
 	if err != nil {
-		t.Error(err)
-		return
+		t.Fatal(err)
+	}
+	if !strings.Contains(r, "xterm") || !strings.Contains(r, "err") {
+		t.Errorf("pty should set TERM and merge stderr, actual %q", r)
+	}
+}
+
+func TestScpAndCopy(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	local := t.TempDir()
+
+	os.MkdirAll(filepath.Join(local, "src", "sub"), 0755)
+	os.WriteFile(filepath.Join(local, "src", "a.txt"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(local, "src", "sub", "b.txt"), []byte("bb"), 0644)
+
+	remoteDir := filepath.Join(srv.Root(), "dst")
+	if err := client.ScpDir(filepath.Join(local, "src"), remoteDir); err != nil {
+		t.Fatal(err)
+	}
+	if b, err := os.ReadFile(filepath.Join(remoteDir, "sub", "b.txt")); err != nil || string(b) != "bb" {
+		t.Errorf("scp dir %q %v", b, err)
 	}
-	defer client.Close()
-	fmt.Println("connect success")
 
-	// exec cmd
-	r, err := client.Exec("cd /root/demo && docker build -t demo .")
+	remoteFile := filepath.Join(srv.Root(), "single.txt")
+	if err := client.ScpFile(filepath.Join(local, "src", "a.txt"), remoteFile); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CopyFile(filepath.Join(local, "back.txt"), remoteFile); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(local, "back.txt")); string(b) != "a" {
+		t.Errorf("copy file %q", b)
+	}
+
+	if err := client.CopyDir(filepath.Join(local, "back"), remoteDir); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(local, "back", "sub", "b.txt")); string(b) != "bb" {
+		t.Errorf("copy dir %q", b)
+	}
+
+	err := client.ScpFileContext(context.Background(), filepath.Join(local, "src", "a.txt"), remoteFile, &TransferOptions{Checksum: ChecksumRemote})
+	if err != nil {
+		t.Errorf("checksum remote %v", err)
+	}
+	err = client.ScpFileContext(context.Background(), filepath.Join(local, "src", "a.txt"), remoteFile, &TransferOptions{Checksum: ChecksumStream})
 	if err != nil {
+		t.Errorf("checksum stream %v", err)
+	}
+}
+
+func TestScpAndCopyResume(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	local := filepath.Join(t.TempDir(), "src.txt")
+	remoteFile := filepath.Join(srv.Root(), "dst.txt")
+	os.WriteFile(local, []byte("0123456789"), 0644)
+	opts := &TransferOptions{Resume: true}
+
+	// a valid partial upload is continued, a stale one is rewritten
+	for _, partial := range []string{"01234", "abcde"} {
+		os.WriteFile(remoteFile, []byte(partial), 0644)
+		if err := client.ScpFileContext(context.Background(), local, remoteFile, opts); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := os.ReadFile(remoteFile); string(b) != "0123456789" {
+			t.Errorf("resume upload from %q, actual %q", partial, b)
+		}
+	}
+
+	back := filepath.Join(t.TempDir(), "back", "dst.txt")
+	for _, partial := range []string{"", "01234", "abcde"} {
+		if partial != "" {
+			os.WriteFile(back, []byte(partial), 0644)
+		}
+		if err := client.CopyFileContext(context.Background(), back, remoteFile, opts); err != nil {
+			t.Fatal(err)
+		}
+		if b, _ := os.ReadFile(back); string(b) != "0123456789" {
+			t.Errorf("resume download from %q, actual %q", partial, b)
+		}
+	}
+	if info, err := os.Stat(filepath.Dir(back)); err != nil {
 		t.Error(err)
-		return
+	} else if info.Mode().Perm()&^0755 != 0 {
+		t.Errorf("local dir should be created with 0755, actual %v", info.Mode())
+	}
+}
+
+func TestUseBashExecScript(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	file := filepath.Join(srv.Root(), "tmp", "exec.sh")
+	r, err := client.UseBashExecScript(file, "#!/bin/bash\necho script")
+	if err != nil || r != "script\n" {
+		t.Errorf("script output %q %v", r, err)
+	}
+	if _, err = os.Stat(file); !os.IsNotExist(err) {
+		t.Errorf("script file should be removed, %v", err)
+	}
+}
+
+func TestRunScript(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	client.Vars = map[string]string{"name": "db1"}
+
+	asset := filepath.Join(t.TempDir(), "data.txt")
+	os.WriteFile(asset, []byte("asset"), 0644)
+
+	res, err := client.RunScript(context.Background(), &Script{
+		Content: "cat data.txt; echo {{ .Vars.name }} $MODE; stat -c %a {{ .Dir }}; exit 2",
+		Env:     map[string]string{"MODE": "test"},
+		Assets:  []string{asset},
+		Dir:     srv.Root(),
+	})
+	if res == nil || res.ExitCode != 2 || res.Stdout != "assetdb1 test\n700\n" {
+		t.Errorf("unexpected script result %+v %v", res, err)
 	}
-	fmt.Println(r)
 
-	fmt.Println("等待关闭系统")
-	time.Sleep(time.Second * 50)
-	fmt.Println("开始执行下一步")
+	// the temporary dir is removed
+	entries, _ := os.ReadDir(srv.Root())
+	if len(entries) != 0 {
+		t.Errorf("script dir should be removed, found %d entries", len(entries))
+	}
+}
 
-	r, err = client.Exec("cat /etc/passwd")
+func TestSyncDir(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	local := t.TempDir()
+	remoteDir := filepath.Join(srv.Root(), "sync")
+
+	os.MkdirAll(filepath.Join(local, "conf"), 0755)
+	os.WriteFile(filepath.Join(local, "conf", "a.yaml"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(local, "b.log"), []byte("b"), 0644)
+	os.MkdirAll(filepath.Join(remoteDir, "old"), 0755)
+	os.WriteFile(filepath.Join(remoteDir, "old", "c"), []byte("c"), 0644)
+
+	opts := &SyncOptions{Delete: true, Exclude: []string{"*.log"}, Checksum: true}
+	plan, err := client.SyncDir(local, remoteDir, opts)
 	if err != nil {
-		t.Error(err)
-		return
-	}
-	fmt.Println(r)
-
-	// r, err = client.Exec("date")
-	// if err != nil {
-	// t.Error(err)
-	// return
-	// }
-	// t.Log(r)
-
-	// // scp file
-	// if err = client.ScpFile("./remote.go", "/root/tmp/src/remote.go"); err != nil {
-	// t.Error(err)
-	// }
-
-	// // scp dir
-	// if err = client.ScpDir("/Users/champly/Downloads/bak/rpm", "/root/tmp/rpm"); err != nil {
-	// t.Error(err)
-	// }
-
-	// // scp bash an exec
-	// r, err = client.UseBashExecScript("/root/tmp/exec.sh", "#!/bin/bash\ndate")
-	// if err != nil {
-	// t.Error(err)
-	// return
-	// }
-
-	// // scp dir
-	// if err = client.ScpDir("/Users/champly/Documents/kops/test/k8s", "/root/tmp/rpm"); err != nil {
-	// t.Error(err)
-	// }
-
-	// copy dir
-	// if err = client.CopyDir("/etc/kubernetes", "/Users/champly/Downloads/kubernetes"); err != nil {
-	// t.Error(err)
-	// }
+		t.Fatal(err)
+	}
+	if len(plan.Upload) != 1 || plan.Upload[0] != "conf/a.yaml" || len(plan.Delete) != 2 {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+
+	plan, err = client.SyncDir(local, remoteDir, opts)
+	if err != nil || len(plan.Upload)+len(plan.Mkdir)+len(plan.Delete) != 0 {
+		t.Errorf("second sync should do nothing, actual %+v %v", plan, err)
+	}
+}
+
+func TestSyncDirConflict(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	local := t.TempDir()
+	remoteDir := filepath.Join(srv.Root(), "sync")
+
+	// x is a file locally and a dir remotely, y the other way round
+	os.WriteFile(filepath.Join(local, "x"), []byte("x"), 0644)
+	os.MkdirAll(filepath.Join(local, "y"), 0755)
+	os.WriteFile(filepath.Join(local, "y", "a"), []byte("a"), 0644)
+	os.MkdirAll(filepath.Join(remoteDir, "x"), 0755)
+	os.WriteFile(filepath.Join(remoteDir, "x", "b"), []byte("b"), 0644)
+	os.WriteFile(filepath.Join(remoteDir, "y"), []byte("y"), 0644)
+
+	_, err := client.SyncDir(local, remoteDir, nil)
+	if err == nil || !strings.Contains(err.Error(), "sync x fail") || !strings.Contains(err.Error(), "sync y fail") {
+		t.Errorf("except an error for x and y, actual %v", err)
+	}
+	if info, _ := os.Stat(filepath.Join(remoteDir, "x")); info == nil || !info.IsDir() {
+		t.Error("remote x should be kept without Delete")
+	}
+
+	if _, err = client.SyncDir(local, remoteDir, &SyncOptions{Delete: true}); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(filepath.Join(remoteDir, "x")); string(b) != "x" {
+		t.Errorf("remote x should be replaced by the file, actual %q", b)
+	}
+	if b, _ := os.ReadFile(filepath.Join(remoteDir, "y", "a")); string(b) != "a" {
+		t.Errorf("remote y should be replaced by the dir, actual %q", b)
+	}
+}
+
+func TestSyncDirDeleteExcluded(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	local := t.TempDir()
+	remoteDir := filepath.Join(srv.Root(), "sync")
+
+	os.WriteFile(filepath.Join(local, "a"), []byte("a"), 0644)
+	os.MkdirAll(filepath.Join(remoteDir, "old", "logs"), 0755)
+	os.WriteFile(filepath.Join(remoteDir, "old", "c"), []byte("c"), 0644)
+	os.WriteFile(filepath.Join(remoteDir, "old", "logs", "app.log"), []byte("log"), 0644)
+
+	plan, err := client.SyncDir(local, remoteDir, &SyncOptions{Delete: true, Exclude: []string{"*.log"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Delete) != 1 || plan.Delete[0] != "old/c" {
+		t.Errorf("only old/c should be deleted, actual %+v", plan)
+	}
+	if _, err = os.Stat(filepath.Join(remoteDir, "old", "logs", "app.log")); err != nil {
+		t.Errorf("excluded file should be kept, %v", err)
+	}
+}
+
+func TestSyncDirDryRun(t *testing.T) {
+	srv, client := newTestClient(t, nil)
+	local := t.TempDir()
+	remoteDir := filepath.Join(srv.Root(), "sync")
+
+	os.MkdirAll(filepath.Join(local, "conf"), 0755)
+	os.WriteFile(filepath.Join(local, "conf", "a.yaml"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(local, "b"), []byte("new"), 0644)
+	os.MkdirAll(filepath.Join(remoteDir, "old"), 0755)
+	os.WriteFile(filepath.Join(remoteDir, "old", "c"), []byte("c"), 0644)
+	os.WriteFile(filepath.Join(remoteDir, "b"), []byte("b"), 0644)
+
+	snapshot := func() string {
+		var sb strings.Builder
+		filepath.Walk(remoteDir, func(p string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			b, _ := os.ReadFile(p)
+			sb.WriteString(p + ":" + info.Mode().String() + ":" + string(b) + "\n")
+			return nil
+		})
+		return sb.String()
+	}
+	before := snapshot()
+
+	plan, err := client.SyncDir(local, remoteDir, &SyncOptions{DryRun: true, Delete: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(plan.Mkdir, ",") != "conf" ||
+		strings.Join(plan.Upload, ",") != "b,conf/a.yaml" ||
+		strings.Join(plan.Delete, ",") != "old/c,old" {
+		t.Errorf("unexpected plan %+v", plan)
+	}
+	if after := snapshot(); after != before {
+		t.Errorf("dry run should not change the remote dir\nbefore:\n%s\nafter:\n%s", before, after)
+	}
 }
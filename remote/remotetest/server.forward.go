@@ -0,0 +1,161 @@
+package remotetest
+
+import (
+	"io"
+	"net"
+	"strconv"
+	"sync"
+
+	"golang.org/x/crypto/ssh"
+)
+
+type directTCPIPPayload struct {
+	Host     string
+	Port     uint32
+	OrigHost string
+	OrigPort uint32
+}
+
+type tcpipForwardPayload struct {
+	Addr string
+	Port uint32
+}
+
+type forwardedTCPIPPayload struct {
+	Addr     string
+	Port     uint32
+	OrigAddr string
+	OrigPort uint32
+}
+
+// directTCPIP serves the connections dialed through the server, like ssh -L.
+func directTCPIP(nch ssh.NewChannel, closed <-chan struct{}) {
+	var p directTCPIPPayload
+	if err := ssh.Unmarshal(nch.ExtraData(), &p); err != nil {
+		nch.Reject(ssh.ConnectionFailed, "invalid payload")
+		return
+	}
+
+	conn, err := net.Dial("tcp", net.JoinHostPort(p.Host, strconv.Itoa(int(p.Port))))
+	if err != nil {
+		nch.Reject(ssh.ConnectionFailed, err.Error())
+		return
+	}
+	ch, reqs, err := nch.Accept()
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn, closed)
+}
+
+// forwards are the listeners opened by tcpip-forward requests, like ssh -R.
+type forwards struct {
+	conn      *ssh.ServerConn
+	closed    <-chan struct{}
+	l         sync.Mutex
+	listeners map[string]net.Listener
+}
+
+func (f *forwards) listen(payload []byte) (uint32, error) {
+	var p tcpipForwardPayload
+	if err := ssh.Unmarshal(payload, &p); err != nil {
+		return 0, err
+	}
+
+	l, err := net.Listen("tcp", net.JoinHostPort(p.Addr, strconv.Itoa(int(p.Port))))
+	if err != nil {
+		return 0, err
+	}
+	port := uint32(l.Addr().(*net.TCPAddr).Port)
+
+	f.l.Lock()
+	f.listeners[net.JoinHostPort(p.Addr, strconv.Itoa(int(port)))] = l
+	f.l.Unlock()
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go f.forward(conn, p.Addr, port)
+		}
+	}()
+	return port, nil
+}
+
+func (f *forwards) forward(conn net.Conn, addr string, port uint32) {
+	orig := conn.RemoteAddr().(*net.TCPAddr)
+	ch, reqs, err := f.conn.OpenChannel("forwarded-tcpip", ssh.Marshal(&forwardedTCPIPPayload{
+		Addr:     addr,
+		Port:     port,
+		OrigAddr: orig.IP.String(),
+		OrigPort: uint32(orig.Port),
+	}))
+	if err != nil {
+		conn.Close()
+		return
+	}
+	go ssh.DiscardRequests(reqs)
+	pipe(ch, conn, f.closed)
+}
+
+func (f *forwards) cancel(payload []byte) bool {
+	var p tcpipForwardPayload
+	if err := ssh.Unmarshal(payload, &p); err != nil {
+		return false
+	}
+
+	key := net.JoinHostPort(p.Addr, strconv.Itoa(int(p.Port)))
+	f.l.Lock()
+	l, ok := f.listeners[key]
+	delete(f.listeners, key)
+	f.l.Unlock()
+	if ok {
+		l.Close()
+	}
+	return ok
+}
+
+func (f *forwards) close() {
+	f.l.Lock()
+	defer f.l.Unlock()
+	for key, l := range f.listeners {
+		l.Close()
+		delete(f.listeners, key)
+	}
+}
+
+// pipe copies both directions, half closing each side at EOF, then closes
+// both. conn is closed early when the ssh connection is closed.
+func pipe(ch ssh.Channel, conn net.Conn, closed <-chan struct{}) {
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-closed:
+			conn.Close()
+		case <-done:
+		}
+	}()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		io.Copy(ch, conn)
+		ch.CloseWrite()
+	}()
+	go func() {
+		defer wg.Done()
+		io.Copy(conn, ch)
+		if tc, ok := conn.(*net.TCPConn); ok {
+			tc.CloseWrite()
+		}
+	}()
+	wg.Wait()
+	ch.Close()
+	conn.Close()
+}
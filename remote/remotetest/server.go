@@ -0,0 +1,558 @@
+// Package remotetest provides an in-process SSH server for testing the
+// remote package without real hosts.
+package remotetest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+)
+
+// Options configures a Server, the zero value accepts any user and password.
+type Options struct {
+	// Passwords maps users to their password, nil accepts any password
+	Passwords map[string]string
+	// AuthorizedKeys are accepted for every user
+	AuthorizedKeys []ssh.PublicKey
+	// CertAuthorities sign the accepted user certificates
+	CertAuthorities []ssh.PublicKey
+	// KeyboardInteractive maps users to the answers of their single question
+	KeyboardInteractive map[string]string
+	// HostKey is the host key, an ed25519 key is generated when nil
+	HostKey ssh.Signer
+	// Root is the working directory of commands, t.TempDir() when empty
+	Root string
+	// Handler runs the commands without a more specific handler, default Shell
+	Handler Handler
+	// DisableSftp rejects the sftp subsystem
+	DisableSftp bool
+	// Silent accepts connections but never speaks SSH, like a hung sshd
+	Silent bool
+}
+
+// Server is an SSH server listening on a loopback port. Commands run on the
+// local machine and sftp serves the local filesystem, so tests should only
+// touch paths under Root.
+type Server struct {
+	opts     Options
+	config   *ssh.ServerConfig
+	listener net.Listener
+
+	l        sync.Mutex
+	handlers map[string]Handler
+	// conns are the accepted connections, true once the handshake is done
+	conns    map[net.Conn]bool
+	commands []string
+	dropNext int
+	delay    time.Duration
+	dialed   int
+	wg       sync.WaitGroup
+}
+
+// NewServer starts a Server that is closed when the test ends.
+func NewServer(t testing.TB, opts *Options) *Server {
+	t.Helper()
+	if opts == nil {
+		opts = &Options{}
+	}
+	if opts.Root == "" {
+		opts.Root = t.TempDir()
+	}
+	s, err := Start(opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(s.Close)
+	return s
+}
+
+// Start starts a Server, it must be closed by Close.
+func Start(opts *Options) (*Server, error) {
+	s := &Server{
+		opts:     *opts,
+		handlers: map[string]Handler{},
+		conns:    map[net.Conn]bool{},
+	}
+	if s.opts.Handler == nil {
+		s.opts.Handler = Shell
+	}
+	if s.opts.HostKey == nil {
+		_, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		if s.opts.HostKey, err = ssh.NewSignerFromKey(priv); err != nil {
+			return nil, err
+		}
+	}
+
+	s.config = s.serverConfig()
+	s.config.AddHostKey(s.opts.HostKey)
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	s.listener = l
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+func (s *Server) serverConfig() *ssh.ServerConfig {
+	config := &ssh.ServerConfig{}
+	config.PasswordCallback = func(c ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+		if s.opts.Passwords == nil {
+			return nil, nil
+		}
+		if want, ok := s.opts.Passwords[c.User()]; ok && want == string(password) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("password rejected for %s", c.User())
+	}
+
+	keys := &ssh.CertChecker{
+		IsUserAuthority: func(auth ssh.PublicKey) bool {
+			for _, ca := range s.opts.CertAuthorities {
+				if bytes.Equal(ca.Marshal(), auth.Marshal()) {
+					return true
+				}
+			}
+			return false
+		},
+		UserKeyFallback: func(c ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			for _, k := range s.opts.AuthorizedKeys {
+				if bytes.Equal(k.Marshal(), key.Marshal()) {
+					return nil, nil
+				}
+			}
+			return nil, fmt.Errorf("public key rejected for %s", c.User())
+		},
+	}
+	config.PublicKeyCallback = keys.Authenticate
+
+	if s.opts.KeyboardInteractive != nil {
+		config.KeyboardInteractiveCallback = func(c ssh.ConnMetadata, client ssh.KeyboardInteractiveChallenge) (*ssh.Permissions, error) {
+			answers, err := client(c.User(), "", []string{"Password: "}, []bool{false})
+			if err != nil {
+				return nil, err
+			}
+			if want, ok := s.opts.KeyboardInteractive[c.User()]; ok && len(answers) == 1 && answers[0] == want {
+				return nil, nil
+			}
+			return nil, fmt.Errorf("keyboard interactive rejected for %s", c.User())
+		}
+	}
+	return config
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Host returns the host the server listens on.
+func (s *Server) Host() string {
+	host, _, _ := net.SplitHostPort(s.Addr())
+	return host
+}
+
+// Port returns the port the server listens on.
+func (s *Server) Port() int {
+	_, port, _ := net.SplitHostPort(s.Addr())
+	p, _ := strconv.Atoi(port)
+	return p
+}
+
+// Root returns the working directory of the commands.
+func (s *Server) Root() string {
+	return s.opts.Root
+}
+
+// HostKey returns the public host key.
+func (s *Server) HostKey() ssh.PublicKey {
+	return s.opts.HostKey.PublicKey()
+}
+
+// Handle runs h for the commands starting with prefix, the longest prefix wins.
+// The empty prefix handles the interactive shell.
+func (s *Server) Handle(prefix string, h Handler) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.handlers[prefix] = h
+}
+
+func (s *Server) handler(cmd string) Handler {
+	s.l.Lock()
+	defer s.l.Unlock()
+
+	if cmd == "" {
+		if h, ok := s.handlers[""]; ok {
+			return h
+		}
+		return s.opts.Handler
+	}
+
+	best, h := -1, s.opts.Handler
+	for prefix, ph := range s.handlers {
+		if prefix != "" && strings.HasPrefix(cmd, prefix) && len(prefix) > best {
+			best, h = len(prefix), ph
+		}
+	}
+	return h
+}
+
+// Commands returns the commands run so far.
+func (s *Server) Commands() []string {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return append([]string{}, s.commands...)
+}
+
+// Connections returns the open ssh connections.
+func (s *Server) Connections() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	n := 0
+	for _, ready := range s.conns {
+		if ready {
+			n++
+		}
+	}
+	return n
+}
+
+// Dialed returns the number of accepted ssh connections.
+func (s *Server) Dialed() int {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.dialed
+}
+
+// Drop closes all open connections.
+func (s *Server) Drop() {
+	s.l.Lock()
+	conns := make([]net.Conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.l.Unlock()
+
+	for _, c := range conns {
+		c.Close()
+	}
+}
+
+// DropNext closes the next n connections before the handshake.
+func (s *Server) DropNext(n int) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.dropNext = n
+}
+
+// SetOutputDelay delays every write of the commands output by d.
+func (s *Server) SetOutputDelay(d time.Duration) {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.delay = d
+}
+
+func (s *Server) outputDelay() time.Duration {
+	s.l.Lock()
+	defer s.l.Unlock()
+	return s.delay
+}
+
+// Close stops the server and closes all connections.
+func (s *Server) Close() {
+	s.listener.Close()
+	s.Drop()
+	s.wg.Wait()
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		s.l.Lock()
+		drop := s.dropNext > 0
+		if drop {
+			s.dropNext--
+		}
+		s.l.Unlock()
+		if drop {
+			conn.Close()
+			continue
+		}
+
+		s.l.Lock()
+		s.conns[conn] = false
+		s.l.Unlock()
+		s.wg.Add(1)
+		go s.serveConn(conn)
+	}
+}
+
+func (s *Server) serveConn(nc net.Conn) {
+	defer s.wg.Done()
+	defer func() {
+		s.l.Lock()
+		delete(s.conns, nc)
+		s.l.Unlock()
+	}()
+
+	if s.opts.Silent {
+		io.Copy(io.Discard, nc)
+		nc.Close()
+		return
+	}
+
+	conn, chans, reqs, err := ssh.NewServerConn(nc, s.config)
+	if err != nil {
+		nc.Close()
+		return
+	}
+	defer conn.Close()
+
+	s.l.Lock()
+	s.conns[nc] = true
+	s.dialed++
+	s.l.Unlock()
+
+	closed := make(chan struct{})
+	defer close(closed)
+
+	fw := &forwards{conn: conn, closed: closed, listeners: map[string]net.Listener{}}
+	defer fw.close()
+	go s.globalRequests(reqs, fw)
+
+	var wg sync.WaitGroup
+	for nch := range chans {
+		switch nch.ChannelType() {
+		case "session":
+			ch, requests, err := nch.Accept()
+			if err != nil {
+				continue
+			}
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				s.session(conn, ch, requests)
+			}()
+		case "direct-tcpip":
+			go directTCPIP(nch, closed)
+		default:
+			nch.Reject(ssh.UnknownChannelType, "unknown channel type "+nch.ChannelType())
+		}
+	}
+	wg.Wait()
+}
+
+func (s *Server) globalRequests(reqs <-chan *ssh.Request, fw *forwards) {
+	for req := range reqs {
+		switch req.Type {
+		case "keepalive@openssh.com":
+			req.Reply(true, nil)
+		case "tcpip-forward":
+			port, err := fw.listen(req.Payload)
+			if err != nil {
+				log.Printf("remotetest: tcpip-forward fail:%s", err)
+				req.Reply(false, nil)
+				continue
+			}
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, port)
+			req.Reply(true, b)
+		case "cancel-tcpip-forward":
+			req.Reply(fw.cancel(req.Payload), nil)
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+type ptyRequest struct {
+	Term   string
+	Width  uint32
+	Height uint32
+	PxW    uint32
+	PxH    uint32
+	Modes  string
+}
+
+type windowChange struct {
+	Width  uint32
+	Height uint32
+	PxW    uint32
+	PxH    uint32
+}
+
+type exitStatus struct {
+	Status uint32
+}
+
+func (s *Server) session(conn *ssh.ServerConn, ch ssh.Channel, requests <-chan *ssh.Request) {
+	defer ch.Close()
+
+	cmd := &Command{
+		User:    conn.User(),
+		Env:     map[string]string{},
+		Root:    s.opts.Root,
+		ch:      ch,
+		Stdin:   ch,
+		Stdout:  ch,
+		Stderr:  ch.Stderr(),
+		signals: make(chan string, 4),
+		resize:  make(chan Window, 4),
+		done:    make(chan struct{}),
+	}
+
+	started := false
+	exited := make(chan int, 1)
+	for {
+		var req *ssh.Request
+		var ok bool
+		select {
+		case req, ok = <-requests:
+		case code := <-exited:
+			if code >= 0 {
+				ch.SendRequest("exit-status", false, ssh.Marshal(&exitStatus{Status: uint32(code)}))
+			}
+			return
+		}
+		if !ok {
+			if started {
+				close(cmd.done)
+				<-exited
+			}
+			return
+		}
+
+		switch req.Type {
+		case "env":
+			var kv struct{ Name, Value string }
+			if ssh.Unmarshal(req.Payload, &kv) == nil {
+				cmd.Env[kv.Name] = kv.Value
+			}
+			req.Reply(true, nil)
+		case "pty-req":
+			var p ptyRequest
+			if err := ssh.Unmarshal(req.Payload, &p); err != nil {
+				req.Reply(false, nil)
+				continue
+			}
+			cmd.Pty = &Pty{Term: p.Term, Window: Window{Width: int(p.Width), Height: int(p.Height)}}
+			req.Reply(true, nil)
+		case "window-change":
+			var w windowChange
+			if ssh.Unmarshal(req.Payload, &w) == nil {
+				select {
+				case cmd.resize <- Window{Width: int(w.Width), Height: int(w.Height)}:
+				default:
+				}
+			}
+		case "signal":
+			var sig struct{ Signal string }
+			if ssh.Unmarshal(req.Payload, &sig) == nil {
+				select {
+				case cmd.signals <- sig.Signal:
+				default:
+				}
+			}
+		case "exec", "shell", "subsystem":
+			if started {
+				req.Reply(false, nil)
+				continue
+			}
+			var h Handler
+			switch req.Type {
+			case "exec":
+				var payload struct{ Command string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil {
+					req.Reply(false, nil)
+					continue
+				}
+				cmd.Cmd = payload.Command
+				h = s.handler(cmd.Cmd)
+			case "shell":
+				h = s.handler("")
+			case "subsystem":
+				var payload struct{ Name string }
+				if err := ssh.Unmarshal(req.Payload, &payload); err != nil || payload.Name != "sftp" || s.opts.DisableSftp {
+					req.Reply(false, nil)
+					continue
+				}
+				h = serveSftp
+			}
+
+			s.l.Lock()
+			s.commands = append(s.commands, cmd.Cmd)
+			s.l.Unlock()
+
+			if d := s.outputDelay(); d > 0 {
+				cmd.Stdout = &slowWriter{w: cmd.Stdout, d: d}
+				cmd.Stderr = &slowWriter{w: cmd.Stderr, d: d}
+			}
+			if cmd.Pty != nil {
+				cmd.Stderr = cmd.Stdout
+			}
+
+			started = true
+			req.Reply(true, nil)
+			go func() {
+				code := h(cmd)
+				ch.CloseWrite()
+				exited <- code
+			}()
+		default:
+			if req.WantReply {
+				req.Reply(false, nil)
+			}
+		}
+	}
+}
+
+func serveSftp(cmd *Command) int {
+	server, err := sftp.NewServer(cmd.ch)
+	if err != nil {
+		return 1
+	}
+	go func() {
+		<-cmd.Done()
+		server.Close()
+	}()
+	if err := server.Serve(); err != nil {
+		server.Close()
+	}
+	return -1
+}
+
+type slowWriter struct {
+	w interface{ Write([]byte) (int, error) }
+	d time.Duration
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.d)
+	return w.w.Write(p)
+}
@@ -0,0 +1,182 @@
+package remotetest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+// Handler runs a command and returns its exit status, a negative status
+// closes the channel without sending one.
+type Handler func(cmd *Command) int
+
+// Window is a terminal size.
+type Window struct {
+	Width  int
+	Height int
+}
+
+// Pty is the terminal requested by the client.
+type Pty struct {
+	Term string
+	Window
+}
+
+// Command is an exec, shell or subsystem request of a session.
+type Command struct {
+	// Cmd is the exec command, empty for the interactive shell
+	Cmd  string
+	User string
+	// Env are the variables set by the client
+	Env map[string]string
+	// Pty is nil unless the client requested one, Stderr is Stdout then
+	Pty *Pty
+	// Root is the working directory
+	Root string
+
+	Stdin  io.Reader
+	Stdout io.Writer
+	Stderr io.Writer
+
+	ch      ssh.Channel
+	signals chan string
+	resize  chan Window
+	done    chan struct{}
+}
+
+// Signals receives the names of the signals sent by the client, like KILL.
+func (c *Command) Signals() <-chan string {
+	return c.signals
+}
+
+// Resize receives the window changes of the pty.
+func (c *Command) Resize() <-chan Window {
+	return c.resize
+}
+
+// Done is closed when the client closed the session.
+func (c *Command) Done() <-chan struct{} {
+	return c.done
+}
+
+// Reply returns a Handler that writes stdout and exits with code.
+func Reply(stdout string, code int) Handler {
+	return func(cmd *Command) int {
+		io.WriteString(cmd.Stdout, stdout)
+		return code
+	}
+}
+
+// Hang returns a Handler that writes stdout and blocks until a signal or the
+// session is closed, it exits with 128 plus the signal number like sh.
+func Hang(stdout string) Handler {
+	return func(cmd *Command) int {
+		io.WriteString(cmd.Stdout, stdout)
+		select {
+		case sig := <-cmd.Signals():
+			return 128 + int(signalNumber(sig))
+		case <-cmd.Done():
+			return -1
+		}
+	}
+}
+
+var signals = map[string]syscall.Signal{
+	"ABRT": syscall.SIGABRT,
+	"ALRM": syscall.SIGALRM,
+	"FPE":  syscall.SIGFPE,
+	"HUP":  syscall.SIGHUP,
+	"ILL":  syscall.SIGILL,
+	"INT":  syscall.SIGINT,
+	"KILL": syscall.SIGKILL,
+	"PIPE": syscall.SIGPIPE,
+	"QUIT": syscall.SIGQUIT,
+	"SEGV": syscall.SIGSEGV,
+	"TERM": syscall.SIGTERM,
+	"USR1": syscall.SIGUSR1,
+	"USR2": syscall.SIGUSR2,
+}
+
+func signalNumber(name string) syscall.Signal {
+	if sig, ok := signals[name]; ok {
+		return sig
+	}
+	return syscall.SIGKILL
+}
+
+// Shell runs the command with sh -c in Root, or an interactive sh for the
+// shell request. Signals are forwarded to the process, which is killed when
+// the session is closed.
+func Shell(cmd *Command) int {
+	args := []string{"-c", cmd.Cmd}
+	if cmd.Cmd == "" {
+		args = []string{"-s"}
+	}
+
+	c := exec.Command("sh", args...)
+	c.Dir = cmd.Root
+	c.Env = os.Environ()
+	for k, v := range cmd.Env {
+		c.Env = append(c.Env, k+"="+v)
+	}
+	if cmd.Pty != nil {
+		c.Env = append(c.Env, "TERM="+cmd.Pty.Term)
+	}
+	c.Stdout = cmd.Stdout
+	c.Stderr = cmd.Stderr
+	// signals go to the whole process group, like a terminal does
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	c.WaitDelay = time.Second
+
+	// the stdin copy is not waited for, the client may never close it
+	stdin, err := c.StdinPipe()
+	if err != nil {
+		fmt.Fprintln(cmd.Stderr, err)
+		return 127
+	}
+	if err = c.Start(); err != nil {
+		fmt.Fprintln(cmd.Stderr, err)
+		return 127
+	}
+	go func() {
+		io.Copy(stdin, cmd.Stdin)
+		stdin.Close()
+	}()
+
+	exited := make(chan struct{})
+	go func() {
+		done := cmd.Done()
+		for {
+			select {
+			case sig := <-cmd.Signals():
+				syscall.Kill(-c.Process.Pid, signalNumber(sig))
+			case <-done:
+				syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+				done = nil
+			case <-exited:
+				return
+			}
+		}
+	}()
+
+	err = c.Wait()
+	close(exited)
+
+	var ee *exec.ExitError
+	if errors.As(err, &ee) {
+		if status, ok := ee.Sys().(syscall.WaitStatus); ok && status.Signaled() {
+			return 128 + int(status.Signal())
+		}
+		return ee.ExitCode()
+	}
+	if err != nil {
+		return 127
+	}
+	return 0
+}
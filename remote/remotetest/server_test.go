@@ -0,0 +1,122 @@
+package remotetest
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+)
+
+func dial(t *testing.T, s *Server, password string) (*ssh.Client, error) {
+	return ssh.Dial("tcp", s.Addr(), &ssh.ClientConfig{
+		User:            "root",
+		Auth:            []ssh.AuthMethod{ssh.Password(password)},
+		HostKeyCallback: ssh.FixedHostKey(s.HostKey()),
+		Timeout:         time.Second,
+	})
+}
+
+func run(t *testing.T, c *ssh.Client, cmd string) (string, error) {
+	session, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	out, err := session.CombinedOutput(cmd)
+	return string(out), err
+}
+
+func TestServerHandle(t *testing.T) {
+	s := NewServer(t, nil)
+	s.Handle("git", Reply("git\n", 0))
+	s.Handle("git status", Reply("clean\n", 1))
+
+	c, err := dial(t, s, "any")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	cases := map[string]string{
+		"git log":    "git\n",
+		"git status": "clean\n",
+		"echo sh":    "sh\n",
+	}
+	for cmd, except := range cases {
+		if out, _ := run(t, c, cmd); out != except {
+			t.Errorf("%s except:%q actual:%q", cmd, except, out)
+		}
+	}
+
+	_, err = run(t, c, "git status")
+	if ee, ok := err.(*ssh.ExitError); !ok || ee.ExitStatus() != 1 {
+		t.Errorf("except exit status 1, actual %v", err)
+	}
+	if len(s.Commands()) != 4 {
+		t.Errorf("except 4 commands, actual %v", s.Commands())
+	}
+}
+
+func TestServerAuth(t *testing.T) {
+	s := NewServer(t, &Options{Passwords: map[string]string{"root": "secret"}})
+	if _, err := dial(t, s, "wrong"); err == nil {
+		t.Error("wrong password should fail")
+	}
+	c, err := dial(t, s, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+}
+
+func TestServerFaults(t *testing.T) {
+	s := NewServer(t, nil)
+
+	s.DropNext(1)
+	if _, err := dial(t, s, ""); err == nil {
+		t.Error("dropped connection should fail")
+	}
+
+	c, err := dial(t, s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetOutputDelay(50 * time.Millisecond)
+	start := time.Now()
+	if out, err := run(t, c, "echo slow"); err != nil || out != "slow\n" {
+		t.Errorf("slow output %q %v", out, err)
+	}
+	if time.Since(start) < 50*time.Millisecond {
+		t.Error("output should be delayed")
+	}
+
+	s.Drop()
+	if _, err = c.NewSession(); err == nil {
+		t.Error("dropped connection should not open sessions")
+	}
+}
+
+func TestServerSignal(t *testing.T) {
+	s := NewServer(t, nil)
+	c, err := dial(t, s, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	session, err := c.NewSession()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer session.Close()
+	if err = session.Start("sleep 10"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	session.Signal(ssh.SIGTERM)
+
+	err = session.Wait()
+	if ee, ok := err.(*ssh.ExitError); !ok || ee.ExitStatus() != 128+15 {
+		t.Errorf("except exit status 143, actual %v", err)
+	}
+}